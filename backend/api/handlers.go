@@ -24,13 +24,17 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/btcsuite/btcd/btcutil"
+
 	"fusion-btc-resolver/common"
 	"fusion-btc-resolver/orchestrator"
 )
@@ -71,25 +75,47 @@ func (h *Handlers) InitiateSwap(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert satoshis back to BTC for the orchestrator
-	satoshis, err := strconv.ParseInt(quote.ToTokenAmount, 10, 64)
+	// The quote carries the exact satoshi amount, which the orchestrator uses as is
+	btcAmount, err := common.ParseSatoshis(quote.ToTokenAmount)
 	if err != nil {
 		log.Printf("ERROR: Failed to parse BTC amount: %v", err)
 		WriteError(w, http.StatusInternalServerError, "Invalid quote amount")
 		return
 	}
-	btcAmount := float64(satoshis) / 1e8 // Convert satoshis to BTC
 
-	log.Printf("[INITIATE] Using quote %s: %.8f BTC for swap", req.QuoteID, btcAmount)
+	evmAmount, err := common.ParseWei(quote.FromTokenAmount)
+	if err != nil {
+		log.Printf("ERROR: Failed to parse EVM amount: %v", err)
+		WriteError(w, http.StatusInternalServerError, "Invalid quote amount")
+		return
+	}
+
+	log.Printf("[INITIATE] Using quote %s: %s BTC for %s ETH", req.QuoteID, common.FormatBtc(btcAmount), common.FormatEth(evmAmount))
 
 	// Call the orchestrator to start the swap process
-	resp, err := h.Orchestrator.InitiateSwapWithAmount(&req, btcAmount)
+	resp, err := h.Orchestrator.InitiateSwapWithAmount(r.Context(), &req, btcAmount, evmAmount)
+	if errors.Is(err, orchestrator.ErrInvalidDestination) || errors.Is(err, orchestrator.ErrUnsupportedAddressType) ||
+		errors.Is(err, orchestrator.ErrUnsupportedTimelockType) || errors.Is(err, orchestrator.ErrInvalidRefundPubKey) ||
+		errors.Is(err, orchestrator.ErrInvalidEvmAddress) {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, orchestrator.ErrShuttingDown) {
+		WriteError(w, http.StatusServiceUnavailable, "Service is shutting down, please retry shortly")
+		return
+	}
+	if errors.Is(err, orchestrator.ErrUnsafeTimelocks) {
+		log.Printf("ERROR: Refusing swap: %v", err)
+		WriteError(w, http.StatusServiceUnavailable, "Swap refused: timelocks cannot be safely ordered right now")
+		return
+	}
 	if err != nil {
 		log.Printf("ERROR: Failed to initiate swap: %v", err)
 		WriteError(w, http.StatusInternalServerError, "Failed to initiate swap")
 		return
 	}
 
+	resp.RefundPsbtPath = "/swap/refund-psbt/" + resp.SwapID
 	WriteJSON(w, http.StatusOK, resp)
 }
 
@@ -109,10 +135,88 @@ func (h *Handlers) GetSwapStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp, err := h.Orchestrator.GetSwapStatus(swapID)
+	if errors.Is(err, orchestrator.ErrSwapNotFound) {
+		WriteError(w, http.StatusNotFound, "Swap not found")
+		return
+	}
 	if err != nil {
+		log.Printf("ERROR: Failed to get status of swap %s: %v", swapID, err)
+		WriteError(w, http.StatusInternalServerError, "Failed to get swap status")
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// SubmitRefund is the HTTP handler for handing the resolver a user-signed
+// refund transaction, which it broadcasts once the HTLC timelock expires.
+// POST /swap/refund/{swapID}
+func (h *Handlers) SubmitRefund(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	swapID := strings.TrimPrefix(r.URL.Path, "/swap/refund/")
+	if swapID == "" {
+		WriteError(w, http.StatusBadRequest, "Swap ID is required")
+		return
+	}
+
+	var req common.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.Orchestrator.SubmitSignedRefund(swapID, &req); err != nil {
+		log.Printf("ERROR: Rejected refund for swap %s: %v", swapID, err)
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	WriteJSON(w, http.StatusAccepted, map[string]string{"status": "refund accepted"})
+}
+
+// GetRefundPsbt is the HTTP handler for building an unsigned PSBT that
+// refunds a swap's deposit, which the user signs with their own wallet.
+// POST /swap/refund-psbt/{swapID}
+func (h *Handlers) GetRefundPsbt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	swapID := strings.TrimPrefix(r.URL.Path, "/swap/refund-psbt/")
+	if swapID == "" {
+		WriteError(w, http.StatusBadRequest, "Swap ID is required")
+		return
+	}
+
+	var req common.RefundPsbtRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	resp, err := h.Orchestrator.BuildRefundPsbt(r.Context(), swapID, &req)
+	if errors.Is(err, orchestrator.ErrSwapNotFound) {
 		WriteError(w, http.StatusNotFound, "Swap not found")
 		return
 	}
+	if errors.Is(err, orchestrator.ErrInvalidRefundRequest) {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, orchestrator.ErrNoDeposit) {
+		WriteError(w, http.StatusConflict, "No deposit to refund was found at the HTLC address")
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to build refund PSBT for swap %s: %v", swapID, err)
+		WriteError(w, http.StatusInternalServerError, "Failed to build refund PSBT")
+		return
+	}
 
 	WriteJSON(w, http.StatusOK, resp)
 }
@@ -142,27 +246,33 @@ func (h *Handlers) GetQuote(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[QUOTE] BTC Destination Address: %s", req.BtcDestinationAddress)
 	}
 
-	// Calculate proper BTC amount based on ETH input
-	// Convert from wei to ETH, then ETH to BTC (demo rate: 1 ETH = 0.375 BTC)
-	amountEthWei := req.Amount                 // Amount in wei
-	amountEth := parseWeiToFloat(amountEthWei) // Convert to ETH
-	btcPerEth := 0.375                         // Demo exchange rate
-	amountBtc := amountEth * btcPerEth         // Calculate BTC amount
-	amountSatoshis := int64(amountBtc * 1e8)   // Convert to satoshis
+	// Calculate the BTC amount based on the ETH input, in integer units
+	// throughout: wei in, satoshis out, rounded down in the resolver's favour.
+	amountWei, err := common.ParseWei(req.Amount)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid amount: must be an integer number of wei")
+		return
+	}
+	amountSatoshis, err := weiToSatoshis(amountWei)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid amount: too large")
+		return
+	}
 
-	log.Printf("[QUOTE] Converting %.8f ETH to %.8f BTC (%d satoshis)", amountEth, amountBtc, amountSatoshis)
+	log.Printf("[QUOTE] Converting %s ETH to %s BTC (%d satoshis)", common.FormatEth(amountWei), common.FormatBtc(amountSatoshis), amountSatoshis)
 
-	// Return proper BTC amount in satoshis as string
+	// Return the exact amounts in their smallest units as strings
 	resp := &common.QuoteResponse{
-		ToTokenAmount: fmt.Sprintf("%d", amountSatoshis), // BTC amount in satoshis
-		Fee:           "50000000000000000",               // 0.05 ETH fee
-		EstimatedTime: 300,                               // 5 minutes
-		QuoteID:       fmt.Sprintf("quote-%d", time.Now().Unix()),
+		FromTokenAmount: amountWei.String(),                           // ETH amount in wei
+		ToTokenAmount:   strconv.FormatInt(int64(amountSatoshis), 10), // BTC amount in satoshis
+		Fee:             "50000000000000000",                          // 0.05 ETH fee
+		EstimatedTime:   300,                                          // 5 minutes
+		QuoteID:         fmt.Sprintf("quote-%d", time.Now().Unix()),
 	}
 
 	// Store the quote for later use during swap initiation
 	h.quotes[resp.QuoteID] = resp
-	log.Printf("[QUOTE] Stored quote %s: %.8f BTC", resp.QuoteID, amountBtc)
+	log.Printf("[QUOTE] Stored quote %s: %s BTC", resp.QuoteID, common.FormatBtc(amountSatoshis))
 
 	WriteJSON(w, http.StatusOK, resp)
 }
@@ -183,13 +293,16 @@ func WriteError(w http.ResponseWriter, status int, message string) {
 	WriteJSON(w, status, errorResponse)
 }
 
-// parseWeiToFloat converts a wei amount string to ETH float64
-func parseWeiToFloat(weiStr string) float64 {
-	wei, err := strconv.ParseFloat(weiStr, 64)
-	if err != nil {
-		log.Printf("ERROR: Failed to parse wei amount: %v", err)
-		return 0
+// satoshisPerEth is the demo exchange rate: 1 ETH = 0.375 BTC.
+const satoshisPerEth = 37_500_000
+
+// weiToSatoshis converts a wei amount to satoshis at the demo rate, rounding down.
+func weiToSatoshis(wei *big.Int) (btcutil.Amount, error) {
+	weiPerEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(common.EthDecimals), nil)
+	sats := new(big.Int).Mul(wei, big.NewInt(satoshisPerEth))
+	sats.Quo(sats, weiPerEth)
+	if !sats.IsInt64() || sats.Int64() > btcutil.MaxSatoshi {
+		return 0, fmt.Errorf("%s wei exceeds the BTC supply", wei)
 	}
-	// Convert wei to ETH (1 ETH = 1e18 wei)
-	return wei / 1e18
+	return btcutil.Amount(sats.Int64()), nil
 }
@@ -2,61 +2,128 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
-	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
 
 	"fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
 	"fusion-btc-resolver/orchestrator"
 	"fusion-btc-resolver/services"
 )
 
-// Mock services for testing
-type mockBtcService struct{}
-type mockEvmService struct{}
+// Mock chains for testing. Only what initiating a swap reaches is
+// implemented; the rest is left to the embedded nil interfaces.
+type mockBtcChain struct{ services.BtcChain }
+type mockEvmChain struct{ services.EvmChain }
 
-func (m *mockBtcService) CreateHtlc(senderPubKey, receiverPubKey, secretHash []byte, lockTime int64) ([]byte, btcutil.Address, error) {
-	addr, _ := btcutil.DecodeAddress("bcrt1qtest123456789", &chaincfg.RegressionNetParams)
-	return []byte("mock-htlc-script"), addr, nil
+func (m *mockBtcChain) NetParams() *chaincfg.Params { return &chaincfg.RegressionNetParams }
+
+func (m *mockBtcChain) CreateHtlc(senderPubKey, receiverPubKey []byte, secretHash []byte, lockTime int64, timelockType common.HtlcTimelockType, addrType common.HtlcAddressType) ([]byte, btcutil.Address, error) {
+	params := &services.HtlcParams{SecretHash: secretHash, ClaimPubKey: receiverPubKey, RefundPubKey: senderPubKey, LockTime: lockTime, TimelockType: timelockType}
+	return services.BuildHtlc(params, addrType, m.NetParams())
+}
+
+// MonitorForDeposit waits for a deposit that never comes, until shutdown.
+func (m *mockBtcChain) MonitorForDeposit(ctx context.Context, htlcAddress btcutil.Address, expectedAmount btcutil.Amount, deadline time.Time) (*services.Deposit, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
 }
 
-func (m *mockBtcService) MonitorForDeposit(htlcAddress btcutil.Address, expectedAmount btcutil.Amount) (*chainhash.Hash, error) {
-	hash, _ := chainhash.NewHashFromStr("0000000000000000000000000000000000000000000000000000000000000001")
-	return hash, nil
+func (m *mockBtcChain) CurrentHeight(ctx context.Context) (int64, error) {
+	return 800_000, nil
 }
 
-func (m *mockBtcService) RedeemHtlc(fundingTxHash *chainhash.Hash, htlcScript []byte, redeemAddress btcutil.Address, key *btcec.PrivateKey, preimage []byte, lockTime int64) (*chainhash.Hash, error) {
-	hash, _ := chainhash.NewHashFromStr("0000000000000000000000000000000000000000000000000000000000000002")
-	return hash, nil
+func (m *mockEvmChain) LatestBlockTime(ctx context.Context) (time.Time, error) {
+	return time.Now(), nil
 }
 
-func (m *mockEvmService) DepositIntoEscrow(userAddress, escrowAddress string, secretHash [32]byte, amount []byte) (string, error) {
-	return "mock-evm-txid", nil
+// newMockOrchestrator wires an orchestrator to the mock chains and a
+// temporary swap store.
+func newMockOrchestrator(t *testing.T) *orchestrator.SwapOrchestrator {
+	t.Helper()
+	claimKeys, err := services.NewClaimKeyring(&config.BtcConfig{ClaimSeed: "000102030405060708090a0b0c0d0e0f"}, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewClaimKeyring failed: %v", err)
+	}
+	secrets, err := services.NewSecretSeed(bytes.Repeat([]byte{0x5e}, 32))
+	if err != nil {
+		t.Fatalf("NewSecretSeed failed: %v", err)
+	}
+	store, err := orchestrator.NewBoltSwapStore(filepath.Join(t.TempDir(), "swaps.db"))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	o := orchestrator.NewSwapOrchestrator(&mockBtcChain{}, &mockEvmChain{}, claimKeys, secrets, store, &config.SwapConfig{
+		DepositWindow:     time.Hour,
+		BtcLockBlocks:     144,
+		BtcBlockInterval:  10 * time.Minute,
+		EvmLockDuration:   12 * time.Hour,
+		MinEvmClaimWindow: 2 * time.Hour,
+		CrossChainMargin:  6 * time.Hour,
+	})
+	t.Cleanup(func() { o.Shutdown(context.Background()) })
+	return o
 }
 
-func (m *mockEvmService) MonitorForClaimEvent(escrowAddress string) ([]byte, error) {
-	return []byte("mock-revealed-secret"), nil
+// requestQuote gets a quote for amountWei through the quote endpoint.
+func requestQuote(t *testing.T, handlers *Handlers, amountWei string) *common.QuoteResponse {
+	t.Helper()
+	reqBody, _ := json.Marshal(common.QuoteRequest{FromTokenAddress: "ETH", ToTokenAddress: "BTC", Amount: amountWei})
+	req := httptest.NewRequest("POST", "/quote", bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+
+	handlers.GetQuote(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the quote, got %d", w.Code)
+	}
+	var quote common.QuoteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &quote); err != nil {
+		t.Fatalf("Failed to unmarshal quote: %v", err)
+	}
+	return &quote
+}
+
+// initiateSwap starts a swap for a 1 ETH quote through the initiation endpoint.
+func initiateSwap(t *testing.T, handlers *Handlers) *httptest.ResponseRecorder {
+	t.Helper()
+	quote := requestQuote(t, handlers, "1000000000000000000")
+	swapReq := common.SwapRequest{
+		QuoteID:               quote.QuoteID,
+		UserBtcRefundPubkey:   "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		UserEvmAddress:        "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B",
+		BtcDestinationAddress: "bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu",
+	}
+
+	reqBody, _ := json.Marshal(swapReq)
+	req := httptest.NewRequest("POST", "/swap/initiate", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handlers.InitiateSwap(w, req)
+	return w
 }
 
 // TestGetQuote tests the quote endpoint
 func TestGetQuote(t *testing.T) {
-	// Create mock orchestrator
-	mockOrchestrator := orchestrator.NewSwapOrchestrator(&mockBtcService{}, &mockEvmService{})
-
-	handlers := NewHandlers(mockOrchestrator)
+	handlers := NewHandlers(newMockOrchestrator(t))
 
 	// Test valid quote request
 	quoteReq := common.QuoteRequest{
 		FromChainID:      0,
-		FromTokenAddress:  "BTC",
+		FromTokenAddress: "BTC",
 		ToChainID:        137,
-		ToTokenAddress:    "0x1bfd67037b42cf73acf2047067bd4f2c47d9bfd6",
+		ToTokenAddress:   "0x1bfd67037b42cf73acf2047067bd4f2c47d9bfd6",
 		Amount:           "10000000",
 	}
 
@@ -85,6 +152,20 @@ func TestGetQuote(t *testing.T) {
 	}
 }
 
+// TestGetQuoteExactAmounts tests that quotes carry integer wei and satoshis
+func TestGetQuoteExactAmounts(t *testing.T) {
+	handlers := NewHandlers(newMockOrchestrator(t))
+
+	quote := requestQuote(t, handlers, "1000000000000000000")
+
+	if quote.FromTokenAmount != "1000000000000000000" {
+		t.Errorf("Expected 1000000000000000000 wei, got %s", quote.FromTokenAmount)
+	}
+	if quote.ToTokenAmount != "37500000" {
+		t.Errorf("Expected 37500000 satoshis, got %s", quote.ToTokenAmount)
+	}
+}
+
 // TestGetQuoteInvalidMethod tests the quote endpoint with wrong HTTP method
 func TestGetQuoteInvalidMethod(t *testing.T) {
 	handlers := &Handlers{}
@@ -114,29 +195,29 @@ func TestGetQuoteInvalidBody(t *testing.T) {
 	}
 }
 
-// TestInitiateSwap tests the swap initiation endpoint
-func TestInitiateSwap(t *testing.T) {
-	// Create mock orchestrator
-	mockOrchestrator := orchestrator.NewSwapOrchestrator(&mockBtcService{}, &mockEvmService{})
+// TestGetQuoteFractionalAmount tests the quote endpoint with a non-integer wei amount
+func TestGetQuoteFractionalAmount(t *testing.T) {
+	handlers := NewHandlers(newMockOrchestrator(t))
+
+	reqBody, _ := json.Marshal(common.QuoteRequest{Amount: "0.5"})
+	req := httptest.NewRequest("POST", "/quote", bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
 
-	handlers := NewHandlers(mockOrchestrator)
+	handlers.GetQuote(w, req)
 
-	// Test valid swap request
-	swapReq := common.SwapRequest{
-		QuoteID:             "quote-placeholder-123",
-		UserBtcRefundPubkey: "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
-		UserEvmAddress:      "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B",
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
 	}
+}
 
-	reqBody, _ := json.Marshal(swapReq)
-	req := httptest.NewRequest("POST", "/swap/initiate", bytes.NewBuffer(reqBody))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
+// TestInitiateSwap tests the swap initiation endpoint
+func TestInitiateSwap(t *testing.T) {
+	handlers := NewHandlers(newMockOrchestrator(t))
 
-	handlers.InitiateSwap(w, req)
+	w := initiateSwap(t, handlers)
 
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Errorf("Expected status 200, got %d: %s", w.Code, w.Body.String())
 	}
 
 	var response common.SwapResponse
@@ -169,13 +250,15 @@ func TestInitiateSwapInvalidMethod(t *testing.T) {
 
 // TestGetSwapStatus tests the swap status endpoint
 func TestGetSwapStatus(t *testing.T) {
-	// Create mock orchestrator
-	mockOrchestrator := orchestrator.NewSwapOrchestrator(&mockBtcService{}, &mockEvmService{})
+	handlers := NewHandlers(newMockOrchestrator(t))
 
-	handlers := NewHandlers(mockOrchestrator)
+	var swap common.SwapResponse
+	if err := json.Unmarshal(initiateSwap(t, handlers).Body.Bytes(), &swap); err != nil {
+		t.Fatalf("Failed to unmarshal swap: %v", err)
+	}
 
 	// Test valid status request
-	req := httptest.NewRequest("GET", "/swap/status/test-swap-id", nil)
+	req := httptest.NewRequest("GET", "/swap/status/"+swap.SwapID, nil)
 	w := httptest.NewRecorder()
 
 	handlers.GetSwapStatus(w, req)
@@ -189,8 +272,22 @@ func TestGetSwapStatus(t *testing.T) {
 		t.Errorf("Failed to unmarshal response: %v", err)
 	}
 
-	if response.SwapID == "" {
-		t.Error("Expected SwapID to be set")
+	if response.SwapID != swap.SwapID {
+		t.Errorf("Expected SwapID %s, got %s", swap.SwapID, response.SwapID)
+	}
+}
+
+// TestGetSwapStatusUnknown tests the swap status endpoint with a swap ID it does not know
+func TestGetSwapStatusUnknown(t *testing.T) {
+	handlers := NewHandlers(newMockOrchestrator(t))
+
+	req := httptest.NewRequest("GET", "/swap/status/swap-unknown", nil)
+	w := httptest.NewRecorder()
+
+	handlers.GetSwapStatus(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
 	}
 }
 
@@ -220,4 +317,4 @@ func TestGetSwapStatusMissingID(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
-} 
\ No newline at end of file
+}
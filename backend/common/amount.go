@@ -0,0 +1,120 @@
+package common
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// Amounts never pass through float64. BTC amounts are btcutil.Amount (integer
+// satoshis) and EVM amounts are *big.Int (integer wei), so a quoted amount
+// reaches the chain exactly, to the last satoshi and wei. Decimal strings are
+// only used at the edges, for display and for human-entered values.
+
+const (
+	BtcDecimals = 8  // Satoshis per BTC, as a power of ten
+	EthDecimals = 18 // Wei per ETH, as a power of ten
+)
+
+// ParseSatoshis parses a non-negative integer satoshi amount, e.g. "10000".
+func ParseSatoshis(s string) (btcutil.Amount, error) {
+	v, err := parseUnits(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid satoshi amount %q: %v", s, err)
+	}
+	if !v.IsInt64() {
+		return 0, fmt.Errorf("invalid satoshi amount %q: out of range", s)
+	}
+	return btcutil.Amount(v.Int64()), nil
+}
+
+// ParseWei parses a non-negative integer wei amount of any size.
+func ParseWei(s string) (*big.Int, error) {
+	v, err := parseUnits(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wei amount %q: %v", s, err)
+	}
+	return v, nil
+}
+
+// ParseBtc parses a decimal BTC amount, e.g. "0.00010000", into satoshis.
+// More than 8 decimal places is an error rather than being rounded away.
+func ParseBtc(s string) (btcutil.Amount, error) {
+	v, err := ParseDecimal(s, BtcDecimals)
+	if err != nil {
+		return 0, err
+	}
+	if !v.IsInt64() {
+		return 0, fmt.Errorf("invalid BTC amount %q: out of range", s)
+	}
+	return btcutil.Amount(v.Int64()), nil
+}
+
+// FormatBtc formats satoshis as a decimal BTC string with all 8 places.
+func FormatBtc(a btcutil.Amount) string {
+	return FormatDecimal(big.NewInt(int64(a)), BtcDecimals)
+}
+
+// FormatEth formats wei as a decimal ETH string with all 18 places.
+func FormatEth(wei *big.Int) string {
+	return FormatDecimal(wei, EthDecimals)
+}
+
+// ParseDecimal parses a non-negative decimal string into integer base units,
+// where one whole unit is 10^decimals base units.
+func ParseDecimal(s string, decimals int) (*big.Int, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("invalid amount %q: more than %d decimal places", s, decimals)
+	}
+	if whole == "" && frac == "" {
+		return nil, fmt.Errorf("invalid amount %q: no digits", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	v, err := parseUnits(whole + frac + strings.Repeat("0", decimals-len(frac)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q: %v", s, err)
+	}
+	return v, nil
+}
+
+// FormatDecimal formats integer base units as a decimal string with exactly
+// decimals fractional digits.
+func FormatDecimal(v *big.Int, decimals int) string {
+	digits := new(big.Int).Abs(v).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	split := len(digits) - decimals
+
+	sign := ""
+	if v.Sign() < 0 {
+		sign = "-"
+	}
+	if decimals == 0 {
+		return sign + digits
+	}
+	return sign + digits[:split] + "." + digits[split:]
+}
+
+// parseUnits parses a string of decimal digits. Signs, exponents and
+// separators are all rejected.
+func parseUnits(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty amount")
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("not an integer")
+	}
+	return v, nil
+}
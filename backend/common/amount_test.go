@@ -0,0 +1,76 @@
+package common
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// TestBtcAmountRoundTrip checks that decimal BTC strings map to exact satoshis and back.
+func TestBtcAmountRoundTrip(t *testing.T) {
+	cases := map[string]btcutil.Amount{
+		"0.00000001":        1,
+		"0.1":               10_000_000,
+		"0.3":               30_000_000,
+		"21000000":          21_000_000 * btcutil.SatoshiPerBitcoin,
+		"20999999.99999999": 21_000_000*btcutil.SatoshiPerBitcoin - 1,
+	}
+	for in, want := range cases {
+		got, err := ParseBtc(in)
+		if err != nil {
+			t.Fatalf("ParseBtc(%q) failed: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("ParseBtc(%q) = %d, want %d", in, got, want)
+		}
+		again, err := ParseBtc(FormatBtc(got))
+		if err != nil || again != got {
+			t.Errorf("round trip of %q through %q gave %d, %v", in, FormatBtc(got), again, err)
+		}
+	}
+
+	if FormatBtc(10_000) != "0.00010000" {
+		t.Errorf("unexpected formatting %q", FormatBtc(10_000))
+	}
+}
+
+// TestWeiAmountsAboveFloatPrecision checks wei values that float64 cannot represent.
+func TestWeiAmountsAboveFloatPrecision(t *testing.T) {
+	// 2^53 + 1 wei, the first integer a float64 rounds.
+	wei, err := ParseWei("9007199254740993")
+	if err != nil {
+		t.Fatalf("ParseWei failed: %v", err)
+	}
+	if wei.String() != "9007199254740993" {
+		t.Errorf("expected exact wei, got %s", wei)
+	}
+
+	eth, err := ParseDecimal("1234567.123456789012345678", EthDecimals)
+	if err != nil {
+		t.Fatalf("ParseDecimal failed: %v", err)
+	}
+	if FormatEth(eth) != "1234567.123456789012345678" {
+		t.Errorf("unexpected formatting %q", FormatEth(eth))
+	}
+	if FormatEth(big.NewInt(1)) != "0.000000000000000001" {
+		t.Errorf("unexpected formatting %q", FormatEth(big.NewInt(1)))
+	}
+}
+
+// TestAmountParsingRejectsAmbiguousInput checks that nothing is silently rounded or coerced.
+func TestAmountParsingRejectsAmbiguousInput(t *testing.T) {
+	for _, in := range []string{"", ".", "-1", "+1", "1e8", "0.000000001", "1,000", " 1", "0x10"} {
+		if _, err := ParseBtc(in); err == nil {
+			t.Errorf("ParseBtc(%q) should fail", in)
+		}
+	}
+	for _, in := range []string{"", "1.5", "-1", "1e18"} {
+		if _, err := ParseWei(in); err == nil {
+			t.Errorf("ParseWei(%q) should fail", in)
+		}
+	}
+	if _, err := ParseSatoshis("9223372036854775808"); err == nil {
+		t.Error("ParseSatoshis should reject values beyond int64")
+	}
+}
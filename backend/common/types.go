@@ -37,32 +37,114 @@ type QuoteRequest struct {
 
 // QuoteResponse represents the data sent back to a client with quote details.
 type QuoteResponse struct {
-	ToTokenAmount string `json:"toTokenAmount"` // Estimated amount of token the user will receive
-	Fee           string `json:"fee"`           // The resolver's fee for the service
-	EstimatedTime int    `json:"estimatedTime"` // Estimated time in seconds for the swap to complete
-	QuoteID       string `json:"quoteId"`       // A unique identifier for this quote
+	FromTokenAmount string `json:"fromTokenAmount"` // Amount quoted for, in the source token's smallest unit (wei)
+	ToTokenAmount   string `json:"toTokenAmount"`   // Amount of token the user will receive, in its smallest unit (satoshis)
+	Fee             string `json:"fee"`             // The resolver's fee for the service
+	EstimatedTime   int    `json:"estimatedTime"`   // Estimated time in seconds for the swap to complete
+	QuoteID         string `json:"quoteId"`         // A unique identifier for this quote
 }
 
 // SwapRequest represents the data required from a client to initiate a swap.
 type SwapRequest struct {
-	QuoteID               string `json:"quoteId"`                         // The ID from the corresponding QuoteResponse
-	UserBtcRefundPubkey   string `json:"userBtcRefundPubkey"`             // User's BTC public key for the refund path
-	UserEvmAddress        string `json:"userEvmAddress"`                  // User's destination address on the EVM chain
-	BtcDestinationAddress string `json:"btcDestinationAddress,omitempty"` // User's Bitcoin address where they want to receive BTC (optional for non-BTC swaps)
+	QuoteID               string           `json:"quoteId"`                         // The ID from the corresponding QuoteResponse
+	UserBtcRefundPubkey   string           `json:"userBtcRefundPubkey"`             // User's BTC public key for the refund path
+	UserEvmAddress        string           `json:"userEvmAddress"`                  // User's destination address on the EVM chain
+	BtcDestinationAddress string           `json:"btcDestinationAddress,omitempty"` // User's Bitcoin address where they want to receive BTC (optional for non-BTC swaps)
+	AddressType           HtlcAddressType  `json:"addressType,omitempty"`           // Deposit address type, defaults to p2sh
+	TimelockType          HtlcTimelockType `json:"timelockType,omitempty"`          // Refund timelock type, defaults to cltv
 }
 
+// HtlcAddressType selects how the HTLC script is committed to in the deposit address.
+type HtlcAddressType string
+
+const (
+	HtlcP2SH  HtlcAddressType = "p2sh"  // Legacy pay-to-script-hash, supported by every wallet
+	HtlcP2WSH HtlcAddressType = "p2wsh" // Native SegWit pay-to-witness-script-hash, cheaper to spend
+	HtlcP2TR  HtlcAddressType = "p2tr"  // Taproot, spending reveals only the claim or refund leaf used
+)
+
+// HtlcTimelockType selects how the HTLC's refund branch is timelocked.
+type HtlcTimelockType string
+
+const (
+	HtlcCLTV HtlcTimelockType = "cltv" // Absolute block height, fixed when the swap is created
+	HtlcCSV  HtlcTimelockType = "csv"  // Relative delay in blocks, counted from the deposit's confirmation
+)
+
 // SwapResponse represents the initial response after a swap has been initiated.
 type SwapResponse struct {
-	SwapID            string    `json:"swapId"`            // A unique identifier for this swap lifecycle
-	BtcDepositAddress string    `json:"btcDepositAddress"` // The P2SH address the user must send BTC to
-	ExpiresAt         time.Time `json:"expiresAt"`         // The time when this deposit address will expire
+	SwapID            string           `json:"swapId"`                // A unique identifier for this swap lifecycle
+	BtcDepositAddress string           `json:"btcDepositAddress"`     // The HTLC address the user must send BTC to
+	AddressType       HtlcAddressType  `json:"addressType"`           // The type of BtcDepositAddress
+	TimelockType      HtlcTimelockType `json:"timelockType"`          // How the HTLC's refund branch is timelocked
+	RefundDelay       int64            `json:"refundDelay,omitempty"` // csv only: blocks after the deposit confirms before the refund opens
+	LockTime          int64            `json:"lockTime,omitempty"`    // cltv only: block height from which the refund branch can be spent
+	RedeemScript      string           `json:"redeemScript"`          // Hex-encoded HTLC script; for p2tr, the tapscript bundle of internal key, claim leaf and refund leaf
+	RefundPsbtPath    string           `json:"refundPsbtPath"`        // Endpoint that builds an unsigned refund PSBT once the deposit confirms
+	ExpiresAt         time.Time        `json:"expiresAt"`             // The time when this deposit address will expire
+}
+
+// RefundRequest carries a user-signed transaction spending the HTLC's refund branch.
+type RefundRequest struct {
+	SignedRefundTx string `json:"signedRefundTx"` // Hex-encoded, fully signed refund transaction
+}
+
+// RefundPsbtRequest asks for an unsigned transaction refunding a swap's
+// deposit to an address of the user's choosing.
+type RefundPsbtRequest struct {
+	RefundAddress string `json:"refundAddress"`     // Where the refund pays to
+	FeeRate       int64  `json:"feeRate,omitempty"` // In sat/vB; 0 uses the resolver's estimate
+}
+
+// RefundPsbtResponse carries an unsigned BIP174 refund PSBT for the user's
+// wallet to sign. It spends every deposit output through the refund branch.
+type RefundPsbtResponse struct {
+	Psbt         string `json:"psbt"`         // Base64-encoded PSBT
+	Fee          string `json:"fee"`          // Fee paid by the refund, in satoshis
+	Inputs       int    `json:"inputs"`       // Number of deposit outputs spent
+	RefundHeight int64  `json:"refundHeight"` // First block height the refund can be mined in
 }
 
 // SwapStatusResponse represents the data sent to a client asking for an update.
 type SwapStatusResponse struct {
-	SwapID  string     `json:"swapId"`
-	Status  SwapStatus `json:"status"`
-	Message string     `json:"message"` // A human-readable message about the current status
+	SwapID  string           `json:"swapId"`
+	Status  SwapStatus       `json:"status"`
+	Message string           `json:"message"`           // A human-readable message about the current status
+	Deposit *DepositSummary  `json:"deposit,omitempty"` // Set once the BTC deposit has confirmed
+	History []SwapTransition `json:"history"`           // Every status change the swap went through, oldest first
+}
+
+// DepositSummary describes a swap's confirmed BTC deposit and how it compared
+// to the quote. Amounts are in satoshis.
+type DepositSummary struct {
+	QuotedAmount        string         `json:"quotedAmount"`                  // What the user was asked to deposit
+	ReceivedAmount      string         `json:"receivedAmount"`                // What the user paid, summed over every UTXO
+	SwapAmount          string         `json:"swapAmount"`                    // What the swap proceeds with after the outcome is applied
+	EvmAmount           string         `json:"evmAmount,omitempty"`           // What the EVM escrow pays for SwapAmount, in wei
+	Utxos               int            `json:"utxos"`                         // Number of outputs the deposit was paid in
+	Outcome             DepositOutcome `json:"outcome"`                       // What was done about a mismatch
+	SurplusRefundTxHash string         `json:"surplusRefundTxHash,omitempty"` // overpaid_surplus_refunded only: the surplus payment, once sent
+}
+
+// DepositOutcome says how a confirmed deposit compared to the quoted amount,
+// and what the resolver did about it.
+type DepositOutcome string
+
+const (
+	DepositExact             DepositOutcome = "exact"                     // Paid exactly the quoted amount
+	DepositRequoted          DepositOutcome = "underpaid_requoted"        // Paid less; the swap proceeds with the amount received
+	DepositUnderpaidRefunded DepositOutcome = "underpaid_refunded"        // Paid less; the whole deposit is refunded
+	DepositSurplusSwapped    DepositOutcome = "overpaid_passed_through"   // Paid more; the surplus is swapped too
+	DepositSurplusRefunded   DepositOutcome = "overpaid_surplus_refunded" // Paid more; the surplus is paid back to the user
+)
+
+// SwapTransition records a single status change in a swap's lifecycle.
+type SwapTransition struct {
+	From   SwapStatus `json:"from,omitempty"` // Empty for the initial transition into PENDING_DEPOSIT
+	To     SwapStatus `json:"to"`
+	Reason string     `json:"reason"`           // Why the swap moved, e.g. "BTC deposit confirmed"
+	TxHash string     `json:"txHash,omitempty"` // The BTC or EVM transaction that triggered the move, if any
+	At     time.Time  `json:"at"`
 }
 
 // SwapStatus is an enumeration for the possible states of a swap.
@@ -73,9 +155,10 @@ const (
 	StatusBtcConfirmed   SwapStatus = "BTC_CONFIRMED"   // BTC deposit confirmed, processing EVM leg
 	StatusEvmFulfilled   SwapStatus = "EVM_FULFILLED"   // ETH sent to user, waiting for user to claim
 	StatusEvmClaimed     SwapStatus = "EVM_CLAIMED"     // User has claimed ETH, revealing the secret
-	StatusBtcWithdrawn   SwapStatus = "BTC_WITHDRAWN"   // Resolver has withdrawn BTC
+	StatusBtcWithdrawn   SwapStatus = "BTC_WITHDRAWN"   // BTC payout broadcast, waiting for it to confirm
 	StatusCompleted      SwapStatus = "COMPLETED"       // Swap successfully completed
 	StatusExpired        SwapStatus = "EXPIRED"         // Swap expired before BTC deposit
+	StatusRefundPending  SwapStatus = "REFUND_PENDING"  // EVM leg failed, user's BTC will be refunded once the HTLC timelock expires
 	StatusRefunded       SwapStatus = "REFUNDED"        // User's BTC has been refunded after timeout
 	StatusError          SwapStatus = "ERROR"           // An unrecoverable error occurred
 )
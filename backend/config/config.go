@@ -29,6 +29,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
@@ -36,18 +37,44 @@ import (
 
 // BtcConfig holds all configuration specific to the Bitcoin node connection.
 type BtcConfig struct {
-	RPCUser         string `env:"BTC_RPC_USER,required"`
-	RPCPass         string `env:"BTC_RPC_PASS,required"`
+	Backend         string `env:"BTC_BACKEND" envDefault:"bitcoind"`                                              // bitcoind (RPC with wallet) or esplora (REST API, no node needed)
+	RPCUser         string `env:"BTC_RPC_USER"`                                                                   // Required by the bitcoind backend
+	RPCPass         string `env:"BTC_RPC_PASS"`                                                                   // Required by the bitcoind backend
+	Network         string `env:"BTC_NETWORK" envDefault:"regtest"`                                               // One of mainnet, testnet3, signet, regtest
 	RPCHost         string `env:"BTC_RPC_HOST" envDefault:"localhost:18443"`                                      // Default for regtest
 	ResolverAddress string `env:"BTC_RESOLVER_ADDRESS" envDefault:"bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu"` // Resolver's BTC address for sending
+
+	DepositPollInterval  time.Duration `env:"BTC_DEPOSIT_POLL_INTERVAL" envDefault:"10s"` // How often every HTLC address is reconciled in one batched poll
+	DepositConfirmations int64         `env:"BTC_DEPOSIT_CONFIRMATIONS" envDefault:"1"`   // Confirmations required before a deposit is accepted
+
+	ZmqRawTx     string `env:"BTC_ZMQ_RAWTX"`     // bitcoind -zmqpubrawtx endpoint, e.g. tcp://127.0.0.1:28333; empty to rely on polling
+	ZmqHashBlock string `env:"BTC_ZMQ_HASHBLOCK"` // bitcoind -zmqpubhashblock endpoint, may equal BTC_ZMQ_RAWTX
+
+	FeeConfTarget int64 `env:"BTC_FEE_CONF_TARGET" envDefault:"6"` // Blocks within which redeems should confirm, passed to estimatesmartfee
+	MinFeeRate    int64 `env:"BTC_MIN_FEE_RATE" envDefault:"1"`    // Fee rate floor in sat/vB, also used when there is no estimate
+	MaxFeeRate    int64 `env:"BTC_MAX_FEE_RATE" envDefault:"500"`  // Fee rate ceiling in sat/vB
+
+	BumpAfterBlocks int64         `env:"BTC_BUMP_AFTER_BLOCKS" envDefault:"2"`   // Blocks a broadcast may stay unconfirmed before its fee is bumped
+	TxTrackInterval time.Duration `env:"BTC_TX_TRACK_INTERVAL" envDefault:"30s"` // How often broadcast transactions are checked for confirmation
+
+	TaprootInternalKey string `env:"BTC_TAPROOT_INTERNAL_KEY" envDefault:"nums"` // Internal key of P2TR HTLCs: nums (script path only) or musig2 (user+resolver)
+
+	ClaimKey  string `env:"BTC_CLAIM_KEY"`  // WIF key claiming every HTLC; set this or BTC_CLAIM_SEED
+	ClaimSeed string `env:"BTC_CLAIM_SEED"` // Hex BIP32 seed from which a fresh claim key is derived per swap
+
+	EsploraURL string `env:"BTC_ESPLORA_URL"` // Esplora REST API base, e.g. https://blockstream.info/testnet/api; required by the esplora backend
+	WalletKey  string `env:"BTC_WALLET_KEY"`  // WIF key of the P2WPKH BTC_RESOLVER_ADDRESS, which the esplora backend pays out from
 }
 
 // EvmConfig holds all configuration for connecting to an EVM-compatible chain.
 type EvmConfig struct {
 	RPCURL     string `env:"EVM_RPC_URL,required"`
-	PrivateKey string `env:"EVM_PRIVATE_KEY,required"` // The resolver's hot wallet private key
+	PrivateKey string `env:"EVM_PRIVATE_KEY"` // The resolver's hot wallet private key; required unless VAULT_PATH holds it
 	ChainID    int64  `env:"EVM_CHAIN_ID,required"`
 	DemoMode   bool   `env:"DEMO_MODE" envDefault:"false"`
+
+	ClaimPollInterval time.Duration `env:"EVM_CLAIM_POLL_INTERVAL" envDefault:"15s"` // How often new blocks are scanned for SecretRevealed events
+	LogBlockRange     uint64        `env:"EVM_LOG_BLOCK_RANGE" envDefault:"2000"`    // Maximum number of blocks per eth_getLogs query
 }
 
 // OneInchConfig holds configuration for the 1inch Developer Portal API.
@@ -55,12 +82,61 @@ type OneInchConfig struct {
 	APIKey string `env:"ONEINCH_API_KEY,required"`
 }
 
+// SwapConfig holds tuning parameters for the swap orchestrator.
+type SwapConfig struct {
+	RefundRetryInterval  time.Duration `env:"SWAP_REFUND_RETRY_INTERVAL" envDefault:"1m"`  // How often a pending refund is checked and rebroadcast
+	EscrowRefundInterval time.Duration `env:"SWAP_ESCROW_REFUND_INTERVAL" envDefault:"5m"` // How often expired EVM escrows are swept for refunds
+	DepositWindow        time.Duration `env:"SWAP_DEPOSIT_WINDOW" envDefault:"1h"`         // How long the user has to deposit BTC
+	ReorgCheckInterval   time.Duration `env:"SWAP_REORG_CHECK_INTERVAL" envDefault:"30s"`  // How often the BTC tip is checked; each new tip rechecks accepted deposits for reorgs
+	PayoutCheckInterval  time.Duration `env:"SWAP_PAYOUT_CHECK_INTERVAL" envDefault:"1m"`  // How often a broadcast payout is checked for confirmations
+	PayoutConfirmations  int64         `env:"SWAP_PAYOUT_CONFIRMATIONS" envDefault:"1"`    // Confirmations the BTC payout needs before a swap is COMPLETED
+
+	// What to do when the confirmed deposit differs from the quoted amount.
+	UnderpaymentPolicy string `env:"SWAP_UNDERPAYMENT_POLICY" envDefault:"refund"`     // refund (refund the whole deposit) or requote (swap the amount received)
+	OverpaymentPolicy  string `env:"SWAP_OVERPAYMENT_POLICY" envDefault:"passthrough"` // passthrough (swap the whole deposit) or refund (pay the surplus back)
+
+	// Cross-chain timelock planning. The BTC refund branch must open well after
+	// the EVM escrow expires, so that once the secret is revealed on the EVM
+	// chain the resolver always has time to claim the BTC.
+	BtcLockBlocks     int64         `env:"TIMELOCK_BTC_BLOCKS" envDefault:"144"`          // HTLC refund delay in blocks from the current tip
+	BtcBlockInterval  time.Duration `env:"TIMELOCK_BTC_BLOCK_INTERVAL" envDefault:"10m"`  // Block interval assumed when converting blocks to time
+	EvmLockDuration   time.Duration `env:"TIMELOCK_EVM_DURATION" envDefault:"12h"`        // EVM escrow timelock from the current EVM block time
+	MinEvmClaimWindow time.Duration `env:"TIMELOCK_MIN_EVM_CLAIM_WINDOW" envDefault:"2h"` // Minimum time the user has to claim the escrow after funding
+	CrossChainMargin  time.Duration `env:"TIMELOCK_CROSS_CHAIN_MARGIN" envDefault:"6h"`   // Minimum gap between EVM expiry and the BTC refund opening
+}
+
+// StoreConfig holds configuration for the on-disk swap store.
+type StoreConfig struct {
+	Path string `env:"SWAP_STORE_PATH" envDefault:"data/swaps.db"` // bbolt database holding every swap and its secret
+}
+
+// SecretConfig holds the encrypted master seed every swap secret is derived from.
+type SecretConfig struct {
+	SeedPath   string `env:"SECRET_SEED_PATH" envDefault:"data/secret_seed.json"` // Generated on first start; back it up, it recovers every swap secret
+	Passphrase string `env:"SECRET_SEED_PASSPHRASE"`                              // Required; encrypts the seed file
+
+	Recover     bool   `env:"SECRET_RECOVERY" envDefault:"false"`    // Rebuild swaps with funded EVM escrows from the seed before starting, e.g. after losing the swap store
+	RecoveryGap uint32 `env:"SECRET_RECOVERY_GAP" envDefault:"1000"` // Consecutive key indexes without an escrow after which recovery stops
+}
+
+// VaultConfig locates the encrypted vault holding the resolver's keys.
+type VaultConfig struct {
+	Path           string `env:"VAULT_PATH"`            // Encrypted key vault, created from the plaintext key settings on first start; empty to use those settings directly
+	PassphraseFile string `env:"VAULT_PASSPHRASE_FILE"` // File whose first line unlocks the vault; empty to prompt on the terminal
+}
+
 // Config is the top-level struct that aggregates all configuration for the application.
 type Config struct {
 	Bitcoin BtcConfig
 	EVM     EvmConfig
 	OneInch OneInchConfig
+	Store   StoreConfig
+	Secrets SecretConfig
+	Vault   VaultConfig
+	Swap    SwapConfig
 	Port    string `env:"PORT" envDefault:"8080"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"` // How long SIGTERM waits for HTTP requests and swaps to drain
 }
 
 // Load reads configuration from environment variables and populates the Config struct.
@@ -0,0 +1,25 @@
+// Package settlement holds the Go bindings of the FusionBtcSettlement escrow
+// contract. settlement_bindings.go is generated from FusionBtcSettlement.abi.json
+// by abigen; regenerate it with go generate after changing the contract.
+package settlement
+
+//go:generate abigen --abi FusionBtcSettlement.abi.json --pkg settlement --type FusionBtcSettlement --out settlement_bindings.go
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// FusionBtcSettlementEscrow is an escrow as getEscrow returns it. The ABI
+// returns its fields as a flat tuple, for which abigen only generates an
+// anonymous struct, so this names it for the EVM services to pass around.
+type FusionBtcSettlementEscrow struct {
+	User     common.Address
+	Resolver common.Address
+	Token    common.Address
+	Amount   *big.Int
+	Timelock *big.Int
+	Claimed  bool
+	Refunded bool
+}
@@ -26,25 +26,16 @@ var (
 	_ = common.Big1
 	_ = types.BloomLookup
 	_ = event.NewSubscription
+	_ = abi.ConvertType
 )
 
-// FusionBtcSettlementEscrow is an auto generated low-level Go binding around an user-defined struct.
-type FusionBtcSettlementEscrow struct {
-	User     common.Address
-	Resolver common.Address
-	Token    common.Address
-	Amount   *big.Int
-	Timelock *big.Int
-	Claimed  bool
-	Refunded bool
-}
-
 // FusionBtcSettlementMetaData contains all meta data concerning the FusionBtcSettlement contract.
 var FusionBtcSettlementMetaData = &bind.MetaData{
 	ABI: "[{\"type\":\"constructor\",\"inputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"whitelistResolver\",\"inputs\":[{\"name\":\"resolver\",\"type\":\"address\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"createEscrow\",\"inputs\":[{\"name\":\"secretHash\",\"type\":\"bytes32\"},{\"name\":\"user\",\"type\":\"address\"},{\"name\":\"token\",\"type\":\"address\"},{\"name\":\"amount\",\"type\":\"uint256\"},{\"name\":\"timelock\",\"type\":\"uint256\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"claimEscrow\",\"inputs\":[{\"name\":\"secretHash\",\"type\":\"bytes32\"},{\"name\":\"secret\",\"type\":\"bytes32\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"refundEscrow\",\"inputs\":[{\"name\":\"secretHash\",\"type\":\"bytes32\"}],\"outputs\":[],\"stateMutability\":\"nonpayable\"},{\"type\":\"function\",\"name\":\"getEscrow\",\"inputs\":[{\"name\":\"secretHash\",\"type\":\"bytes32\"}],\"outputs\":[{\"name\":\"user\",\"type\":\"address\"},{\"name\":\"resolver\",\"type\":\"address\"},{\"name\":\"token\",\"type\":\"address\"},{\"name\":\"amount\",\"type\":\"uint256\"},{\"name\":\"timelock\",\"type\":\"uint256\"},{\"name\":\"claimed\",\"type\":\"bool\"},{\"name\":\"refunded\",\"type\":\"bool\"}],\"stateMutability\":\"view\"},{\"type\":\"function\",\"name\":\"escrows\",\"inputs\":[{\"name\":\"\",\"type\":\"bytes32\"}],\"outputs\":[{\"name\":\"user\",\"type\":\"address\"},{\"name\":\"resolver\",\"type\":\"address\"},{\"name\":\"token\",\"type\":\"address\"},{\"name\":\"amount\",\"type\":\"uint256\"},{\"name\":\"timelock\",\"type\":\"uint256\"},{\"name\":\"claimed\",\"type\":\"bool\"},{\"name\":\"refunded\",\"type\":\"bool\"}],\"stateMutability\":\"view\"},{\"type\":\"event\",\"name\":\"SecretRevealed\",\"inputs\":[{\"name\":\"secretHash\",\"type\":\"bytes32\",\"indexed\":true},{\"name\":\"secret\",\"type\":\"bytes32\",\"indexed\":false},{\"name\":\"resolver\",\"type\":\"address\",\"indexed\":true},{\"name\":\"user\",\"type\":\"address\",\"indexed\":true}]},{\"type\":\"event\",\"name\":\"EscrowCreated\",\"inputs\":[{\"name\":\"secretHash\",\"type\":\"bytes32\",\"indexed\":true},{\"name\":\"user\",\"type\":\"address\",\"indexed\":true},{\"name\":\"token\",\"type\":\"address\",\"indexed\":true},{\"name\":\"amount\",\"type\":\"uint256\",\"indexed\":false},{\"name\":\"timelock\",\"type\":\"uint256\",\"indexed\":false}]},{\"type\":\"event\",\"name\":\"EscrowClaimed\",\"inputs\":[{\"name\":\"secretHash\",\"type\":\"bytes32\",\"indexed\":true},{\"name\":\"resolver\",\"type\":\"address\",\"indexed\":true},{\"name\":\"secret\",\"type\":\"bytes32\",\"indexed\":false}]},{\"type\":\"event\",\"name\":\"EscrowRefunded\",\"inputs\":[{\"name\":\"secretHash\",\"type\":\"bytes32\",\"indexed\":true},{\"name\":\"user\",\"type\":\"address\",\"indexed\":true}]}]",
 }
 
 // FusionBtcSettlementABI is the input ABI used to generate the binding from.
+// Deprecated: Use FusionBtcSettlementMetaData.ABI instead.
 var FusionBtcSettlementABI = FusionBtcSettlementMetaData.ABI
 
 // FusionBtcSettlement is an auto generated Go binding around an Ethereum contract.
@@ -69,6 +60,43 @@ type FusionBtcSettlementFilterer struct {
 	contract *bind.BoundContract // Generic contract wrapper for the low level calls
 }
 
+// FusionBtcSettlementSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type FusionBtcSettlementSession struct {
+	Contract     *FusionBtcSettlement // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts        // Call options to use throughout this session
+	TransactOpts bind.TransactOpts    // Transaction auth options to use throughout this session
+}
+
+// FusionBtcSettlementCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type FusionBtcSettlementCallerSession struct {
+	Contract *FusionBtcSettlementCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts              // Call options to use throughout this session
+}
+
+// FusionBtcSettlementTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type FusionBtcSettlementTransactorSession struct {
+	Contract     *FusionBtcSettlementTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts              // Transaction auth options to use throughout this session
+}
+
+// FusionBtcSettlementRaw is an auto generated low-level Go binding around an Ethereum contract.
+type FusionBtcSettlementRaw struct {
+	Contract *FusionBtcSettlement // Generic contract binding to access the raw methods on
+}
+
+// FusionBtcSettlementCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type FusionBtcSettlementCallerRaw struct {
+	Contract *FusionBtcSettlementCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// FusionBtcSettlementTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type FusionBtcSettlementTransactorRaw struct {
+	Contract *FusionBtcSettlementTransactor // Generic write-only contract binding to access the raw methods on
+}
+
 // NewFusionBtcSettlement creates a new instance of FusionBtcSettlement, bound to a specific deployed contract.
 func NewFusionBtcSettlement(address common.Address, backend bind.ContractBackend) (*FusionBtcSettlement, error) {
 	contract, err := bindFusionBtcSettlement(address, backend, backend, backend)
@@ -78,26 +106,153 @@ func NewFusionBtcSettlement(address common.Address, backend bind.ContractBackend
 	return &FusionBtcSettlement{FusionBtcSettlementCaller: FusionBtcSettlementCaller{contract: contract}, FusionBtcSettlementTransactor: FusionBtcSettlementTransactor{contract: contract}, FusionBtcSettlementFilterer: FusionBtcSettlementFilterer{contract: contract}}, nil
 }
 
+// NewFusionBtcSettlementCaller creates a new read-only instance of FusionBtcSettlement, bound to a specific deployed contract.
+func NewFusionBtcSettlementCaller(address common.Address, caller bind.ContractCaller) (*FusionBtcSettlementCaller, error) {
+	contract, err := bindFusionBtcSettlement(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &FusionBtcSettlementCaller{contract: contract}, nil
+}
+
+// NewFusionBtcSettlementTransactor creates a new write-only instance of FusionBtcSettlement, bound to a specific deployed contract.
+func NewFusionBtcSettlementTransactor(address common.Address, transactor bind.ContractTransactor) (*FusionBtcSettlementTransactor, error) {
+	contract, err := bindFusionBtcSettlement(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &FusionBtcSettlementTransactor{contract: contract}, nil
+}
+
+// NewFusionBtcSettlementFilterer creates a new log filterer instance of FusionBtcSettlement, bound to a specific deployed contract.
+func NewFusionBtcSettlementFilterer(address common.Address, filterer bind.ContractFilterer) (*FusionBtcSettlementFilterer, error) {
+	contract, err := bindFusionBtcSettlement(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &FusionBtcSettlementFilterer{contract: contract}, nil
+}
+
 // bindFusionBtcSettlement binds a generic wrapper to an already deployed contract.
 func bindFusionBtcSettlement(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
-	parsed, err := abi.JSON(strings.NewReader(FusionBtcSettlementABI))
+	parsed, err := FusionBtcSettlementMetaData.GetAbi()
 	if err != nil {
 		return nil, err
 	}
-	return bind.NewBoundContract(address, parsed, caller, transactor, filterer), nil
+	return bind.NewBoundContract(address, *parsed, caller, transactor, filterer), nil
 }
 
-// CreateEscrow is a paid mutator transaction binding the contract method 0x...
-func (_FusionBtcSettlement *FusionBtcSettlementTransactor) CreateEscrow(opts *bind.TransactOpts, secretHash [32]byte, user common.Address, token common.Address, amount *big.Int, timelock *big.Int) (*types.Transaction, error) {
-	return _FusionBtcSettlement.contract.Transact(opts, "createEscrow", secretHash, user, token, amount, timelock)
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_FusionBtcSettlement *FusionBtcSettlementRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _FusionBtcSettlement.Contract.FusionBtcSettlementCaller.contract.Call(opts, result, method, params...)
 }
 
-// ClaimEscrow is a paid mutator transaction binding the contract method 0x...
-func (_FusionBtcSettlement *FusionBtcSettlementTransactor) ClaimEscrow(opts *bind.TransactOpts, secretHash [32]byte, secret [32]byte) (*types.Transaction, error) {
-	return _FusionBtcSettlement.contract.Transact(opts, "claimEscrow", secretHash, secret)
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_FusionBtcSettlement *FusionBtcSettlementRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.FusionBtcSettlementTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_FusionBtcSettlement *FusionBtcSettlementRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.FusionBtcSettlementTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_FusionBtcSettlement *FusionBtcSettlementCallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _FusionBtcSettlement.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_FusionBtcSettlement *FusionBtcSettlementTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_FusionBtcSettlement *FusionBtcSettlementTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.contract.Transact(opts, method, params...)
 }
 
-// GetEscrow is a free data retrieval call binding the contract method 0x...
+// Escrows is a free data retrieval call binding the contract method 0x2d83549c.
+//
+// Solidity: function escrows(bytes32 ) view returns(address user, address resolver, address token, uint256 amount, uint256 timelock, bool claimed, bool refunded)
+func (_FusionBtcSettlement *FusionBtcSettlementCaller) Escrows(opts *bind.CallOpts, arg0 [32]byte) (struct {
+	User     common.Address
+	Resolver common.Address
+	Token    common.Address
+	Amount   *big.Int
+	Timelock *big.Int
+	Claimed  bool
+	Refunded bool
+}, error) {
+	var out []interface{}
+	err := _FusionBtcSettlement.contract.Call(opts, &out, "escrows", arg0)
+
+	outstruct := new(struct {
+		User     common.Address
+		Resolver common.Address
+		Token    common.Address
+		Amount   *big.Int
+		Timelock *big.Int
+		Claimed  bool
+		Refunded bool
+	})
+	if err != nil {
+		return *outstruct, err
+	}
+
+	outstruct.User = *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+	outstruct.Resolver = *abi.ConvertType(out[1], new(common.Address)).(*common.Address)
+	outstruct.Token = *abi.ConvertType(out[2], new(common.Address)).(*common.Address)
+	outstruct.Amount = *abi.ConvertType(out[3], new(*big.Int)).(**big.Int)
+	outstruct.Timelock = *abi.ConvertType(out[4], new(*big.Int)).(**big.Int)
+	outstruct.Claimed = *abi.ConvertType(out[5], new(bool)).(*bool)
+	outstruct.Refunded = *abi.ConvertType(out[6], new(bool)).(*bool)
+
+	return *outstruct, err
+
+}
+
+// Escrows is a free data retrieval call binding the contract method 0x2d83549c.
+//
+// Solidity: function escrows(bytes32 ) view returns(address user, address resolver, address token, uint256 amount, uint256 timelock, bool claimed, bool refunded)
+func (_FusionBtcSettlement *FusionBtcSettlementSession) Escrows(arg0 [32]byte) (struct {
+	User     common.Address
+	Resolver common.Address
+	Token    common.Address
+	Amount   *big.Int
+	Timelock *big.Int
+	Claimed  bool
+	Refunded bool
+}, error) {
+	return _FusionBtcSettlement.Contract.Escrows(&_FusionBtcSettlement.CallOpts, arg0)
+}
+
+// Escrows is a free data retrieval call binding the contract method 0x2d83549c.
+//
+// Solidity: function escrows(bytes32 ) view returns(address user, address resolver, address token, uint256 amount, uint256 timelock, bool claimed, bool refunded)
+func (_FusionBtcSettlement *FusionBtcSettlementCallerSession) Escrows(arg0 [32]byte) (struct {
+	User     common.Address
+	Resolver common.Address
+	Token    common.Address
+	Amount   *big.Int
+	Timelock *big.Int
+	Claimed  bool
+	Refunded bool
+}, error) {
+	return _FusionBtcSettlement.Contract.Escrows(&_FusionBtcSettlement.CallOpts, arg0)
+}
+
+// GetEscrow is a free data retrieval call binding the contract method 0xf023b811.
+//
+// Solidity: function getEscrow(bytes32 secretHash) view returns(address user, address resolver, address token, uint256 amount, uint256 timelock, bool claimed, bool refunded)
 func (_FusionBtcSettlement *FusionBtcSettlementCaller) GetEscrow(opts *bind.CallOpts, secretHash [32]byte) (struct {
 	User     common.Address
 	Resolver common.Address
@@ -110,7 +265,7 @@ func (_FusionBtcSettlement *FusionBtcSettlementCaller) GetEscrow(opts *bind.Call
 	var out []interface{}
 	err := _FusionBtcSettlement.contract.Call(opts, &out, "getEscrow", secretHash)
 
-	outstruct := struct {
+	outstruct := new(struct {
 		User     common.Address
 		Resolver common.Address
 		Token    common.Address
@@ -118,7 +273,10 @@ func (_FusionBtcSettlement *FusionBtcSettlementCaller) GetEscrow(opts *bind.Call
 		Timelock *big.Int
 		Claimed  bool
 		Refunded bool
-	}{}
+	})
+	if err != nil {
+		return *outstruct, err
+	}
 
 	outstruct.User = *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
 	outstruct.Resolver = *abi.ConvertType(out[1], new(common.Address)).(*common.Address)
@@ -128,7 +286,593 @@ func (_FusionBtcSettlement *FusionBtcSettlementCaller) GetEscrow(opts *bind.Call
 	outstruct.Claimed = *abi.ConvertType(out[5], new(bool)).(*bool)
 	outstruct.Refunded = *abi.ConvertType(out[6], new(bool)).(*bool)
 
-	return outstruct, err
+	return *outstruct, err
+
+}
+
+// GetEscrow is a free data retrieval call binding the contract method 0xf023b811.
+//
+// Solidity: function getEscrow(bytes32 secretHash) view returns(address user, address resolver, address token, uint256 amount, uint256 timelock, bool claimed, bool refunded)
+func (_FusionBtcSettlement *FusionBtcSettlementSession) GetEscrow(secretHash [32]byte) (struct {
+	User     common.Address
+	Resolver common.Address
+	Token    common.Address
+	Amount   *big.Int
+	Timelock *big.Int
+	Claimed  bool
+	Refunded bool
+}, error) {
+	return _FusionBtcSettlement.Contract.GetEscrow(&_FusionBtcSettlement.CallOpts, secretHash)
+}
+
+// GetEscrow is a free data retrieval call binding the contract method 0xf023b811.
+//
+// Solidity: function getEscrow(bytes32 secretHash) view returns(address user, address resolver, address token, uint256 amount, uint256 timelock, bool claimed, bool refunded)
+func (_FusionBtcSettlement *FusionBtcSettlementCallerSession) GetEscrow(secretHash [32]byte) (struct {
+	User     common.Address
+	Resolver common.Address
+	Token    common.Address
+	Amount   *big.Int
+	Timelock *big.Int
+	Claimed  bool
+	Refunded bool
+}, error) {
+	return _FusionBtcSettlement.Contract.GetEscrow(&_FusionBtcSettlement.CallOpts, secretHash)
+}
+
+// ClaimEscrow is a paid mutator transaction binding the contract method 0xed57b33d.
+//
+// Solidity: function claimEscrow(bytes32 secretHash, bytes32 secret) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementTransactor) ClaimEscrow(opts *bind.TransactOpts, secretHash [32]byte, secret [32]byte) (*types.Transaction, error) {
+	return _FusionBtcSettlement.contract.Transact(opts, "claimEscrow", secretHash, secret)
+}
+
+// ClaimEscrow is a paid mutator transaction binding the contract method 0xed57b33d.
+//
+// Solidity: function claimEscrow(bytes32 secretHash, bytes32 secret) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementSession) ClaimEscrow(secretHash [32]byte, secret [32]byte) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.ClaimEscrow(&_FusionBtcSettlement.TransactOpts, secretHash, secret)
+}
+
+// ClaimEscrow is a paid mutator transaction binding the contract method 0xed57b33d.
+//
+// Solidity: function claimEscrow(bytes32 secretHash, bytes32 secret) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementTransactorSession) ClaimEscrow(secretHash [32]byte, secret [32]byte) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.ClaimEscrow(&_FusionBtcSettlement.TransactOpts, secretHash, secret)
+}
+
+// CreateEscrow is a paid mutator transaction binding the contract method 0xe0b70e7b.
+//
+// Solidity: function createEscrow(bytes32 secretHash, address user, address token, uint256 amount, uint256 timelock) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementTransactor) CreateEscrow(opts *bind.TransactOpts, secretHash [32]byte, user common.Address, token common.Address, amount *big.Int, timelock *big.Int) (*types.Transaction, error) {
+	return _FusionBtcSettlement.contract.Transact(opts, "createEscrow", secretHash, user, token, amount, timelock)
+}
+
+// CreateEscrow is a paid mutator transaction binding the contract method 0xe0b70e7b.
+//
+// Solidity: function createEscrow(bytes32 secretHash, address user, address token, uint256 amount, uint256 timelock) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementSession) CreateEscrow(secretHash [32]byte, user common.Address, token common.Address, amount *big.Int, timelock *big.Int) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.CreateEscrow(&_FusionBtcSettlement.TransactOpts, secretHash, user, token, amount, timelock)
+}
+
+// CreateEscrow is a paid mutator transaction binding the contract method 0xe0b70e7b.
+//
+// Solidity: function createEscrow(bytes32 secretHash, address user, address token, uint256 amount, uint256 timelock) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementTransactorSession) CreateEscrow(secretHash [32]byte, user common.Address, token common.Address, amount *big.Int, timelock *big.Int) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.CreateEscrow(&_FusionBtcSettlement.TransactOpts, secretHash, user, token, amount, timelock)
+}
+
+// RefundEscrow is a paid mutator transaction binding the contract method 0x47aed508.
+//
+// Solidity: function refundEscrow(bytes32 secretHash) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementTransactor) RefundEscrow(opts *bind.TransactOpts, secretHash [32]byte) (*types.Transaction, error) {
+	return _FusionBtcSettlement.contract.Transact(opts, "refundEscrow", secretHash)
+}
+
+// RefundEscrow is a paid mutator transaction binding the contract method 0x47aed508.
+//
+// Solidity: function refundEscrow(bytes32 secretHash) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementSession) RefundEscrow(secretHash [32]byte) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.RefundEscrow(&_FusionBtcSettlement.TransactOpts, secretHash)
+}
+
+// RefundEscrow is a paid mutator transaction binding the contract method 0x47aed508.
+//
+// Solidity: function refundEscrow(bytes32 secretHash) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementTransactorSession) RefundEscrow(secretHash [32]byte) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.RefundEscrow(&_FusionBtcSettlement.TransactOpts, secretHash)
+}
+
+// WhitelistResolver is a paid mutator transaction binding the contract method 0xd12a7b42.
+//
+// Solidity: function whitelistResolver(address resolver) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementTransactor) WhitelistResolver(opts *bind.TransactOpts, resolver common.Address) (*types.Transaction, error) {
+	return _FusionBtcSettlement.contract.Transact(opts, "whitelistResolver", resolver)
+}
+
+// WhitelistResolver is a paid mutator transaction binding the contract method 0xd12a7b42.
+//
+// Solidity: function whitelistResolver(address resolver) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementSession) WhitelistResolver(resolver common.Address) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.WhitelistResolver(&_FusionBtcSettlement.TransactOpts, resolver)
+}
+
+// WhitelistResolver is a paid mutator transaction binding the contract method 0xd12a7b42.
+//
+// Solidity: function whitelistResolver(address resolver) returns()
+func (_FusionBtcSettlement *FusionBtcSettlementTransactorSession) WhitelistResolver(resolver common.Address) (*types.Transaction, error) {
+	return _FusionBtcSettlement.Contract.WhitelistResolver(&_FusionBtcSettlement.TransactOpts, resolver)
+}
+
+// FusionBtcSettlementEscrowClaimedIterator is returned from FilterEscrowClaimed and is used to iterate over the raw logs and unpacked data for EscrowClaimed events raised by the FusionBtcSettlement contract.
+type FusionBtcSettlementEscrowClaimedIterator struct {
+	Event *FusionBtcSettlementEscrowClaimed // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *FusionBtcSettlementEscrowClaimedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(FusionBtcSettlementEscrowClaimed)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(FusionBtcSettlementEscrowClaimed)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *FusionBtcSettlementEscrowClaimedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *FusionBtcSettlementEscrowClaimedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// FusionBtcSettlementEscrowClaimed represents a EscrowClaimed event raised by the FusionBtcSettlement contract.
+type FusionBtcSettlementEscrowClaimed struct {
+	SecretHash [32]byte
+	Resolver   common.Address
+	Secret     [32]byte
+	Raw        types.Log // Blockchain specific contextual infos
+}
+
+// FilterEscrowClaimed is a free log retrieval operation binding the contract event 0xcdd8d72c62fd9e3fe9cdf7cd51ee1c1ffafc913784e2781e77829d9edc3a482d.
+//
+// Solidity: event EscrowClaimed(bytes32 indexed secretHash, address indexed resolver, bytes32 secret)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) FilterEscrowClaimed(opts *bind.FilterOpts, secretHash [][32]byte, resolver []common.Address) (*FusionBtcSettlementEscrowClaimedIterator, error) {
+
+	var secretHashRule []interface{}
+	for _, secretHashItem := range secretHash {
+		secretHashRule = append(secretHashRule, secretHashItem)
+	}
+	var resolverRule []interface{}
+	for _, resolverItem := range resolver {
+		resolverRule = append(resolverRule, resolverItem)
+	}
+
+	logs, sub, err := _FusionBtcSettlement.contract.FilterLogs(opts, "EscrowClaimed", secretHashRule, resolverRule)
+	if err != nil {
+		return nil, err
+	}
+	return &FusionBtcSettlementEscrowClaimedIterator{contract: _FusionBtcSettlement.contract, event: "EscrowClaimed", logs: logs, sub: sub}, nil
+}
+
+// WatchEscrowClaimed is a free log subscription operation binding the contract event 0xcdd8d72c62fd9e3fe9cdf7cd51ee1c1ffafc913784e2781e77829d9edc3a482d.
+//
+// Solidity: event EscrowClaimed(bytes32 indexed secretHash, address indexed resolver, bytes32 secret)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) WatchEscrowClaimed(opts *bind.WatchOpts, sink chan<- *FusionBtcSettlementEscrowClaimed, secretHash [][32]byte, resolver []common.Address) (event.Subscription, error) {
+
+	var secretHashRule []interface{}
+	for _, secretHashItem := range secretHash {
+		secretHashRule = append(secretHashRule, secretHashItem)
+	}
+	var resolverRule []interface{}
+	for _, resolverItem := range resolver {
+		resolverRule = append(resolverRule, resolverItem)
+	}
+
+	logs, sub, err := _FusionBtcSettlement.contract.WatchLogs(opts, "EscrowClaimed", secretHashRule, resolverRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(FusionBtcSettlementEscrowClaimed)
+				if err := _FusionBtcSettlement.contract.UnpackLog(event, "EscrowClaimed", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseEscrowClaimed is a log parse operation binding the contract event 0xcdd8d72c62fd9e3fe9cdf7cd51ee1c1ffafc913784e2781e77829d9edc3a482d.
+//
+// Solidity: event EscrowClaimed(bytes32 indexed secretHash, address indexed resolver, bytes32 secret)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) ParseEscrowClaimed(log types.Log) (*FusionBtcSettlementEscrowClaimed, error) {
+	event := new(FusionBtcSettlementEscrowClaimed)
+	if err := _FusionBtcSettlement.contract.UnpackLog(event, "EscrowClaimed", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// FusionBtcSettlementEscrowCreatedIterator is returned from FilterEscrowCreated and is used to iterate over the raw logs and unpacked data for EscrowCreated events raised by the FusionBtcSettlement contract.
+type FusionBtcSettlementEscrowCreatedIterator struct {
+	Event *FusionBtcSettlementEscrowCreated // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *FusionBtcSettlementEscrowCreatedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(FusionBtcSettlementEscrowCreated)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(FusionBtcSettlementEscrowCreated)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *FusionBtcSettlementEscrowCreatedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *FusionBtcSettlementEscrowCreatedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// FusionBtcSettlementEscrowCreated represents a EscrowCreated event raised by the FusionBtcSettlement contract.
+type FusionBtcSettlementEscrowCreated struct {
+	SecretHash [32]byte
+	User       common.Address
+	Token      common.Address
+	Amount     *big.Int
+	Timelock   *big.Int
+	Raw        types.Log // Blockchain specific contextual infos
+}
+
+// FilterEscrowCreated is a free log retrieval operation binding the contract event 0x8233ac661360194ba2d16fa02d354d092808769225032c46dc5787f33af21cbe.
+//
+// Solidity: event EscrowCreated(bytes32 indexed secretHash, address indexed user, address indexed token, uint256 amount, uint256 timelock)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) FilterEscrowCreated(opts *bind.FilterOpts, secretHash [][32]byte, user []common.Address, token []common.Address) (*FusionBtcSettlementEscrowCreatedIterator, error) {
+
+	var secretHashRule []interface{}
+	for _, secretHashItem := range secretHash {
+		secretHashRule = append(secretHashRule, secretHashItem)
+	}
+	var userRule []interface{}
+	for _, userItem := range user {
+		userRule = append(userRule, userItem)
+	}
+	var tokenRule []interface{}
+	for _, tokenItem := range token {
+		tokenRule = append(tokenRule, tokenItem)
+	}
+
+	logs, sub, err := _FusionBtcSettlement.contract.FilterLogs(opts, "EscrowCreated", secretHashRule, userRule, tokenRule)
+	if err != nil {
+		return nil, err
+	}
+	return &FusionBtcSettlementEscrowCreatedIterator{contract: _FusionBtcSettlement.contract, event: "EscrowCreated", logs: logs, sub: sub}, nil
+}
+
+// WatchEscrowCreated is a free log subscription operation binding the contract event 0x8233ac661360194ba2d16fa02d354d092808769225032c46dc5787f33af21cbe.
+//
+// Solidity: event EscrowCreated(bytes32 indexed secretHash, address indexed user, address indexed token, uint256 amount, uint256 timelock)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) WatchEscrowCreated(opts *bind.WatchOpts, sink chan<- *FusionBtcSettlementEscrowCreated, secretHash [][32]byte, user []common.Address, token []common.Address) (event.Subscription, error) {
+
+	var secretHashRule []interface{}
+	for _, secretHashItem := range secretHash {
+		secretHashRule = append(secretHashRule, secretHashItem)
+	}
+	var userRule []interface{}
+	for _, userItem := range user {
+		userRule = append(userRule, userItem)
+	}
+	var tokenRule []interface{}
+	for _, tokenItem := range token {
+		tokenRule = append(tokenRule, tokenItem)
+	}
+
+	logs, sub, err := _FusionBtcSettlement.contract.WatchLogs(opts, "EscrowCreated", secretHashRule, userRule, tokenRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(FusionBtcSettlementEscrowCreated)
+				if err := _FusionBtcSettlement.contract.UnpackLog(event, "EscrowCreated", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseEscrowCreated is a log parse operation binding the contract event 0x8233ac661360194ba2d16fa02d354d092808769225032c46dc5787f33af21cbe.
+//
+// Solidity: event EscrowCreated(bytes32 indexed secretHash, address indexed user, address indexed token, uint256 amount, uint256 timelock)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) ParseEscrowCreated(log types.Log) (*FusionBtcSettlementEscrowCreated, error) {
+	event := new(FusionBtcSettlementEscrowCreated)
+	if err := _FusionBtcSettlement.contract.UnpackLog(event, "EscrowCreated", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
+
+// FusionBtcSettlementEscrowRefundedIterator is returned from FilterEscrowRefunded and is used to iterate over the raw logs and unpacked data for EscrowRefunded events raised by the FusionBtcSettlement contract.
+type FusionBtcSettlementEscrowRefundedIterator struct {
+	Event *FusionBtcSettlementEscrowRefunded // Event containing the contract specifics and raw log
+
+	contract *bind.BoundContract // Generic contract to use for unpacking event data
+	event    string              // Event name to use for unpacking event data
+
+	logs chan types.Log        // Log channel receiving the found contract events
+	sub  ethereum.Subscription // Subscription for errors, completion and termination
+	done bool                  // Whether the subscription completed delivering logs
+	fail error                 // Occurred error to stop iteration
+}
+
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *FusionBtcSettlementEscrowRefundedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(FusionBtcSettlementEscrowRefunded)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(FusionBtcSettlementEscrowRefunded)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *FusionBtcSettlementEscrowRefundedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *FusionBtcSettlementEscrowRefundedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
+// FusionBtcSettlementEscrowRefunded represents a EscrowRefunded event raised by the FusionBtcSettlement contract.
+type FusionBtcSettlementEscrowRefunded struct {
+	SecretHash [32]byte
+	User       common.Address
+	Raw        types.Log // Blockchain specific contextual infos
+}
+
+// FilterEscrowRefunded is a free log retrieval operation binding the contract event 0x026c3e65e0c7f7ae234275c57dd6860821de4fff9cf22bf1c53c7ed2314588a6.
+//
+// Solidity: event EscrowRefunded(bytes32 indexed secretHash, address indexed user)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) FilterEscrowRefunded(opts *bind.FilterOpts, secretHash [][32]byte, user []common.Address) (*FusionBtcSettlementEscrowRefundedIterator, error) {
+
+	var secretHashRule []interface{}
+	for _, secretHashItem := range secretHash {
+		secretHashRule = append(secretHashRule, secretHashItem)
+	}
+	var userRule []interface{}
+	for _, userItem := range user {
+		userRule = append(userRule, userItem)
+	}
+
+	logs, sub, err := _FusionBtcSettlement.contract.FilterLogs(opts, "EscrowRefunded", secretHashRule, userRule)
+	if err != nil {
+		return nil, err
+	}
+	return &FusionBtcSettlementEscrowRefundedIterator{contract: _FusionBtcSettlement.contract, event: "EscrowRefunded", logs: logs, sub: sub}, nil
+}
+
+// WatchEscrowRefunded is a free log subscription operation binding the contract event 0x026c3e65e0c7f7ae234275c57dd6860821de4fff9cf22bf1c53c7ed2314588a6.
+//
+// Solidity: event EscrowRefunded(bytes32 indexed secretHash, address indexed user)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) WatchEscrowRefunded(opts *bind.WatchOpts, sink chan<- *FusionBtcSettlementEscrowRefunded, secretHash [][32]byte, user []common.Address) (event.Subscription, error) {
+
+	var secretHashRule []interface{}
+	for _, secretHashItem := range secretHash {
+		secretHashRule = append(secretHashRule, secretHashItem)
+	}
+	var userRule []interface{}
+	for _, userItem := range user {
+		userRule = append(userRule, userItem)
+	}
+
+	logs, sub, err := _FusionBtcSettlement.contract.WatchLogs(opts, "EscrowRefunded", secretHashRule, userRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(FusionBtcSettlementEscrowRefunded)
+				if err := _FusionBtcSettlement.contract.UnpackLog(event, "EscrowRefunded", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseEscrowRefunded is a log parse operation binding the contract event 0x026c3e65e0c7f7ae234275c57dd6860821de4fff9cf22bf1c53c7ed2314588a6.
+//
+// Solidity: event EscrowRefunded(bytes32 indexed secretHash, address indexed user)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) ParseEscrowRefunded(log types.Log) (*FusionBtcSettlementEscrowRefunded, error) {
+	event := new(FusionBtcSettlementEscrowRefunded)
+	if err := _FusionBtcSettlement.contract.UnpackLog(event, "EscrowRefunded", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
 }
 
 // FusionBtcSettlementSecretRevealedIterator is returned from FilterSecretRevealed and is used to iterate over the raw logs and unpacked data for SecretRevealed events raised by the FusionBtcSettlement contract.
@@ -144,6 +888,60 @@ type FusionBtcSettlementSecretRevealedIterator struct {
 	fail error                 // Occurred error to stop iteration
 }
 
+// Next advances the iterator to the subsequent event, returning whether there
+// are any more events found. In case of a retrieval or parsing error, false is
+// returned and Error() can be queried for the exact failure.
+func (it *FusionBtcSettlementSecretRevealedIterator) Next() bool {
+	// If the iterator failed, stop iterating
+	if it.fail != nil {
+		return false
+	}
+	// If the iterator completed, deliver directly whatever's available
+	if it.done {
+		select {
+		case log := <-it.logs:
+			it.Event = new(FusionBtcSettlementSecretRevealed)
+			if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+				it.fail = err
+				return false
+			}
+			it.Event.Raw = log
+			return true
+
+		default:
+			return false
+		}
+	}
+	// Iterator still in progress, wait for either a data or an error event
+	select {
+	case log := <-it.logs:
+		it.Event = new(FusionBtcSettlementSecretRevealed)
+		if err := it.contract.UnpackLog(it.Event, it.event, log); err != nil {
+			it.fail = err
+			return false
+		}
+		it.Event.Raw = log
+		return true
+
+	case err := <-it.sub.Err():
+		it.done = true
+		it.fail = err
+		return it.Next()
+	}
+}
+
+// Error returns any retrieval or parsing error occurred during filtering.
+func (it *FusionBtcSettlementSecretRevealedIterator) Error() error {
+	return it.fail
+}
+
+// Close terminates the iteration process, releasing any pending underlying
+// resources.
+func (it *FusionBtcSettlementSecretRevealedIterator) Close() error {
+	it.sub.Unsubscribe()
+	return nil
+}
+
 // FusionBtcSettlementSecretRevealed represents a SecretRevealed event raised by the FusionBtcSettlement contract.
 type FusionBtcSettlementSecretRevealed struct {
 	SecretHash [32]byte
@@ -153,13 +951,16 @@ type FusionBtcSettlementSecretRevealed struct {
 	Raw        types.Log // Blockchain specific contextual infos
 }
 
-// FilterSecretRevealed is a free log retrieval operation binding the contract event 0x...
+// FilterSecretRevealed is a free log retrieval operation binding the contract event 0xa01817c811ad55ec57c881aad2dfe2cd9b3b7b7dd5e6848180efff278b5c8c34.
+//
+// Solidity: event SecretRevealed(bytes32 indexed secretHash, bytes32 secret, address indexed resolver, address indexed user)
 func (_FusionBtcSettlement *FusionBtcSettlementFilterer) FilterSecretRevealed(opts *bind.FilterOpts, secretHash [][32]byte, resolver []common.Address, user []common.Address) (*FusionBtcSettlementSecretRevealedIterator, error) {
 
 	var secretHashRule []interface{}
 	for _, secretHashItem := range secretHash {
 		secretHashRule = append(secretHashRule, secretHashItem)
 	}
+
 	var resolverRule []interface{}
 	for _, resolverItem := range resolver {
 		resolverRule = append(resolverRule, resolverItem)
@@ -175,3 +976,66 @@ func (_FusionBtcSettlement *FusionBtcSettlementFilterer) FilterSecretRevealed(op
 	}
 	return &FusionBtcSettlementSecretRevealedIterator{contract: _FusionBtcSettlement.contract, event: "SecretRevealed", logs: logs, sub: sub}, nil
 }
+
+// WatchSecretRevealed is a free log subscription operation binding the contract event 0xa01817c811ad55ec57c881aad2dfe2cd9b3b7b7dd5e6848180efff278b5c8c34.
+//
+// Solidity: event SecretRevealed(bytes32 indexed secretHash, bytes32 secret, address indexed resolver, address indexed user)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) WatchSecretRevealed(opts *bind.WatchOpts, sink chan<- *FusionBtcSettlementSecretRevealed, secretHash [][32]byte, resolver []common.Address, user []common.Address) (event.Subscription, error) {
+
+	var secretHashRule []interface{}
+	for _, secretHashItem := range secretHash {
+		secretHashRule = append(secretHashRule, secretHashItem)
+	}
+
+	var resolverRule []interface{}
+	for _, resolverItem := range resolver {
+		resolverRule = append(resolverRule, resolverItem)
+	}
+	var userRule []interface{}
+	for _, userItem := range user {
+		userRule = append(userRule, userItem)
+	}
+
+	logs, sub, err := _FusionBtcSettlement.contract.WatchLogs(opts, "SecretRevealed", secretHashRule, resolverRule, userRule)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case log := <-logs:
+				// New log arrived, parse the event and forward to the user
+				event := new(FusionBtcSettlementSecretRevealed)
+				if err := _FusionBtcSettlement.contract.UnpackLog(event, "SecretRevealed", log); err != nil {
+					return err
+				}
+				event.Raw = log
+
+				select {
+				case sink <- event:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// ParseSecretRevealed is a log parse operation binding the contract event 0xa01817c811ad55ec57c881aad2dfe2cd9b3b7b7dd5e6848180efff278b5c8c34.
+//
+// Solidity: event SecretRevealed(bytes32 indexed secretHash, bytes32 secret, address indexed resolver, address indexed user)
+func (_FusionBtcSettlement *FusionBtcSettlementFilterer) ParseSecretRevealed(log types.Log) (*FusionBtcSettlementSecretRevealed, error) {
+	event := new(FusionBtcSettlementSecretRevealed)
+	if err := _FusionBtcSettlement.contract.UnpackLog(event, "SecretRevealed", log); err != nil {
+		return nil, err
+	}
+	event.Raw = log
+	return event, nil
+}
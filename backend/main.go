@@ -23,11 +23,18 @@ a production-grade application.
 package main
 
 import (
+	"context"
+	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/btcsuite/btcd/btcec/v2"
+
 	"fusion-btc-resolver/api"
 	"fusion-btc-resolver/config"
 	"fusion-btc-resolver/orchestrator"
@@ -50,18 +57,30 @@ func main() {
 	}
 	log.Println("[INIT] Configuration loaded successfully.")
 
+	// Keys come from the encrypted vault at VAULT_PATH when one is configured.
+	log.Println("[INIT] Loading keys...")
+	keys, err := loadKeys(cfg)
+	if err != nil {
+		log.Fatalf("FATAL: Could not load keys: %v", err)
+	}
+
 	// =========================================================================
 	// STEP 2: INITIALIZE SERVICES (To be implemented in services/*.go)
 	// =========================================================================
 	// Here we will initialize the clients that communicate with the blockchains.
-	// The btc_htlc_service will connect to our Bitcoin Core node, and the
-	// evm_service will connect to an EVM-compatible RPC endpoint.
+	// BTC_BACKEND picks whether the BTC side talks to our Bitcoin Core node or
+	// to an Esplora API, and the evm_service will connect to an EVM-compatible
+	// RPC endpoint.
+	// Everything past this point only sees the BtcChain and EvmChain
+	// interfaces, so an alternate backend only needs to be swapped in here.
 	log.Println("[INIT] Initializing blockchain services...")
-	btcService, err := services.NewBtcHtlcService(&cfg.Bitcoin)
+	btcService, err := services.NewBtcBackend(&cfg.Bitcoin, keys.btcWallet)
 	if err != nil {
 		log.Fatalf("FATAL: Could not initialize Bitcoin HTLC Service: %v", err)
 	}
-	evmService, err := services.NewEvmService(&cfg.EVM)
+	var btcChain services.BtcChain = btcService
+	var evmChain services.EvmChain
+	evmChain, err = services.NewEvmService(&cfg.EVM, keys.evm)
 	if err != nil {
 		log.Fatalf("FATAL: Could not initialize EVM Service: %v", err)
 	}
@@ -73,7 +92,41 @@ func main() {
 	// The orchestrator is the core of our application. It contains the business
 	// logic to manage the swap lifecycle, coordinating between the BTC and EVM services.
 	log.Println("[INIT] Initializing swap orchestrator...")
-	swapOrchestrator := orchestrator.NewSwapOrchestrator(btcService, evmService)
+	if err := orchestrator.CheckPaymentPolicies(&cfg.Swap); err != nil {
+		log.Fatalf("FATAL: Invalid swap configuration: %v", err)
+	}
+	swapStore, err := orchestrator.NewBoltSwapStore(cfg.Store.Path)
+	if err != nil {
+		log.Fatalf("FATAL: Could not open swap store: %v", err)
+	}
+	defer swapStore.Close()
+	// Swap secrets are encrypted at rest under a key derived from the secret seed.
+	if err := swapStore.SealSecrets(keys.secrets.StoreKey()); err != nil {
+		log.Fatalf("FATAL: Could not open swap store: %v", err)
+	}
+
+	swapOrchestrator := orchestrator.NewSwapOrchestrator(btcChain, evmChain, keys.claimKeys, keys.secrets, swapStore, &cfg.Swap)
+
+	// Key indexes, and with them secrets and claim keys, must never repeat, so
+	// the store has to know the secret seed. After losing the store, recovery
+	// rebuilds what it can from the seed and the EVM chain.
+	if cfg.Secrets.Recover {
+		if err := swapOrchestrator.RecoverSwapsFromSeed(context.Background(), cfg.Secrets.RecoveryGap); err != nil {
+			log.Fatalf("FATAL: Secret recovery failed: %v", err)
+		}
+	}
+	if err := swapOrchestrator.CheckSecretSeed(); err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+
+	// Pick up every swap that was in flight when the service last stopped,
+	// before any new requests can reach the orchestrator.
+	if err := swapOrchestrator.ResumeSwaps(); err != nil {
+		log.Fatalf("FATAL: Could not resume persisted swaps: %v", err)
+	}
+	swapOrchestrator.StartEscrowRefundJob()
+	swapOrchestrator.StartReorgWatchJob()
+	btcService.SetTxReplacedHandler(swapOrchestrator.RecordTxReplacement)
 	log.Println("[INIT] Swap orchestrator initialized.")
 
 	// =========================================================================
@@ -124,6 +177,8 @@ func main() {
 	mux.HandleFunc("/quote", apiHandlers.GetQuote)
 	mux.HandleFunc("/swap/initiate", apiHandlers.InitiateSwap)
 	mux.HandleFunc("/swap/status/", apiHandlers.GetSwapStatus)
+	mux.HandleFunc("/swap/refund/", apiHandlers.SubmitRefund)
+	mux.HandleFunc("/swap/refund-psbt/", apiHandlers.GetRefundPsbt)
 
 	server := &http.Server{
 		Addr:         ":8080", // Standard port for backend services
@@ -132,8 +187,114 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
-	log.Println("--- [RESOLVER_BACKEND] Server starting on http://localhost:8080 ---")
-	if err := server.ListenAndServe(); err != nil {
+	// =========================================================================
+	// STEP 6: SERVE UNTIL SIGTERM, THEN SHUT DOWN GRACEFULLY
+	// =========================================================================
+	// On SIGINT/SIGTERM the orchestrator stops accepting swaps, in-flight HTTP
+	// requests are drained, and every swap lifecycle is cancelled and waited
+	// for, so each swap is left at a durable checkpoint before the store closes.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Stuck BTC broadcasts are fee-bumped until shutdown. The tracker records
+	// replacements through the orchestrator, so it is stopped before the store closes.
+	trackerDone := make(chan struct{})
+	go func() {
+		btcService.RunTxTracker(ctx)
+		close(trackerDone)
+	}()
+
+	// Deposits are detected for every swap at once. Monitors waiting on the
+	// watcher are cancelled with their lifecycles, so it only has to outlive them.
+	depositsDone := make(chan struct{})
+	go func() {
+		btcService.RunDepositWatcher(ctx)
+		close(depositsDone)
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Println("--- [RESOLVER_BACKEND] Server starting on http://localhost:8080 ---")
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("FATAL: Could not start server: %v", err)
+	case <-ctx.Done():
+	}
+	stop()
+	log.Println("[SHUTDOWN] Signal received, shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// The orchestrator is stopped alongside the HTTP drain. It refuses new swaps
+	// from that point on, so requests still in flight cannot start a lifecycle
+	// that would outlive the shutdown.
+	orchestratorDone := make(chan error, 1)
+	go func() { orchestratorDone <- swapOrchestrator.Shutdown(shutdownCtx) }()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("[SHUTDOWN] ERROR: HTTP server did not drain cleanly: %v", err)
+	}
+	if err := <-orchestratorDone; err != nil {
+		log.Printf("[SHUTDOWN] ERROR: %v", err)
+	}
+	<-trackerDone
+	<-depositsDone
+	log.Println("--- [RESOLVER_BACKEND] Shutdown complete ---")
+}
+
+// resolverKeys are the keys the services and orchestrator are built with.
+type resolverKeys struct {
+	evm       *ecdsa.PrivateKey // nil to use EVM_PRIVATE_KEY
+	btcWallet *btcec.PrivateKey // nil to use BTC_WALLET_KEY
+	claimKeys *services.ClaimKeyring
+	secrets   *services.SecretSeed
+}
+
+// loadKeys unlocks the vault at VAULT_PATH and takes every key from it, or
+// without a vault, loads the claim keys and secret seed from their own
+// settings. The vault's raw key material is wiped before returning.
+func loadKeys(cfg *config.Config) (*resolverKeys, error) {
+	net, err := services.NetParamsForNetwork(cfg.Bitcoin.Network)
+	if err != nil {
+		return nil, err
+	}
+	keys := &resolverKeys{}
+	if cfg.Vault.Path == "" {
+		if keys.claimKeys, err = services.NewClaimKeyring(&cfg.Bitcoin, net); err != nil {
+			return nil, err
+		}
+		if keys.secrets, err = services.LoadSecretSeed(cfg.Secrets.SeedPath, cfg.Secrets.Passphrase); err != nil {
+			return nil, err
+		}
+		return keys, nil
+	}
+
+	passphrase, err := services.ReadVaultPassphrase(cfg.Vault.PassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := services.OpenVault(cfg.Vault.Path, passphrase, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer vault.Wipe()
+	if cfg.EVM.PrivateKey != "" || cfg.Bitcoin.ClaimKey != "" || cfg.Bitcoin.ClaimSeed != "" || cfg.Bitcoin.WalletKey != "" {
+		log.Println("[INIT] WARNING: Plaintext keys are still configured. The vault's keys are used; remove them from the environment.")
+	}
+
+	keys.btcWallet = vault.BtcWalletKey()
+	if keys.evm, err = vault.EvmKey(); err != nil {
+		return nil, err
+	}
+	if keys.claimKeys, err = vault.ClaimKeyring(net); err != nil {
+		return nil, err
+	}
+	if keys.secrets, err = vault.SecretSeed(); err != nil {
+		return nil, err
 	}
+	return keys, nil
 }
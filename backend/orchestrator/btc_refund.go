@@ -0,0 +1,311 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/services"
+)
+
+// The HTLC's timeout branch is guarded by the user's refund key, so the
+// resolver can never produce the refund signature itself. What it can do is
+// make sure a refund actually happens: once the EVM leg fails, or an
+// underpaid deposit is refused, the swap is parked in REFUND_PENDING, the
+// user-signed refund is accepted through the API at any time, and the
+// lifecycle broadcasts it as soon as the CLTV locktime has passed,
+// rebroadcasting until it confirms.
+
+// scheduleBtcRefund parks a swap whose EVM leg failed until its BTC can be refunded.
+func (o *SwapOrchestrator) scheduleBtcRefund(state *SwapState, cause error) error {
+	log.Printf("[LIFECYCLE-%s] EVM leg failed, scheduling BTC refund after block %d: %v", state.ID, state.BtcLockTime, cause)
+	return o.transition(state, localcommon.StatusRefundPending, cause.Error(), "", func(s *SwapState) {
+		s.LastError = cause.Error()
+	})
+}
+
+// SubmitSignedRefund stores a user-signed refund transaction for a swap that
+// is or may still become due for a refund. It is broadcast once the swap is
+// in REFUND_PENDING and the HTLC timelock expires.
+func (o *SwapOrchestrator) SubmitSignedRefund(swapID string, req *localcommon.RefundRequest) error {
+	tx, err := decodeRawTx(req.SignedRefundTx)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	state, ok := o.ActiveSwaps[swapID]
+	var terms SwapState
+	if ok {
+		terms = SwapState{
+			ID:              state.ID,
+			Status:          state.Status,
+			BtcDeposits:     append([]DepositUtxo(nil), state.BtcDeposits...),
+			BtcLockTime:     state.BtcLockTime,
+			BtcTimelockType: state.BtcTimelockType,
+			BtcCsvDelay:     state.BtcCsvDelay,
+		}
+	}
+	o.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("swap with ID %s not found", swapID)
+	}
+	if !canRefund(terms.Status) {
+		return fmt.Errorf("swap %s is %s and can no longer be refunded", swapID, terms.Status)
+	}
+
+	if err := validateRefundTx(&terms, tx); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// The deposit or the lifecycle may have moved on while the refund was
+	// checked, in which case it was checked against stale terms.
+	if state.Status != terms.Status || len(state.BtcDeposits) != len(terms.BtcDeposits) || state.BtcLockTime != terms.BtcLockTime {
+		return fmt.Errorf("swap %s changed while its refund was checked, please resubmit", swapID)
+	}
+	state.SignedRefundTx = req.SignedRefundTx
+	state.UpdatedAt = time.Now()
+	if err := o.Store.SaveSwap(state); err != nil {
+		return fmt.Errorf("failed to persist swap %s: %v", state.ID, err)
+	}
+	return nil
+}
+
+// BuildRefundPsbt builds an unsigned PSBT refunding a swap's deposit to an
+// address of the user's choosing. The user signs it with their own wallet and
+// can broadcast it once the timelock expires, whether or not the resolver is
+// still around, or hand it back through SubmitSignedRefund.
+//
+// The deposit is looked up on-chain rather than taken from the swap, so that
+// payments the lifecycle never recorded, like those made after the swap
+// EXPIRED, are refunded too.
+func (o *SwapOrchestrator) BuildRefundPsbt(ctx context.Context, swapID string, req *localcommon.RefundPsbtRequest) (*localcommon.RefundPsbtResponse, error) {
+	refundAddress, err := services.DecodeAddressForNet(req.RefundAddress, o.BtcService.NetParams())
+	if err != nil {
+		return nil, fmt.Errorf("%w: refund address: %v", ErrInvalidRefundRequest, err)
+	}
+	if req.FeeRate < 0 {
+		return nil, fmt.Errorf("%w: negative fee rate %d", ErrInvalidRefundRequest, req.FeeRate)
+	}
+
+	o.mu.Lock()
+	state, ok := o.ActiveSwaps[swapID]
+	var depositAddress string
+	var htlcScript []byte
+	var addrType localcommon.HtlcAddressType
+	var lockTime int64
+	if ok {
+		depositAddress = state.BtcDepositAddress
+		htlcScript, addrType, lockTime = state.BtcHtlcScript, state.BtcAddressType, state.BtcLockTime
+	}
+	o.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSwapNotFound, swapID)
+	}
+
+	htlcAddress, err := services.DecodeAddressForNet(depositAddress, o.BtcService.NetParams())
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTLC deposit address %s: %v", depositAddress, err)
+	}
+	utxos, err := o.BtcService.ListHtlcUtxos(ctx, htlcAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the HTLC deposit: %v", err)
+	}
+	var fundingTxHashes []*chainhash.Hash
+	seen := make(map[chainhash.Hash]bool)
+	for _, utxo := range utxos {
+		if txHash := utxo.OutPoint.Hash; !seen[txHash] {
+			seen[txHash] = true
+			fundingTxHashes = append(fundingTxHashes, &txHash)
+		}
+	}
+	if len(fundingTxHashes) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoDeposit, swapID)
+	}
+
+	packet, err := o.BtcService.BuildRefundPsbt(ctx, fundingTxHashes, htlcScript, addrType, refundAddress, lockTime, services.FeeRatePerVByte(req.FeeRate))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build refund PSBT: %v", err)
+	}
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode refund PSBT: %v", err)
+	}
+	fee, err := packet.GetTxFee()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute refund PSBT fee: %v", err)
+	}
+
+	log.Printf("[LIFECYCLE-%s] Built refund PSBT for %d deposit outputs to %s", swapID, len(packet.Inputs), req.RefundAddress)
+	return &localcommon.RefundPsbtResponse{
+		Psbt:         encoded,
+		Fee:          fmt.Sprint(int64(fee)),
+		Inputs:       len(packet.Inputs),
+		RefundHeight: lockTime,
+	}, nil
+}
+
+// validateRefundTx checks that a refund transaction spends every output of
+// this swap's HTLC deposit through the timeout branch. The caller must hold
+// o.mu or own the state.
+func validateRefundTx(state *SwapState, tx *wire.MsgTx) error {
+	if len(state.BtcDeposits) == 0 {
+		return fmt.Errorf("swap %s has no confirmed BTC deposit to refund", state.ID)
+	}
+	deposits := make(map[wire.OutPoint]bool, len(state.BtcDeposits))
+	for _, utxo := range state.BtcDeposits {
+		fundingHash, err := chainhash.NewHashFromStr(utxo.TxHash)
+		if err != nil {
+			return fmt.Errorf("swap %s has an invalid funding tx hash: %v", state.ID, err)
+		}
+		deposits[*wire.NewOutPoint(fundingHash, utxo.Vout)] = true
+	}
+
+	isCsv := state.BtcTimelockType == localcommon.HtlcCSV
+	spent := make(map[wire.OutPoint]bool, len(deposits))
+	for _, in := range tx.TxIn {
+		if !deposits[in.PreviousOutPoint] {
+			continue
+		}
+		spent[in.PreviousOutPoint] = true
+		if isCsv {
+			// CSV needs a version 2 tx and a BIP68 block delay of at least the script's.
+			if tx.Version < 2 || in.Sequence&wire.SequenceLockTimeDisabled != 0 ||
+				in.Sequence&wire.SequenceLockTimeIsSeconds != 0 ||
+				int64(in.Sequence&wire.SequenceLockTimeMask) < state.BtcCsvDelay {
+				return fmt.Errorf("refund input sequence %#x does not satisfy the %d block CSV delay", in.Sequence, state.BtcCsvDelay)
+			}
+			continue
+		}
+		// CLTV requires a non-final sequence for the locktime to be enforced.
+		if in.Sequence == wire.MaxTxInSequenceNum {
+			return fmt.Errorf("refund input must not use a final sequence number")
+		}
+	}
+	for outpoint := range deposits {
+		if !spent[outpoint] {
+			return fmt.Errorf("refund tx does not spend the swap deposit %s", outpoint)
+		}
+	}
+	if isCsv {
+		return nil
+	}
+	// The HTLC's CLTV is a block height, which a timestamp locktime can never
+	// satisfy, however large.
+	if tx.LockTime >= txscript.LockTimeThreshold {
+		return fmt.Errorf("refund tx locktime %d is a timestamp, but the HTLC locktime is block %d", tx.LockTime, state.BtcLockTime)
+	}
+	if int64(tx.LockTime) < state.BtcLockTime {
+		return fmt.Errorf("refund tx locktime %d is below the HTLC locktime %d", tx.LockTime, state.BtcLockTime)
+	}
+	return nil
+}
+
+// === Refund: Return the user's BTC once the HTLC timelock expires ===
+func (o *SwapOrchestrator) refundBtc(ctx context.Context, state *SwapState) error {
+	ticker := time.NewTicker(o.cfg.RefundRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		refunded, err := o.attemptBtcRefund(ctx, state)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			// Refund failures are never final: record them and retry.
+			log.Printf("[LIFECYCLE-%s] Refund attempt failed, will retry: %v", state.ID, err)
+			if err := o.checkpoint(state, func(s *SwapState) { s.LastError = err.Error() }); err != nil {
+				return err
+			}
+		}
+		if refunded {
+			return o.transition(state, localcommon.StatusRefunded, "BTC refund confirmed", state.RefundTxHash, nil)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// attemptBtcRefund makes one pass over a pending refund. It reports true once
+// the refund transaction has confirmed.
+func (o *SwapOrchestrator) attemptBtcRefund(ctx context.Context, state *SwapState) (bool, error) {
+	if state.RefundTxHash != "" {
+		txHash, err := chainhash.NewHashFromStr(state.RefundTxHash)
+		if err != nil {
+			return false, err
+		}
+		confirmations, err := o.BtcService.GetConfirmations(ctx, txHash)
+		if err == nil && confirmations > 0 {
+			return true, nil
+		}
+		if err == nil {
+			log.Printf("[LIFECYCLE-%s] Refund %s is in the mempool, waiting for confirmation", state.ID, txHash)
+			return false, nil
+		}
+		// The node no longer knows the refund, so fall through and rebroadcast it.
+		log.Printf("[LIFECYCLE-%s] Refund %s not found, rebroadcasting: %v", state.ID, txHash, err)
+	}
+
+	height, err := o.BtcService.CurrentHeight(ctx)
+	if err != nil {
+		return false, err
+	}
+	if height < state.BtcLockTime {
+		log.Printf("[LIFECYCLE-%s] Refund locked until block %d (tip %d)", state.ID, state.BtcLockTime, height)
+		return false, nil
+	}
+	if state.SignedRefundTx == "" {
+		log.Printf("[LIFECYCLE-%s] HTLC timelock expired, waiting for the user's signed refund", state.ID)
+		return false, nil
+	}
+
+	tx, err := decodeRawTx(state.SignedRefundTx)
+	if err != nil {
+		return false, err
+	}
+	txHash, broadcastErr := o.BtcService.BroadcastTransaction(ctx, tx)
+
+	err = o.checkpoint(state, func(s *SwapState) {
+		s.RefundAttempts++
+		s.LastRefundAttempt = time.Now()
+		if broadcastErr == nil {
+			s.RefundTxHash = txHash.String()
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	if broadcastErr != nil {
+		return false, broadcastErr
+	}
+
+	log.Printf("[LIFECYCLE-%s] Refund broadcast (attempt %d). TxHash: %s", state.ID, state.RefundAttempts, txHash)
+	return false, nil
+}
+
+// decodeRawTx parses a hex-encoded serialized transaction.
+func decodeRawTx(rawHex string) (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction hex: %v", err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	return tx, nil
+}
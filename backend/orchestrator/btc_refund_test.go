@@ -0,0 +1,169 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
+	"fusion-btc-resolver/services"
+)
+
+func refundTxHex(t *testing.T, prev wire.OutPoint, sequence, lockTime uint32) string {
+	t.Helper()
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: prev, Sequence: sequence})
+	tx.AddTxOut(wire.NewTxOut(9000, []byte{0x00, 0x14}))
+	tx.LockTime = lockTime
+
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatalf("failed to serialize tx: %v", err)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+// TestSubmitSignedRefund checks that only refunds spending the swap's deposit
+// through the timelocked branch are accepted.
+func TestSubmitSignedRefund(t *testing.T) {
+	o := NewSwapOrchestrator(nil, nil, nil, nil, newTestStore(t), &config.SwapConfig{})
+	fundingHash := chainhash.DoubleHashH([]byte("funding"))
+	state := &SwapState{
+		ID:          "swap-refund",
+		Status:      localcommon.StatusRefundPending,
+		BtcLockTime: 500,
+		BtcDeposits: []DepositUtxo{{TxHash: fundingHash.String(), Vout: 1}},
+	}
+	o.ActiveSwaps[state.ID] = state
+	funding := wire.OutPoint{Hash: fundingHash, Index: 1}
+
+	cases := []struct {
+		name  string
+		raw   string
+		valid bool
+	}{
+		{"valid", refundTxHex(t, funding, 0xfffffffe, 500), true},
+		{"wrong outpoint", refundTxHex(t, wire.OutPoint{Hash: fundingHash, Index: 0}, 0xfffffffe, 500), false},
+		{"final sequence", refundTxHex(t, funding, wire.MaxTxInSequenceNum, 500), false},
+		{"early locktime", refundTxHex(t, funding, 0xfffffffe, 499), false},
+		{"timestamp locktime", refundTxHex(t, funding, 0xfffffffe, 1_700_000_000), false},
+		{"not hex", "zz", false},
+	}
+
+	for _, tc := range cases {
+		err := o.SubmitSignedRefund(state.ID, &localcommon.RefundRequest{SignedRefundTx: tc.raw})
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected refund to be rejected", tc.name)
+		}
+	}
+
+	if state.SignedRefundTx == "" {
+		t.Errorf("accepted refund was not stored on the swap")
+	}
+
+	// Once the secret is out the BTC is the resolver's, so no refund is taken.
+	for _, status := range []localcommon.SwapStatus{localcommon.StatusEvmClaimed, localcommon.StatusBtcWithdrawn, localcommon.StatusCompleted} {
+		state.Status, state.SignedRefundTx = status, ""
+		if err := o.SubmitSignedRefund(state.ID, &localcommon.RefundRequest{SignedRefundTx: refundTxHex(t, funding, 0xfffffffe, 500)}); err == nil || state.SignedRefundTx != "" {
+			t.Errorf("%s: expected the refund to be rejected, got %v", status, err)
+		}
+	}
+}
+
+// TestSubmitSignedCsvRefund checks that CSV refunds are judged by their BIP68
+// sequence rather than their locktime.
+func TestSubmitSignedCsvRefund(t *testing.T) {
+	o := NewSwapOrchestrator(nil, nil, nil, nil, newTestStore(t), &config.SwapConfig{})
+	fundingHash := chainhash.DoubleHashH([]byte("funding"))
+	state := &SwapState{
+		ID:              "swap-csv-refund",
+		Status:          localcommon.StatusRefundPending,
+		BtcLockTime:     800_144,
+		BtcTimelockType: localcommon.HtlcCSV,
+		BtcCsvDelay:     144,
+		BtcDeposits:     []DepositUtxo{{TxHash: fundingHash.String()}},
+	}
+	o.ActiveSwaps[state.ID] = state
+	funding := wire.OutPoint{Hash: fundingHash}
+
+	cases := []struct {
+		name     string
+		sequence uint32
+		valid    bool
+	}{
+		{"exact delay", 144, true},
+		{"longer delay", 200, true},
+		{"short delay", 143, false},
+		{"relative lock disabled", 144 | wire.SequenceLockTimeDisabled, false},
+		{"delay in seconds", 144 | wire.SequenceLockTimeIsSeconds, false},
+	}
+	for _, tc := range cases {
+		err := o.SubmitSignedRefund(state.ID, &localcommon.RefundRequest{SignedRefundTx: refundTxHex(t, funding, tc.sequence, 0)})
+		if tc.valid != (err == nil) {
+			t.Errorf("%s: valid=%v, got %v", tc.name, tc.valid, err)
+		}
+	}
+}
+
+// TestRefundPsbtTerms checks that a swap hands out what the user needs to
+// refund on their own, and that refund PSBTs wait for the deposit.
+func TestRefundPsbtTerms(t *testing.T) {
+	o, btc, _ := newFakeOrchestrator(t)
+	btc.depositE = services.ErrDepositExpired
+
+	resp, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination}, 10_000, testEvmAmount)
+	if err != nil {
+		t.Fatalf("InitiateSwapWithAmount failed: %v", err)
+	}
+	waitForStatus(t, o, resp.SwapID, localcommon.StatusExpired)
+
+	o.mu.Lock()
+	state := o.ActiveSwaps[resp.SwapID]
+	if resp.RedeemScript != hex.EncodeToString(state.BtcHtlcScript) || resp.LockTime != state.BtcLockTime || resp.LockTime == 0 {
+		t.Errorf("expected redeem script %x and locktime %d, got %s %d", state.BtcHtlcScript, state.BtcLockTime, resp.RedeemScript, resp.LockTime)
+	}
+	o.mu.Unlock()
+
+	cases := []struct {
+		name   string
+		swapID string
+		req    localcommon.RefundPsbtRequest
+		want   error
+	}{
+		{"unknown swap", "swap-unknown", localcommon.RefundPsbtRequest{RefundAddress: testDestination}, ErrSwapNotFound},
+		{"wrong network", resp.SwapID, localcommon.RefundPsbtRequest{RefundAddress: "bc1qwa29ncycnamh4mmy495zpl0vk9tgyfdxxudl8x"}, ErrInvalidRefundRequest},
+		{"negative fee rate", resp.SwapID, localcommon.RefundPsbtRequest{RefundAddress: testDestination, FeeRate: -1}, ErrInvalidRefundRequest},
+		{"no deposit", resp.SwapID, localcommon.RefundPsbtRequest{RefundAddress: testDestination}, ErrNoDeposit},
+	}
+	for _, tc := range cases {
+		if _, err := o.BuildRefundPsbt(context.Background(), tc.swapID, &tc.req); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	// A deposit paid after the swap expired was never recorded, but is still
+	// found on-chain and refunded, each funding tx once.
+	late := chainhash.DoubleHashH([]byte("late deposit"))
+	btc.mu.Lock()
+	btc.htlcUtxos = []services.DepositUtxo{
+		{OutPoint: wire.OutPoint{Hash: late}, Amount: 6_000},
+		{OutPoint: wire.OutPoint{Hash: late, Index: 1}, Amount: 4_000},
+	}
+	btc.mu.Unlock()
+	psbtResp, err := o.BuildRefundPsbt(context.Background(), resp.SwapID, &localcommon.RefundPsbtRequest{RefundAddress: testDestination})
+	if err != nil {
+		t.Fatalf("BuildRefundPsbt failed: %v", err)
+	}
+	if psbtResp.Inputs != 1 || psbtResp.Psbt == "" {
+		t.Errorf("expected a PSBT spending the late deposit tx, got %+v", psbtResp)
+	}
+}
@@ -0,0 +1,105 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
+)
+
+// A deposit is the sum of every confirmed output paid to the HTLC address, so
+// a user may pay in several transactions. Once the deposit is settled it is
+// compared to the quote, and a mismatch is handled by the configured policy:
+//
+//   - Underpayment (SWAP_UNDERPAYMENT_POLICY): "refund" parks the swap in
+//     REFUND_PENDING so the whole deposit goes back to the user, "requote"
+//     carries on with the amount received.
+//   - Overpayment (SWAP_OVERPAYMENT_POLICY): "passthrough" carries on with the
+//     whole deposit, "refund" carries on with the quoted amount and pays the
+//     surplus back to the user along with the payout.
+//
+// The EVM escrow pays the quoted rate for the amount the swap carries on
+// with, so a requote or passthrough scales it with the BTC amount.
+//
+// The outcome is recorded on the swap and reported in its status.
+
+// Payment policies, selected with SWAP_UNDERPAYMENT_POLICY and
+// SWAP_OVERPAYMENT_POLICY.
+const (
+	PolicyRefund      = "refund"
+	PolicyRequote     = "requote"
+	PolicyPassThrough = "passthrough"
+)
+
+// CheckPaymentPolicies rejects unknown payment policies, so that a typo fails
+// at startup rather than when a mismatched deposit arrives.
+func CheckPaymentPolicies(cfg *config.SwapConfig) error {
+	switch cfg.UnderpaymentPolicy {
+	case "", PolicyRefund, PolicyRequote:
+	default:
+		return fmt.Errorf("unknown SWAP_UNDERPAYMENT_POLICY %q: expected %s or %s", cfg.UnderpaymentPolicy, PolicyRefund, PolicyRequote)
+	}
+	switch cfg.OverpaymentPolicy {
+	case "", PolicyPassThrough, PolicyRefund:
+	default:
+		return fmt.Errorf("unknown SWAP_OVERPAYMENT_POLICY %q: expected %s or %s", cfg.OverpaymentPolicy, PolicyPassThrough, PolicyRefund)
+	}
+	return nil
+}
+
+// depositOutcome applies the payment policies to a deposit of received
+// against a quote of quoted. It returns the outcome and the amount the swap
+// proceeds with. An empty policy means the default: refund an underpayment,
+// pass an overpayment through.
+func (o *SwapOrchestrator) depositOutcome(quoted, received btcutil.Amount) (localcommon.DepositOutcome, btcutil.Amount, error) {
+	if err := CheckPaymentPolicies(o.cfg); err != nil {
+		return "", 0, err
+	}
+	switch {
+	case received < quoted && o.cfg.UnderpaymentPolicy == PolicyRequote:
+		return localcommon.DepositRequoted, received, nil
+	case received < quoted:
+		return localcommon.DepositUnderpaidRefunded, quoted, nil
+	case received > quoted && o.cfg.OverpaymentPolicy == PolicyRefund:
+		return localcommon.DepositSurplusRefunded, quoted, nil
+	case received > quoted:
+		return localcommon.DepositSurplusSwapped, received, nil
+	default:
+		return localcommon.DepositExact, quoted, nil
+	}
+}
+
+// evmAmountFor returns the escrow amount of a swap carrying on with
+// swapAmount: its EVM quote scaled by swapAmount over the BTC quote, rounded
+// down. The caller must hold o.mu or own the state.
+func evmAmountFor(state *SwapState, swapAmount btcutil.Amount) *big.Int {
+	if state.EvmQuotedAmount == nil || state.BtcQuotedAmount <= 0 {
+		return state.EvmAmount
+	}
+	amount := new(big.Int).Mul(state.EvmQuotedAmount, big.NewInt(int64(swapAmount)))
+	return amount.Quo(amount, big.NewInt(int64(state.BtcQuotedAmount)))
+}
+
+// depositSummary reports a swap's deposit for its status, or nil before the
+// deposit has confirmed. The caller must hold o.mu.
+func depositSummary(state *SwapState) *localcommon.DepositSummary {
+	if len(state.BtcDeposits) == 0 {
+		return nil
+	}
+	var evmAmount string
+	if state.EvmAmount != nil {
+		evmAmount = state.EvmAmount.String()
+	}
+	return &localcommon.DepositSummary{
+		QuotedAmount:        fmt.Sprint(int64(state.BtcQuotedAmount)),
+		ReceivedAmount:      fmt.Sprint(int64(state.BtcReceivedAmount)),
+		SwapAmount:          fmt.Sprint(int64(state.BtcAmount)),
+		EvmAmount:           evmAmount,
+		Utxos:               len(state.BtcDeposits),
+		Outcome:             state.DepositOutcome,
+		SurplusRefundTxHash: state.BtcSurplusRefundTxHash,
+	}
+}
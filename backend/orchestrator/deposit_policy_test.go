@@ -0,0 +1,161 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
+)
+
+// TestDepositPolicies drives swaps paid in two outputs that together under-
+// or overpay the quote through each payment policy.
+func TestDepositPolicies(t *testing.T) {
+	cases := []struct {
+		name          string
+		paid          []btcutil.Amount
+		underpayment  string
+		overpayment   string
+		status        localcommon.SwapStatus
+		outcome       localcommon.DepositOutcome
+		payoutAmounts []btcutil.Amount
+		escrowAmount  int64 // Wei, 0 for no escrow
+	}{
+		{"exact", []btcutil.Amount{4_000, 6_000}, "", "", localcommon.StatusCompleted, localcommon.DepositExact, []btcutil.Amount{10_000}, 1_000_000_000_000},
+		{"underpaid refunded", []btcutil.Amount{4_000, 5_000}, "", "", localcommon.StatusRefundPending, localcommon.DepositUnderpaidRefunded, nil, 0},
+		{"underpaid requoted", []btcutil.Amount{4_000, 5_000}, PolicyRequote, "", localcommon.StatusCompleted, localcommon.DepositRequoted, []btcutil.Amount{9_000}, 900_000_000_000},
+		{"overpaid passed through", []btcutil.Amount{4_000, 7_000}, "", "", localcommon.StatusCompleted, localcommon.DepositSurplusSwapped, []btcutil.Amount{11_000}, 1_100_000_000_000},
+		{"overpaid surplus refunded", []btcutil.Amount{4_000, 7_000}, "", PolicyRefund, localcommon.StatusCompleted, localcommon.DepositSurplusRefunded, []btcutil.Amount{10_000, 1_000}, 1_000_000_000_000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, btc, evm := newFakeOrchestrator(t)
+			o.cfg.RefundRetryInterval = time.Hour
+			o.cfg.UnderpaymentPolicy = tc.underpayment
+			o.cfg.OverpaymentPolicy = tc.overpayment
+			btc.paid = tc.paid
+			evm.reveal = func(ctx context.Context, secretHash [32]byte) ([]byte, error) {
+				o.mu.Lock()
+				defer o.mu.Unlock()
+				for _, state := range o.ActiveSwaps {
+					if state.SecretHash == secretHash {
+						return state.Secret, nil
+					}
+				}
+				return nil, errors.New("unknown secret hash")
+			}
+
+			resp, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination}, 10_000, testEvmAmount)
+			if err != nil {
+				t.Fatalf("InitiateSwapWithAmount failed: %v", err)
+			}
+			status := waitForStatus(t, o, resp.SwapID, tc.status)
+
+			deposit := status.Deposit
+			if deposit == nil {
+				t.Fatal("expected the deposit in the swap status")
+			}
+			var received btcutil.Amount
+			for _, amount := range tc.paid {
+				received += amount
+			}
+			if deposit.Outcome != tc.outcome || deposit.Utxos != len(tc.paid) || deposit.QuotedAmount != "10000" || deposit.ReceivedAmount != fmt.Sprint(int64(received)) {
+				t.Errorf("unexpected deposit summary %+v", deposit)
+			}
+			if tc.outcome == localcommon.DepositSurplusRefunded && deposit.SurplusRefundTxHash == "" {
+				t.Error("expected the surplus refund tx in the swap status")
+			}
+
+			// The escrow pays the quoted rate for the amount swapped.
+			o.mu.Lock()
+			secretHash := o.ActiveSwaps[resp.SwapID].SecretHash
+			o.mu.Unlock()
+			evm.mu.Lock()
+			escrow := evm.escrows[secretHash]
+			evm.mu.Unlock()
+			switch {
+			case tc.escrowAmount == 0 && escrow != nil:
+				t.Errorf("expected no escrow, got %v wei", escrow.Amount)
+			case tc.escrowAmount == 0:
+			case escrow == nil:
+				t.Errorf("expected an escrow of %d wei, got none", tc.escrowAmount)
+			case escrow.Amount.Int64() != tc.escrowAmount || escrow.User.Hex() != testUserEvmAddress:
+				t.Errorf("expected an escrow of %d wei to %s, got %v wei to %s", tc.escrowAmount, testUserEvmAddress, escrow.Amount, escrow.User.Hex())
+			}
+			if tc.escrowAmount != 0 && deposit.EvmAmount != fmt.Sprint(tc.escrowAmount) {
+				t.Errorf("expected the swap status to report %d wei, got %q", tc.escrowAmount, deposit.EvmAmount)
+			}
+
+			btc.mu.Lock()
+			defer btc.mu.Unlock()
+			if len(btc.payoutAmounts) != len(tc.payoutAmounts) {
+				t.Fatalf("expected payouts %v, got %v", tc.payoutAmounts, btc.payoutAmounts)
+			}
+			for i := range tc.payoutAmounts {
+				if btc.payoutAmounts[i] != tc.payoutAmounts[i] {
+					t.Fatalf("expected payouts %v, got %v", tc.payoutAmounts, btc.payoutAmounts)
+				}
+			}
+		})
+	}
+}
+
+// TestCheckPaymentPolicies checks that unknown policies are rejected.
+func TestCheckPaymentPolicies(t *testing.T) {
+	if err := CheckPaymentPolicies(&config.SwapConfig{}); err != nil {
+		t.Errorf("expected the default policies to be accepted, got %v", err)
+	}
+	if err := CheckPaymentPolicies(&config.SwapConfig{UnderpaymentPolicy: PolicyPassThrough}); err == nil {
+		t.Error("expected passthrough to be rejected as an underpayment policy")
+	}
+	if err := CheckPaymentPolicies(&config.SwapConfig{OverpaymentPolicy: PolicyRequote}); err == nil {
+		t.Error("expected requote to be rejected as an overpayment policy")
+	}
+}
+
+// TestSubmitSignedRefundSpendsEveryDeposit checks that a refund of a split
+// deposit must spend all of its outputs.
+func TestSubmitSignedRefundSpendsEveryDeposit(t *testing.T) {
+	o := NewSwapOrchestrator(nil, nil, nil, nil, newTestStore(t), &config.SwapConfig{})
+	first := chainhash.DoubleHashH([]byte("first"))
+	second := chainhash.DoubleHashH([]byte("second"))
+	state := &SwapState{
+		ID:          "swap-split-refund",
+		Status:      localcommon.StatusRefundPending,
+		BtcLockTime: 500,
+		BtcDeposits: []DepositUtxo{{TxHash: first.String()}, {TxHash: second.String(), Vout: 2}},
+	}
+	o.ActiveSwaps[state.ID] = state
+
+	refund := func(prevs ...wire.OutPoint) string {
+		tx := wire.NewMsgTx(2)
+		for _, prev := range prevs {
+			tx.AddTxIn(&wire.TxIn{PreviousOutPoint: prev, Sequence: 0xfffffffe})
+		}
+		tx.AddTxOut(wire.NewTxOut(9000, []byte{0x00, 0x14}))
+		tx.LockTime = 500
+		var buf bytes.Buffer
+		if err := tx.Serialize(&buf); err != nil {
+			t.Fatalf("failed to serialize tx: %v", err)
+		}
+		return hex.EncodeToString(buf.Bytes())
+	}
+
+	partial := refund(wire.OutPoint{Hash: first})
+	if err := o.SubmitSignedRefund(state.ID, &localcommon.RefundRequest{SignedRefundTx: partial}); err == nil {
+		t.Error("expected a refund of one output to be rejected")
+	}
+	full := refund(wire.OutPoint{Hash: first}, wire.OutPoint{Hash: second, Index: 2})
+	if err := o.SubmitSignedRefund(state.ID, &localcommon.RefundRequest{SignedRefundTx: full}); err != nil {
+		t.Errorf("expected a refund of both outputs to be accepted, got %v", err)
+	}
+}
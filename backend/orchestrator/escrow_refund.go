@@ -0,0 +1,146 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"fusion-btc-resolver/services"
+)
+
+// StartEscrowRefundJob starts a background job that periodically returns the
+// resolver's funds from EVM escrows that the user never claimed. main starts
+// it after ResumeSwaps; it runs until Shutdown.
+func (o *SwapOrchestrator) StartEscrowRefundJob() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closing {
+		return
+	}
+	o.launch(o.runEscrowRefundJob)
+}
+
+func (o *SwapOrchestrator) runEscrowRefundJob(ctx context.Context) {
+	ticker := time.NewTicker(o.cfg.EscrowRefundInterval)
+	defer ticker.Stop()
+
+	for {
+		o.refundExpiredEscrows(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// escrowNeedsRefund reports whether a swap has funded an EVM escrow that is
+// not yet known to be claimed, refunded or absent. A submitted refund keeps
+// the swap a candidate until its receipt confirms it, so a refund that fails
+// or is dropped is retried.
+func escrowNeedsRefund(s *SwapState) bool {
+	return (s.EvmEscrowTxHash != "" || s.EvmEscrowRecovered) && s.EvmEscrowTimelock > 0 &&
+		!s.EvmEscrowClaimed && !s.EvmEscrowRefunded && !s.EvmEscrowAbsent
+}
+
+// refundExpiredEscrows makes a single pass over every swap with an unsettled escrow.
+func (o *SwapOrchestrator) refundExpiredEscrows(ctx context.Context) {
+	o.mu.Lock()
+	var candidates []*SwapState
+	for _, state := range o.ActiveSwaps {
+		if escrowNeedsRefund(state) {
+			candidates = append(candidates, state)
+		}
+	}
+	o.mu.Unlock()
+
+	if len(candidates) == 0 {
+		return
+	}
+
+	// The contract checks timelocks against block time, not our wall clock.
+	now, err := o.EvmService.LatestBlockTime(ctx)
+	if err != nil {
+		log.Printf("[ESCROW_REFUND] ERROR: %v", err)
+		return
+	}
+
+	for _, state := range candidates {
+		if ctx.Err() != nil {
+			return
+		}
+		if now.Unix() < state.EvmEscrowTimelock {
+			continue
+		}
+		o.refundEscrow(ctx, state)
+	}
+}
+
+// refundEscrow refunds one expired escrow, after confirming on-chain that it
+// is neither claimed nor already refunded. A refund already submitted is
+// waited for rather than sent again.
+func (o *SwapOrchestrator) refundEscrow(ctx context.Context, state *SwapState) {
+	o.mu.Lock()
+	refundTxHash := state.EvmEscrowRefundTxHash
+	o.mu.Unlock()
+	if refundTxHash != "" {
+		receipt, err := o.EvmService.GetTxReceipt(ctx, common.HexToHash(refundTxHash))
+		switch {
+		case errors.Is(err, services.ErrTxNotFound):
+			log.Printf("[ESCROW_REFUND-%s] Refund %s was dropped, checking the escrow again", state.ID, refundTxHash)
+		case err != nil:
+			log.Printf("[ESCROW_REFUND-%s] ERROR: %v", state.ID, err)
+			return
+		case receipt == nil:
+			return
+		case receipt.Status == types.ReceiptStatusSuccessful:
+			log.Printf("[ESCROW_REFUND-%s] Escrow refund %s confirmed on-chain", state.ID, refundTxHash)
+			o.recordEscrowOutcome(state, func(s *SwapState) { s.EvmEscrowRefunded = true })
+			return
+		default:
+			log.Printf("[ESCROW_REFUND-%s] Refund %s reverted, checking the escrow again", state.ID, refundTxHash)
+		}
+	}
+
+	escrow, err := o.EvmService.GetEscrow(ctx, state.SecretHash)
+	if err != nil {
+		log.Printf("[ESCROW_REFUND-%s] ERROR: %v", state.ID, err)
+		return
+	}
+
+	switch {
+	case escrow.Amount == nil || escrow.Amount.Sign() == 0:
+		log.Printf("[ESCROW_REFUND-%s] No escrow exists on-chain, nothing to refund", state.ID)
+		o.recordEscrowOutcome(state, func(s *SwapState) { s.EvmEscrowAbsent = true })
+		return
+	case escrow.Claimed:
+		log.Printf("[ESCROW_REFUND-%s] Escrow was claimed by the user, skipping refund", state.ID)
+		o.recordEscrowOutcome(state, func(s *SwapState) { s.EvmEscrowClaimed = true })
+		return
+	case escrow.Refunded:
+		log.Printf("[ESCROW_REFUND-%s] Escrow refund confirmed on-chain", state.ID)
+		o.recordEscrowOutcome(state, func(s *SwapState) { s.EvmEscrowRefunded = true })
+		return
+	}
+
+	// Like the escrow deposit, a submitted refund is allowed to finish during
+	// shutdown so its tx hash is recorded.
+	tx, err := o.EvmService.RefundEscrow(context.WithoutCancel(ctx), state.SecretHash)
+	if err != nil {
+		log.Printf("[ESCROW_REFUND-%s] ERROR: %v", state.ID, err)
+		return
+	}
+
+	log.Printf("[ESCROW_REFUND-%s] Expired escrow refund submitted. TxHash: %s", state.ID, tx.Hash().Hex())
+	o.recordEscrowOutcome(state, func(s *SwapState) { s.EvmEscrowRefundTxHash = tx.Hash().Hex() })
+}
+
+func (o *SwapOrchestrator) recordEscrowOutcome(state *SwapState, update func(s *SwapState)) {
+	if err := o.checkpoint(state, update); err != nil {
+		log.Printf("[ESCROW_REFUND-%s] ERROR: %v", state.ID, err)
+	}
+}
@@ -0,0 +1,287 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/contracts/settlement"
+	"fusion-btc-resolver/services"
+)
+
+// fakeBtcChain is an in-memory services.BtcChain. Deposits are reported
+// immediately and payouts are recorded instead of broadcast.
+type fakeBtcChain struct {
+	mu            sync.Mutex
+	height        int64
+	confirmations int64 // Reported for every tx, 1 if unset
+	payouts       []string
+	payoutAmounts []btcutil.Amount
+	paid          []btcutil.Amount // Outputs paying each deposit, the expected amount if unset
+	depositE      error
+	htlcUtxos     []services.DepositUtxo            // What ListHtlcUtxos reports for every HTLC
+	internalKey   []byte                            // Internal key of P2TR HTLCs, the NUMS point if nil
+	mempool       map[chainhash.Hash]bool           // Txs reported with 0 confirmations
+	tracked       map[chainhash.Hash]btcutil.Amount // Payouts handed back by TrackPayout
+
+	// Every tx is mined in fakeTxBlock(tx) unless overridden here.
+	txBlocks map[chainhash.Hash]*chainhash.Hash // nil: back in the mempool
+	dropped  map[chainhash.Hash]bool            // Double-spent txs
+	stale    map[chainhash.Hash]bool            // Blocks reorged out of the active chain
+	tip      chainhash.Hash
+}
+
+func fakeTxBlock(txHash *chainhash.Hash) chainhash.Hash {
+	return chainhash.DoubleHashH(append([]byte("block"), txHash[:]...))
+}
+
+var _ services.BtcChain = (*fakeBtcChain)(nil)
+
+func (f *fakeBtcChain) NetParams() *chaincfg.Params { return &chaincfg.RegressionNetParams }
+
+func (f *fakeBtcChain) TaprootKeyMode() string { return services.TaprootInternalKeyNUMS }
+
+func (f *fakeBtcChain) CreateHtlc(senderPubKey, receiverPubKey []byte, secretHash []byte, lockTime int64, timelockType localcommon.HtlcTimelockType, addrType localcommon.HtlcAddressType) ([]byte, btcutil.Address, error) {
+	params := &services.HtlcParams{SecretHash: secretHash, ClaimPubKey: receiverPubKey, RefundPubKey: senderPubKey, LockTime: lockTime, TimelockType: timelockType}
+	if addrType == localcommon.HtlcP2TR {
+		params.InternalKey = f.internalKey
+	}
+	return services.BuildHtlc(params, addrType, f.NetParams())
+}
+
+func (f *fakeBtcChain) MonitorForDeposit(ctx context.Context, htlcAddress btcutil.Address, expectedAmount btcutil.Amount, deadline time.Time) (*services.Deposit, error) {
+	if f.depositE != nil {
+		return nil, f.depositE
+	}
+	f.mu.Lock()
+	paid := f.paid
+	f.mu.Unlock()
+	if len(paid) == 0 {
+		paid = []btcutil.Amount{expectedAmount}
+	}
+	// Each output is paid by its own tx.
+	deposit := &services.Deposit{}
+	for i, amount := range paid {
+		hash := chainhash.DoubleHashH([]byte(fmt.Sprintf("%s/%d", htlcAddress.EncodeAddress(), i)))
+		deposit.Utxos = append(deposit.Utxos, services.DepositUtxo{OutPoint: *wire.NewOutPoint(&hash, 0), Amount: amount})
+		deposit.Total += amount
+	}
+	return deposit, nil
+}
+
+func (f *fakeBtcChain) RedeemHtlc(ctx context.Context, fundingTxHashes []*chainhash.Hash, htlcScript []byte, addrType localcommon.HtlcAddressType, redeemAddress btcutil.Address, key *btcec.PrivateKey, preimage []byte, lockTime int64) (*chainhash.Hash, error) {
+	return nil, errors.New("not implemented")
+}
+
+// BuildRefundPsbt spends output 0 of each funding tx, worth 10,000 sat.
+func (f *fakeBtcChain) BuildRefundPsbt(ctx context.Context, fundingTxHashes []*chainhash.Hash, htlcScript []byte, addrType localcommon.HtlcAddressType, refundAddress btcutil.Address, lockTime int64, feeRate services.FeeRate) (*psbt.Packet, error) {
+	tx := wire.NewMsgTx(2)
+	for _, txHash := range fundingTxHashes {
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(txHash, 0), nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(int64(len(fundingTxHashes))*9_000, []byte{0x00, 0x14}))
+	packet, err := psbt.NewFromUnsignedTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range packet.Inputs {
+		packet.Inputs[i].WitnessUtxo = wire.NewTxOut(10_000, []byte{0x00, 0x20})
+	}
+	return packet, nil
+}
+
+func (f *fakeBtcChain) ListHtlcUtxos(ctx context.Context, htlcAddress btcutil.Address) ([]services.DepositUtxo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.htlcUtxos, nil
+}
+
+func (f *fakeBtcChain) SendBitcoinToUser(ctx context.Context, toAddress string, amount btcutil.Amount) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.payouts = append(f.payouts, toAddress)
+	f.payoutAmounts = append(f.payoutAmounts, amount)
+	return chainhash.DoubleHashH([]byte(fmt.Sprint("payout-", len(f.payouts)))).String(), nil
+}
+
+func (f *fakeBtcChain) TrackPayout(ctx context.Context, txHash *chainhash.Hash, toAddress string, amount btcutil.Amount) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tracked == nil {
+		f.tracked = make(map[chainhash.Hash]btcutil.Amount)
+	}
+	f.tracked[*txHash] = amount
+	return nil
+}
+
+func (f *fakeBtcChain) CurrentHeight(ctx context.Context) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.height, nil
+}
+
+func (f *fakeBtcChain) BroadcastTransaction(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error) {
+	hash := tx.TxHash()
+	return &hash, nil
+}
+
+func (f *fakeBtcChain) GetConfirmations(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mempool[*txHash] {
+		return 0, nil
+	}
+	if f.confirmations == 0 {
+		return 1, nil
+	}
+	return f.confirmations, nil
+}
+
+func (f *fakeBtcChain) GetTxBlock(ctx context.Context, txHash *chainhash.Hash) (*chainhash.Hash, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dropped[*txHash] {
+		return nil, services.ErrTxNotFound
+	}
+	if block, ok := f.txBlocks[*txHash]; ok {
+		return block, nil
+	}
+	block := fakeTxBlock(txHash)
+	return &block, nil
+}
+
+func (f *fakeBtcChain) IsInActiveChain(ctx context.Context, blockHash *chainhash.Hash) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.stale[*blockHash], nil
+}
+
+func (f *fakeBtcChain) BestBlockHash(ctx context.Context) (*chainhash.Hash, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tip := f.tip
+	return &tip, nil
+}
+
+// reorg moves a tx out of its block, either into another block or, if
+// newBlock is nil, back into the mempool.
+func (f *fakeBtcChain) reorg(txHash *chainhash.Hash, newBlock *chainhash.Hash) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stale == nil {
+		f.stale = make(map[chainhash.Hash]bool)
+		f.txBlocks = make(map[chainhash.Hash]*chainhash.Hash)
+	}
+	if old, ok := f.txBlocks[*txHash]; !ok {
+		f.stale[fakeTxBlock(txHash)] = true
+	} else if old != nil {
+		f.stale[*old] = true
+	}
+	f.txBlocks[*txHash] = newBlock
+	f.tip = chainhash.DoubleHashH(f.tip[:])
+}
+
+// doubleSpend removes a tx from the chain and the mempool.
+func (f *fakeBtcChain) doubleSpend(txHash *chainhash.Hash) {
+	f.reorg(txHash, nil)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dropped == nil {
+		f.dropped = make(map[chainhash.Hash]bool)
+	}
+	f.dropped[*txHash] = true
+}
+
+// fakeEvmChain is an in-memory services.EvmChain. Claims are answered by the
+// test's reveal function, or time out if none is set.
+type fakeEvmChain struct {
+	mu       sync.Mutex
+	now      time.Time
+	block    uint64
+	reveal   func(ctx context.Context, secretHash [32]byte) ([]byte, error)
+	escrows  map[[32]byte]*settlement.FusionBtcSettlementEscrow
+	refunded [][32]byte
+	receipts map[common.Hash]*types.Receipt // Sent txs; a nil receipt is pending
+}
+
+var _ services.EvmChain = (*fakeEvmChain)(nil)
+
+func newFakeEvmChain(now time.Time) *fakeEvmChain {
+	return &fakeEvmChain{
+		now:      now,
+		block:    18_000_000,
+		escrows:  make(map[[32]byte]*settlement.FusionBtcSettlementEscrow),
+		receipts: make(map[common.Hash]*types.Receipt),
+	}
+}
+
+func (f *fakeEvmChain) DepositIntoEscrow(ctx context.Context, userAddress common.Address, amount *big.Int, secretHash [32]byte, lockTime *big.Int) (*types.Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.escrows[secretHash] = &settlement.FusionBtcSettlementEscrow{User: userAddress, Amount: amount, Timelock: lockTime}
+	return types.NewTx(&types.LegacyTx{Nonce: uint64(len(f.escrows))}), nil
+}
+
+func (f *fakeEvmChain) MonitorForClaimEvent(ctx context.Context, secretHash [32]byte, deadline time.Time, cursor services.BlockCursor) ([]byte, error) {
+	if f.reveal == nil {
+		return nil, errors.New("timeout waiting for secret revelation")
+	}
+	return f.reveal(ctx, secretHash)
+}
+
+func (f *fakeEvmChain) GetEscrow(ctx context.Context, secretHash [32]byte) (*settlement.FusionBtcSettlementEscrow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if escrow, ok := f.escrows[secretHash]; ok {
+		copied := *escrow
+		return &copied, nil
+	}
+	return &settlement.FusionBtcSettlementEscrow{Amount: big.NewInt(0)}, nil
+}
+
+func (f *fakeEvmChain) RefundEscrow(ctx context.Context, secretHash [32]byte) (*types.Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.refunded = append(f.refunded, secretHash)
+	if escrow, ok := f.escrows[secretHash]; ok {
+		escrow.Refunded = true
+	}
+	tx := types.NewTx(&types.LegacyTx{Nonce: uint64(1000 + len(f.refunded))})
+	f.receipts[tx.Hash()] = &types.Receipt{Status: types.ReceiptStatusSuccessful}
+	return tx, nil
+}
+
+func (f *fakeEvmChain) GetTxReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	receipt, ok := f.receipts[txHash]
+	if !ok {
+		return nil, services.ErrTxNotFound
+	}
+	return receipt, nil
+}
+
+func (f *fakeEvmChain) LatestBlockTime(ctx context.Context) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now, nil
+}
+
+func (f *fakeEvmChain) LatestBlockNumber(ctx context.Context) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.block, nil
+}
@@ -0,0 +1,202 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/services"
+)
+
+// A confirmed BTC deposit can still be undone by a reorg. Each deposit's
+// confirming block is recorded when it is accepted, and rechecked:
+//
+//   - by the lifecycle, right before the EVM escrow is funded. A deposit that
+//     was reorged back into the mempool returns the swap to PENDING_DEPOSIT to
+//     wait for it again; one that was double-spent fails the swap.
+//   - by a background job on every new BTC tip, for every swap that has
+//     accepted a deposit. It raises an alert for any deposit that left the
+//     active chain, which after funding needs an operator: the escrow cannot
+//     be taken back.
+
+// depositFate is what became of a swap's accepted deposit.
+type depositFate int
+
+const (
+	depositIntact      depositFate = iota // Still confirmed on the active chain
+	depositUnconfirmed                    // Reorged out, back in the mempool
+	depositGone                           // Neither confirmed nor in the mempool: double-spent
+)
+
+// recheckDeposit finds out whether every transaction of a swap's deposit is
+// still confirmed on the active chain, reporting the worst fate among them. A
+// deposit mined again in another block stays intact, and the new block is
+// recorded.
+func (o *SwapOrchestrator) recheckDeposit(ctx context.Context, state *SwapState) (depositFate, error) {
+	o.mu.Lock()
+	utxos := append([]DepositUtxo(nil), state.BtcDeposits...)
+	o.mu.Unlock()
+
+	fate := depositIntact
+	checked := make(map[string]bool)
+	moved := make(map[string]string) // New block of each tx mined again elsewhere
+	for _, utxo := range utxos {
+		if checked[utxo.TxHash] {
+			continue
+		}
+		checked[utxo.TxHash] = true
+		txFate, blockHash, err := o.recheckDepositTx(ctx, utxo.TxHash, utxo.BlockHash)
+		if err != nil {
+			return 0, err
+		}
+		fate = max(fate, txFate)
+		if txFate == depositIntact && blockHash != utxo.BlockHash {
+			log.Printf("[LIFECYCLE-%s] BTC deposit %s is now confirmed in block %s", state.ID, utxo.TxHash, blockHash)
+			moved[utxo.TxHash] = blockHash
+		}
+	}
+
+	if len(moved) > 0 {
+		err := o.checkpoint(state, func(s *SwapState) {
+			for i, utxo := range s.BtcDeposits {
+				if blockHash, ok := moved[utxo.TxHash]; ok {
+					s.BtcDeposits[i].BlockHash = blockHash
+				}
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return fate, nil
+}
+
+// recheckDepositTx rechecks one deposit transaction last seen in blockHashStr,
+// returning the block it is confirmed in when intact.
+func (o *SwapOrchestrator) recheckDepositTx(ctx context.Context, txHashStr, blockHashStr string) (depositFate, string, error) {
+	if blockHashStr != "" {
+		blockHash, err := chainhash.NewHashFromStr(blockHashStr)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid deposit block hash %q: %v", blockHashStr, err)
+		}
+		active, err := o.BtcService.IsInActiveChain(ctx, blockHash)
+		if err != nil {
+			return 0, "", err
+		}
+		if active {
+			return depositIntact, blockHashStr, nil
+		}
+	}
+
+	txHash, err := chainhash.NewHashFromStr(txHashStr)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid deposit tx hash %q: %v", txHashStr, err)
+	}
+	blockHash, err := o.BtcService.GetTxBlock(ctx, txHash)
+	if errors.Is(err, services.ErrTxNotFound) {
+		return depositGone, "", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if blockHash == nil {
+		return depositUnconfirmed, "", nil
+	}
+	return depositIntact, blockHash.String(), nil
+}
+
+// alert flags a swap for an operator's attention. Alerts are logged under an
+// [ALERT] tag, for log-based alerting to pick up.
+func (o *SwapOrchestrator) alert(state *SwapState, format string, args ...interface{}) {
+	log.Printf("[ALERT-%s] "+format, append([]interface{}{state.ID}, args...)...)
+}
+
+// StartReorgWatchJob starts a background job that rechecks every accepted
+// deposit whenever the BTC tip changes. main starts it after ResumeSwaps; it
+// runs until Shutdown.
+func (o *SwapOrchestrator) StartReorgWatchJob() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closing {
+		return
+	}
+	o.launch(o.runReorgWatchJob)
+}
+
+func (o *SwapOrchestrator) runReorgWatchJob(ctx context.Context) {
+	ticker := time.NewTicker(o.cfg.ReorgCheckInterval)
+	defer ticker.Stop()
+
+	var lastTip chainhash.Hash
+	alerted := make(map[string]bool) // Swaps already alerted about
+	for {
+		tip, err := o.BtcService.BestBlockHash(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[REORG_WATCH] ERROR: %v", err)
+		}
+		if err == nil && *tip != lastTip {
+			lastTip = *tip
+			o.recheckDeposits(ctx, alerted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// depositAccepted reports whether a swap is past accepting its deposit and
+// still in flight.
+func depositAccepted(s *SwapState) bool {
+	return len(s.BtcDeposits) > 0 && s.Status != localcommon.StatusPendingDeposit && !isTerminalStatus(s.Status)
+}
+
+// recheckDeposits makes one pass over every swap with an accepted deposit,
+// alerting once per swap whose deposit left the active chain. Swaps not yet
+// funded are put right by their lifecycle before funding.
+func (o *SwapOrchestrator) recheckDeposits(ctx context.Context, alerted map[string]bool) {
+	o.mu.Lock()
+	var candidates []*SwapState
+	for _, state := range o.ActiveSwaps {
+		if depositAccepted(state) {
+			candidates = append(candidates, state)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, state := range candidates {
+		if ctx.Err() != nil {
+			return
+		}
+		fate, err := o.recheckDeposit(ctx, state)
+		if err != nil {
+			log.Printf("[REORG_WATCH-%s] ERROR: %v", state.ID, err)
+			continue
+		}
+		if fate == depositIntact {
+			delete(alerted, state.ID)
+			continue
+		}
+		if alerted[state.ID] {
+			continue
+		}
+		alerted[state.ID] = true
+
+		o.mu.Lock()
+		status, txHashes := state.Status, strings.Join(state.depositTxHashes(), ", ")
+		o.mu.Unlock()
+		what := "reorged back into the mempool"
+		if fate == depositGone {
+			what = "double-spent"
+		}
+		o.alert(state, "BTC deposit %s was %s while the swap is %s", txHashes, what, status)
+	}
+}
@@ -0,0 +1,132 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/services"
+)
+
+// newDepositedSwap registers a swap whose deposit was accepted in the fake
+// chain's default block for it.
+func newDepositedSwap(t *testing.T, o *SwapOrchestrator, id string, status localcommon.SwapStatus) (*SwapState, chainhash.Hash) {
+	t.Helper()
+	plan, err := o.planTimelocks(context.Background())
+	if err != nil {
+		t.Fatalf("planTimelocks failed: %v", err)
+	}
+	keyIndex, err := o.Store.NextKeyIndex()
+	if err != nil {
+		t.Fatalf("NextKeyIndex failed: %v", err)
+	}
+	keyPath, claimPubKey, err := o.ClaimKeys.NewClaimKey(keyIndex)
+	if err != nil {
+		t.Fatalf("NewClaimKey failed: %v", err)
+	}
+	refundPubKey, _ := services.ParseRefundPubKey(testRefundPubKey)
+	secretHash := chainhash.DoubleHashH([]byte("secret-" + id))
+	htlcScript, htlcAddress, err := o.BtcService.CreateHtlc(refundPubKey, claimPubKey, secretHash[:], plan.BtcLockHeight, localcommon.HtlcCLTV, localcommon.HtlcP2SH)
+	if err != nil {
+		t.Fatalf("CreateHtlc failed: %v", err)
+	}
+
+	depositTx := chainhash.DoubleHashH([]byte(id))
+	block := fakeTxBlock(&depositTx)
+	state := &SwapState{
+		ID:                id,
+		Status:            status,
+		SecretHash:        secretHash,
+		BtcDepositAddress: htlcAddress.EncodeAddress(),
+		BtcHtlcScript:     htlcScript,
+		BtcClaimKeyPath:   keyPath,
+		BtcQuotedAmount:   10_000,
+		BtcAmount:         10_000,
+		BtcReceivedAmount: 10_000,
+		UserEvmAddress:    testUserEvmAddress,
+		EvmAmount:         testEvmAmount,
+		EvmQuotedAmount:   testEvmAmount,
+		BtcDeposits:       []DepositUtxo{{TxHash: depositTx.String(), Amount: 10_000, BlockHash: block.String()}},
+		DepositOutcome:    localcommon.DepositExact,
+		BtcLockTime:       plan.BtcLockHeight,
+		EvmEscrowTimelock: plan.EvmTimelock.Unix(),
+	}
+	o.mu.Lock()
+	o.ActiveSwaps[id] = state
+	o.mu.Unlock()
+	return state, depositTx
+}
+
+// TestFulfillEvmEscrowRechecksDeposit checks that the escrow is only funded
+// while the deposit is still confirmed on the active chain.
+func TestFulfillEvmEscrowRechecksDeposit(t *testing.T) {
+	o, btc, evm := newFakeOrchestrator(t)
+	ctx := context.Background()
+
+	// Reorged back into the mempool: wait for the deposit again.
+	state, depositTx := newDepositedSwap(t, o, "reorged", localcommon.StatusBtcConfirmed)
+	btc.reorg(&depositTx, nil)
+	if err := o.fulfillEvmEscrow(ctx, state); err != nil {
+		t.Fatalf("fulfillEvmEscrow failed: %v", err)
+	}
+	if state.Status != localcommon.StatusPendingDeposit || len(state.BtcDeposits) != 0 || state.BtcReceivedAmount != 0 {
+		t.Errorf("expected the swap to wait for its deposit again, got %s %+v", state.Status, state.BtcDeposits)
+	}
+
+	// Double-spent: fail the swap.
+	state, depositTx = newDepositedSwap(t, o, "double-spent", localcommon.StatusBtcConfirmed)
+	btc.doubleSpend(&depositTx)
+	if err := o.fulfillEvmEscrow(ctx, state); err == nil {
+		t.Error("expected a double-spent deposit to fail the swap")
+	}
+
+	if len(evm.escrows) != 0 {
+		t.Fatalf("expected no escrow to be funded, got %d", len(evm.escrows))
+	}
+
+	// Mined again in another block: fund the escrow and record the new block.
+	state, depositTx = newDepositedSwap(t, o, "remined", localcommon.StatusBtcConfirmed)
+	newBlock := chainhash.DoubleHashH([]byte("new block"))
+	btc.reorg(&depositTx, &newBlock)
+	if err := o.fulfillEvmEscrow(ctx, state); err != nil {
+		t.Fatalf("fulfillEvmEscrow failed: %v", err)
+	}
+	if state.Status != localcommon.StatusEvmFulfilled || state.BtcDeposits[0].BlockHash != newBlock.String() {
+		t.Errorf("expected the escrow funded with the deposit in %s, got %s %s", newBlock, state.Status, state.BtcDeposits[0].BlockHash)
+	}
+}
+
+// TestReorgWatchAlertsOnce checks that the background recheck flags a funded
+// swap whose deposit was reorged out, once, without changing its status.
+func TestReorgWatchAlertsOnce(t *testing.T) {
+	o, btc, _ := newFakeOrchestrator(t)
+	ctx := context.Background()
+	state, depositTx := newDepositedSwap(t, o, "funded", localcommon.StatusEvmFulfilled)
+	newDepositedSwap(t, o, "intact", localcommon.StatusEvmFulfilled)
+	alerted := make(map[string]bool)
+
+	o.recheckDeposits(ctx, alerted)
+	if len(alerted) != 0 {
+		t.Fatalf("expected no alerts, got %v", alerted)
+	}
+
+	btc.reorg(&depositTx, nil)
+	o.recheckDeposits(ctx, alerted)
+	o.recheckDeposits(ctx, alerted)
+	if len(alerted) != 1 || !alerted[state.ID] {
+		t.Errorf("expected one alert for %s, got %v", state.ID, alerted)
+	}
+	if state.Status != localcommon.StatusEvmFulfilled {
+		t.Errorf("expected the status to be left alone, got %s", state.Status)
+	}
+
+	// Once mined again the deposit is intact, and the alert is cleared.
+	newBlock := chainhash.DoubleHashH([]byte("new block"))
+	btc.reorg(&depositTx, &newBlock)
+	o.recheckDeposits(ctx, alerted)
+	if len(alerted) != 0 || state.BtcDeposits[0].BlockHash != newBlock.String() {
+		t.Errorf("expected the deposit recorded in %s, got %s %v", newBlock, state.BtcDeposits[0].BlockHash, alerted)
+	}
+}
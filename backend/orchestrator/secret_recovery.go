@@ -0,0 +1,143 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/contracts/settlement"
+)
+
+// ErrSecretRecoveryRequired is returned at startup when the secret seed has
+// derived secrets before but the swap store has no record of it, as after
+// losing the store. Starting anyway would hand out key indexes, and so
+// secrets, claim keys and swap IDs, that earlier swaps still use on-chain.
+var ErrSecretRecoveryRequired = errors.New("swap store does not know the secret seed; start once with SECRET_RECOVERY=true to rebuild it")
+
+// CheckSecretSeed makes sure the store's key indexes were handed out under
+// o.Secrets. A new store is bound to a seed generated by this process; any
+// other seed must first go through RecoverSwapsFromSeed.
+func (o *SwapOrchestrator) CheckSecretSeed() error {
+	id, err := o.Store.SecretSeedID()
+	if err != nil {
+		return fmt.Errorf("failed to read the secret seed ID: %v", err)
+	}
+	switch {
+	case id == nil && o.Secrets.Generated():
+		return o.Store.SetSecretSeedID(o.Secrets.ID())
+	case id == nil:
+		return ErrSecretRecoveryRequired
+	case !bytes.Equal(id, o.Secrets.ID()):
+		return fmt.Errorf("swap store belongs to a different secret seed (%x, not %x)", id, o.Secrets.ID())
+	}
+	return nil
+}
+
+// RecoverSwapsFromSeed rebuilds the swaps whose EVM escrows were funded from
+// the secret seed alone. It derives the secret hash of each key index in turn
+// and looks its escrow up on-chain, until gap indexes in a row have none.
+//
+// The BTC side of a swap cannot be rebuilt: its HTLC also commits to the
+// user's refund key. Recovered swaps are therefore parked in ERROR with their
+// secret and claim key path for manual handling, while the escrow refund job
+// returns any escrow the user never claims. Every scanned index is then
+// skipped, so new swaps cannot reuse one, and the store is bound to the seed.
+func (o *SwapOrchestrator) RecoverSwapsFromSeed(ctx context.Context, gap uint32) error {
+	if gap == 0 {
+		return fmt.Errorf("secret recovery needs a gap of at least one index")
+	}
+	swaps, err := o.Store.LoadSwaps()
+	if err != nil {
+		return fmt.Errorf("failed to load persisted swaps: %v", err)
+	}
+	known := make(map[[32]byte]bool, len(swaps))
+	for _, state := range swaps {
+		known[state.SecretHash] = true
+	}
+
+	recovered := 0
+	next, misses := uint32(0), uint32(0)
+	for ; misses < gap; next++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		secret := o.Secrets.Secret(next)
+		secretHash := sha256.Sum256(secret)
+		escrow, err := o.EvmService.GetEscrow(ctx, secretHash)
+		if err != nil {
+			return fmt.Errorf("failed to look up the escrow of key index %d: %v", next, err)
+		}
+		if escrow.Amount == nil || escrow.Amount.Sign() == 0 {
+			misses++
+			continue
+		}
+		misses = 0
+		if known[secretHash] {
+			continue
+		}
+
+		state, err := o.recoveredSwap(next, secret, secretHash, escrow)
+		if err != nil {
+			return err
+		}
+		if err := o.Store.SaveSwap(state); err != nil {
+			return fmt.Errorf("failed to persist recovered swap %s: %v", state.ID, err)
+		}
+		log.Printf("[RECOVERY] Rebuilt swap %s from key index %d: escrow claimed=%t refunded=%t", state.ID, next, escrow.Claimed, escrow.Refunded)
+		recovered++
+	}
+
+	if err := o.Store.SkipKeyIndexes(next); err != nil {
+		return err
+	}
+	if err := o.Store.SetSecretSeedID(o.Secrets.ID()); err != nil {
+		return err
+	}
+	log.Printf("[RECOVERY] Scanned key indexes 0-%d and rebuilt %d swaps; new swaps start at index %d.", next-1, recovered, next)
+	return nil
+}
+
+// recoveredSwap builds the record of a swap found by RecoverSwapsFromSeed.
+func (o *SwapOrchestrator) recoveredSwap(index uint32, secret []byte, secretHash [32]byte, escrow *settlement.FusionBtcSettlementEscrow) (*SwapState, error) {
+	var claimKeyPath string
+	if o.ClaimKeys != nil {
+		var err error
+		if claimKeyPath, _, err = o.ClaimKeys.NewClaimKey(index); err != nil {
+			return nil, fmt.Errorf("failed to derive claim key %d: %v", index, err)
+		}
+	}
+	var timelock int64
+	if escrow.Timelock != nil {
+		timelock = escrow.Timelock.Int64()
+	}
+	reason := "recovered from the secret seed; the BTC HTLC needs manual handling"
+	now := time.Now()
+	return &SwapState{
+		ID:                 fmt.Sprintf("swap-%x", secretHash[:8]),
+		Status:             localcommon.StatusError,
+		Secret:             secret,
+		SecretHash:         secretHash,
+		SecretIndex:        index,
+		BtcClaimKeyPath:    claimKeyPath,
+		UserEvmAddress:     escrow.User.Hex(),
+		EvmAmount:          escrow.Amount,
+		EvmQuotedAmount:    escrow.Amount,
+		EvmEscrowRecovered: true,
+		EvmEscrowTimelock:  timelock,
+		EvmEscrowClaimed:   escrow.Claimed,
+		EvmEscrowRefunded:  escrow.Refunded,
+		LastError:          reason,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+		History: []localcommon.SwapTransition{{
+			To:     localcommon.StatusError,
+			Reason: reason,
+			At:     now,
+		}},
+	}, nil
+}
@@ -0,0 +1,71 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/contracts/settlement"
+)
+
+// TestCheckSecretSeedRequiresRecovery checks that a used seed is refused with
+// an empty store, and that a store only accepts the seed it was bound to.
+func TestCheckSecretSeedRequiresRecovery(t *testing.T) {
+	o, _, _ := newFakeOrchestrator(t)
+	if err := o.CheckSecretSeed(); !errors.Is(err, ErrSecretRecoveryRequired) {
+		t.Fatalf("expected ErrSecretRecoveryRequired, got %v", err)
+	}
+
+	if err := o.Store.SetSecretSeedID([]byte("other seed")); err != nil {
+		t.Fatalf("SetSecretSeedID failed: %v", err)
+	}
+	if err := o.CheckSecretSeed(); err == nil || errors.Is(err, ErrSecretRecoveryRequired) {
+		t.Errorf("expected a different seed to be refused, got %v", err)
+	}
+}
+
+// TestRecoverSwapsFromSeed loses the store after two swaps funded their
+// escrows, and checks that recovery rebuilds both and never reuses their
+// key indexes.
+func TestRecoverSwapsFromSeed(t *testing.T) {
+	o, _, evm := newFakeOrchestrator(t)
+	for _, index := range []uint32{2, 5} {
+		secretHash := sha256.Sum256(o.Secrets.Secret(index))
+		evm.escrows[secretHash] = &settlement.FusionBtcSettlementEscrow{Amount: big.NewInt(1_000), Timelock: big.NewInt(1_700_000_000), Claimed: index == 5}
+	}
+
+	if err := o.RecoverSwapsFromSeed(context.Background(), 10); err != nil {
+		t.Fatalf("RecoverSwapsFromSeed failed: %v", err)
+	}
+	if err := o.CheckSecretSeed(); err != nil {
+		t.Errorf("expected the store to be bound to the seed, got %v", err)
+	}
+	if next, err := o.Store.NextKeyIndex(); err != nil || next != 16 {
+		t.Errorf("expected new swaps to start past the scanned indexes at 16, got %d %v", next, err)
+	}
+
+	swaps, err := o.Store.LoadSwaps()
+	if err != nil || len(swaps) != 2 {
+		t.Fatalf("expected two recovered swaps, got %d %v", len(swaps), err)
+	}
+	for _, state := range swaps {
+		if state.Status != localcommon.StatusError || sha256.Sum256(state.Secret) != state.SecretHash || state.BtcClaimKeyPath == "" {
+			t.Errorf("unexpected recovered swap %+v", state)
+		}
+		if !bytes.Equal(state.Secret, o.Secrets.Secret(state.SecretIndex)) || escrowNeedsRefund(state) == (state.SecretIndex == 5) {
+			t.Errorf("swap %s recovered with the wrong index or escrow state", state.ID)
+		}
+	}
+
+	// A second run finds nothing new.
+	if err := o.RecoverSwapsFromSeed(context.Background(), 10); err != nil {
+		t.Fatalf("RecoverSwapsFromSeed failed: %v", err)
+	}
+	if swaps, _ := o.Store.LoadSwaps(); len(swaps) != 2 {
+		t.Errorf("expected recovery to skip known swaps, got %d", len(swaps))
+	}
+}
@@ -0,0 +1,114 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	localcommon "fusion-btc-resolver/common"
+)
+
+// ErrInvalidTransition is returned when the lifecycle tries to move a swap
+// along an edge that is not in the transition table.
+var ErrInvalidTransition = errors.New("invalid swap status transition")
+
+// swapTransitions is the complete set of legal status changes. A status that
+// is missing as a key is terminal: nothing may leave it.
+var swapTransitions = map[localcommon.SwapStatus][]localcommon.SwapStatus{
+	localcommon.StatusPendingDeposit: {
+		localcommon.StatusBtcConfirmed,
+		localcommon.StatusRefundPending, // The deposit fell short of the quote and is refunded
+		localcommon.StatusExpired,
+		localcommon.StatusError,
+	},
+	localcommon.StatusBtcConfirmed: {
+		localcommon.StatusPendingDeposit, // The deposit was reorged out before the escrow was funded
+		localcommon.StatusEvmFulfilled,
+		localcommon.StatusRefundPending,
+		localcommon.StatusError,
+	},
+	localcommon.StatusEvmFulfilled: {
+		localcommon.StatusEvmClaimed,
+		localcommon.StatusRefundPending,
+		localcommon.StatusError,
+	},
+	localcommon.StatusEvmClaimed: {
+		localcommon.StatusBtcWithdrawn,
+		localcommon.StatusCompleted,
+		localcommon.StatusError,
+	},
+	localcommon.StatusBtcWithdrawn: {
+		localcommon.StatusCompleted,
+		localcommon.StatusError,
+	},
+	localcommon.StatusRefundPending: {
+		localcommon.StatusRefunded,
+		localcommon.StatusError,
+	},
+}
+
+// validateTransition checks a status change against the transition table.
+func validateTransition(from, to localcommon.SwapStatus) error {
+	for _, allowed := range swapTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q -> %q", ErrInvalidTransition, from, to)
+}
+
+// isTerminalStatus reports whether a swap in this status needs no further work.
+func isTerminalStatus(status localcommon.SwapStatus) bool {
+	return len(swapTransitions[status]) == 0
+}
+
+// canRefund reports whether a swap in this status is, or may still become,
+// due for a BTC refund. Swaps past the EVM claim are paying out instead.
+func canRefund(status localcommon.SwapStatus) bool {
+	return status == localcommon.StatusRefundPending || validateTransition(status, localcommon.StatusRefundPending) == nil
+}
+
+// secretRetired reports whether a swap in this status is done with its
+// secret, which is then wiped. ERROR swaps keep theirs for manual recovery.
+func secretRetired(status localcommon.SwapStatus) bool {
+	return isTerminalStatus(status) && status != localcommon.StatusError
+}
+
+// transition validates and applies a status change, records it in the swap's
+// history and persists the swap. update, if non-nil, runs under the same lock
+// so that the fields a phase produces are saved atomically with its status.
+func (o *SwapOrchestrator) transition(state *SwapState, to localcommon.SwapStatus, reason, txHash string, update func(s *SwapState)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	from := state.Status
+	if err := validateTransition(from, to); err != nil {
+		return err
+	}
+
+	if update != nil {
+		update(state)
+	}
+	if secretRetired(to) {
+		clear(state.Secret)
+		state.Secret = nil
+	}
+	now := time.Now()
+	state.Status = to
+	state.UpdatedAt = now
+	state.History = append(state.History, localcommon.SwapTransition{
+		From:   from,
+		To:     to,
+		Reason: reason,
+		TxHash: txHash,
+		At:     now,
+	})
+
+	if err := o.Store.SaveSwap(state); err != nil {
+		return fmt.Errorf("failed to persist swap %s: %v", state.ID, err)
+	}
+
+	log.Printf("[LIFECYCLE-%s] %s -> %s: %s", state.ID, from, to, reason)
+	return nil
+}
@@ -0,0 +1,103 @@
+package orchestrator
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
+)
+
+// TestValidateTransition checks representative legal and illegal edges.
+func TestValidateTransition(t *testing.T) {
+	cases := []struct {
+		from, to localcommon.SwapStatus
+		valid    bool
+	}{
+		{localcommon.StatusPendingDeposit, localcommon.StatusBtcConfirmed, true},
+		{localcommon.StatusPendingDeposit, localcommon.StatusExpired, true},
+		{localcommon.StatusPendingDeposit, localcommon.StatusCompleted, false},
+		{localcommon.StatusBtcConfirmed, localcommon.StatusEvmClaimed, false},
+		{localcommon.StatusEvmClaimed, localcommon.StatusCompleted, true},
+		{localcommon.StatusCompleted, localcommon.StatusError, false},
+		{localcommon.StatusError, localcommon.StatusPendingDeposit, false},
+	}
+
+	for _, tc := range cases {
+		err := validateTransition(tc.from, tc.to)
+		if tc.valid && err != nil {
+			t.Errorf("%s -> %s: unexpected error %v", tc.from, tc.to, err)
+		}
+		if !tc.valid && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("%s -> %s: expected ErrInvalidTransition, got %v", tc.from, tc.to, err)
+		}
+	}
+}
+
+// TestTransitionRecordsHistory checks that transitions are persisted with their timeline
+// and that an illegal jump leaves the swap untouched.
+func TestTransitionRecordsHistory(t *testing.T) {
+	store := newTestStore(t)
+	o := NewSwapOrchestrator(nil, nil, nil, nil, store, &config.SwapConfig{})
+	state := &SwapState{ID: "swap-history", Status: localcommon.StatusPendingDeposit}
+	o.ActiveSwaps[state.ID] = state
+
+	if err := o.transition(state, localcommon.StatusCompleted, "skip ahead", "", nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition, got %v", err)
+	}
+	if state.Status != localcommon.StatusPendingDeposit || len(state.History) != 0 {
+		t.Fatalf("rejected transition must not modify the swap")
+	}
+
+	if err := o.transition(state, localcommon.StatusBtcConfirmed, "BTC deposit confirmed", "abcd", nil); err != nil {
+		t.Fatalf("transition failed: %v", err)
+	}
+
+	resp, err := o.GetSwapStatus(state.ID)
+	if err != nil {
+		t.Fatalf("GetSwapStatus failed: %v", err)
+	}
+	if len(resp.History) != 1 {
+		t.Fatalf("expected 1 history entry, got %d", len(resp.History))
+	}
+	entry := resp.History[0]
+	if entry.From != localcommon.StatusPendingDeposit || entry.To != localcommon.StatusBtcConfirmed || entry.TxHash != "abcd" || entry.At.IsZero() {
+		t.Errorf("unexpected history entry %+v", entry)
+	}
+
+	swaps, err := store.LoadSwaps()
+	if err != nil || len(swaps) != 1 || len(swaps[0].History) != 1 {
+		t.Fatalf("history was not persisted: %v", err)
+	}
+}
+
+// TestTransitionWipesRetiredSecret checks that a finished swap's secret is
+// zeroed and no longer persisted, while an ERROR swap keeps its own.
+func TestTransitionWipesRetiredSecret(t *testing.T) {
+	store := newTestStore(t)
+	o := NewSwapOrchestrator(nil, nil, nil, nil, store, &config.SwapConfig{})
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	finished := &SwapState{ID: "swap-finished", Status: localcommon.StatusRefundPending, Secret: secret}
+	failed := &SwapState{ID: "swap-failed", Status: localcommon.StatusRefundPending, Secret: []byte("fedcba9876543210fedcba9876543210")}
+
+	if err := o.transition(finished, localcommon.StatusRefunded, "refund confirmed", "", nil); err != nil {
+		t.Fatalf("transition failed: %v", err)
+	}
+	if err := o.transition(failed, localcommon.StatusError, "refund failed", "", nil); err != nil {
+		t.Fatalf("transition failed: %v", err)
+	}
+	if finished.Secret != nil || !bytes.Equal(secret, make([]byte, len(secret))) {
+		t.Error("expected the refunded swap's secret to be zeroed")
+	}
+
+	swaps, err := store.LoadSwaps()
+	if err != nil {
+		t.Fatalf("LoadSwaps failed: %v", err)
+	}
+	for _, state := range swaps {
+		if (state.ID == finished.ID) != (state.Secret == nil) {
+			t.Errorf("swap %s persisted with secret %x", state.ID, state.Secret)
+		}
+	}
+}
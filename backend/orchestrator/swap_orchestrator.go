@@ -11,8 +11,9 @@ Bitcoin and EVM services what to do and when, based on the current state of
 the swap.
 
 KEY RESPONSIBILITIES:
-- Managing an in-memory store of active swaps (for a hackathon; a production
-  system would use a persistent database like Redis or PostgreSQL).
+- Keeping every swap in a durable SwapStore (see swap_store.go) so that a
+  restart never loses an in-flight swap or its secret, and resuming each
+  swap's lifecycle from its last persisted phase on startup.
 - Handling the initial swap request: generating secrets, creating the HTLC
   parameters via the BtcHtlcService, and storing the initial state.
 - Launching a dedicated background process (goroutine) for each swap to manage
@@ -22,7 +23,14 @@ KEY RESPONSIBILITIES:
   2. Once confirmed, deposit corresponding funds into the EVM escrow.
   3. Monitor for the user's claim on the EVM chain to reveal the secret.
   4. Use the revealed secret to claim the user's BTC.
-- Handling timeout and error conditions to trigger refunds.
+- Handling timeout and error conditions to trigger refunds: a swap whose EVM
+  leg fails is parked in REFUND_PENDING and its user-signed BTC refund is
+  broadcast, and retried until confirmed, once the HTLC timelock expires
+  (see btc_refund.go). EVM escrows the user never claimed are refunded to the
+  resolver by a background job once their timelock passes (see escrow_refund.go).
+- Shutting down cleanly: Shutdown refuses new swaps, cancels the context every
+  lifecycle goroutine runs under, and waits for each swap to stop at its last
+  durable checkpoint, from which ResumeSwaps picks it up on the next start.
 
 */
 
@@ -30,108 +38,442 @@ package orchestrator
 
 import (
 	"bytes"
-	"crypto/rand"
+	"context"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
 	"sync"
 	"time"
 
-	// "github.com/btcsuite/btcd/chaincfg"
-	// "github.com/btcsuite/btcutil"
-
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/ethereum/go-ethereum/common"
 
 	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
 	"fusion-btc-resolver/services"
 )
 
 // SwapState holds all the information for a single, ongoing swap.
+// Every field is persisted by the SwapStore, so anything the lifecycle needs
+// to resume after a restart must live here.
 type SwapState struct {
 	ID                    string
 	Status                localcommon.SwapStatus
 	Secret                []byte
 	SecretHash            [32]byte
+	SecretIndex           uint32 // Key index the secret and claim key were derived at
 	BtcDepositAddress     string
 	BtcHtlcScript         []byte
-	BtcDestinationAddress string  // Where to send the Bitcoin
-	BtcAmount             float64 // Amount of BTC to send
-	// ... other necessary fields like user addresses, amounts, etc.
+	BtcClaimKeyPath       string                       // Derivation path of the resolver's claim key in the HTLC; empty for BTC_CLAIM_KEY
+	BtcAddressType        localcommon.HtlcAddressType  // How BtcDepositAddress commits to BtcHtlcScript; empty means P2SH
+	BtcLockTime           int64                        // Block height after which the HTLC refund branch opens; for CSV, an estimate until the deposit confirms
+	BtcTimelockType       localcommon.HtlcTimelockType // How the refund branch is timelocked; empty means CLTV
+	BtcCsvDelay           int64                        // CSV only: refund delay in blocks after the deposit confirms
+	BtcDestinationAddress string                       // Where to send the Bitcoin
+	BtcAmount             btcutil.Amount               `json:"BtcAmountSats"`       // Amount of BTC to send, in satoshis
+	BtcQuotedAmount       btcutil.Amount               `json:"BtcQuotedAmountSats"` // Amount the user was asked to deposit; BtcAmount follows the deposit outcome
+	UserEvmAddress        string                       // Where the EVM escrow pays out
+	EvmAmount             *big.Int                     `json:"EvmAmountWei"`       // Amount the EVM escrow pays, in wei; scaled with BtcAmount
+	EvmQuotedAmount       *big.Int                     `json:"EvmQuotedAmountWei"` // Amount quoted for BtcQuotedAmount, in wei
+	ExpiresAt             time.Time
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+
+	// Checkpoints recorded as the lifecycle progresses.
+	BtcDeposits             []DepositUtxo              // Confirmed outputs of the user's HTLC deposit
+	BtcReceivedAmount       btcutil.Amount             `json:"BtcReceivedAmountSats"` // Total of BtcDeposits
+	DepositOutcome          localcommon.DepositOutcome // How the deposit compared to BtcQuotedAmount
+	EvmEscrowTxHash         string
+	EvmClaimScanBlock       uint64 // Next EVM block to scan for the SecretRevealed event
+	BtcPayoutStarted        bool   // Set before the payout is broadcast, so a crash can never pay twice
+	BtcPayoutTxHash         string
+	BtcSurplusRefundStarted bool // Likewise for paying back an overpayment's surplus
+	BtcSurplusRefundTxHash  string
+	LastError               string
+
+	// EVM escrow outcome, maintained by the escrow refund job.
+	EvmEscrowTimelock     int64 // Unix time after which the resolver may refund the escrow, planned at initiation
+	EvmEscrowRecovered    bool  // Escrow found on-chain by RecoverSwapsFromSeed; its funding tx is unknown
+	EvmEscrowClaimed      bool
+	EvmEscrowRefunded     bool
+	EvmEscrowAbsent       bool // No escrow existed on-chain once it expired, as in demo mode, so there is nothing to refund
+	EvmEscrowRefundTxHash string
+
+	// Refund tracking for swaps whose EVM leg failed.
+	SignedRefundTx    string // User-signed refund tx, hex encoded
+	RefundTxHash      string
+	RefundAttempts    int
+	LastRefundAttempt time.Time
+
+	History []localcommon.SwapTransition // Every validated status change, oldest first
+}
+
+// DepositUtxo is one confirmed output of a swap's HTLC deposit.
+type DepositUtxo struct {
+	TxHash    string
+	Vout      uint32
+	Amount    btcutil.Amount `json:"AmountSats"`
+	BlockHash string         // Block that confirmed it, rechecked for reorgs
+}
+
+// depositTxHashes returns the distinct transactions a swap's deposit was paid
+// in, in order. The caller must hold o.mu or own the state.
+func (s *SwapState) depositTxHashes() []string {
+	var hashes []string
+	seen := make(map[string]bool)
+	for _, utxo := range s.BtcDeposits {
+		if !seen[utxo.TxHash] {
+			seen[utxo.TxHash] = true
+			hashes = append(hashes, utxo.TxHash)
+		}
+	}
+	return hashes
 }
 
 // SwapOrchestrator manages the lifecycle of all swaps.
 type SwapOrchestrator struct {
-	BtcService  *services.BtcHtlcService
-	EvmService  *services.EvmService
+	BtcService  services.BtcChain
+	EvmService  services.EvmChain
+	ClaimKeys   *services.ClaimKeyring
+	Secrets     *services.SecretSeed
+	Store       SwapStore
+	cfg         *config.SwapConfig
+	planner     *TimelockPlanner
 	ActiveSwaps map[string]*SwapState
-	mu          sync.Mutex // Mutex to protect access to the activeSwaps map
+	mu          sync.Mutex // Mutex to protect access to the activeSwaps map and swap states
+
+	ctx     context.Context    // Cancelled by Shutdown; every lifecycle goroutine runs under it
+	cancel  context.CancelFunc // Cancels ctx
+	wg      sync.WaitGroup     // Tracks lifecycle goroutines and background jobs
+	closing bool               // Set by Shutdown; no new swaps are accepted afterwards
 }
 
+// ErrShuttingDown is returned for new swaps once Shutdown has been called.
+var ErrShuttingDown = errors.New("swap orchestrator is shutting down")
+
+// ErrUnsupportedAddressType is returned for swaps requesting an unknown HTLC address type.
+var ErrUnsupportedAddressType = errors.New("unsupported HTLC address type")
+
+// ErrUnsupportedTimelockType is returned for swaps requesting an unknown HTLC timelock type.
+var ErrUnsupportedTimelockType = errors.New("unsupported HTLC timelock type")
+
+// ErrInvalidDestination is returned for swaps whose BTC destination address
+// is malformed or belongs to a different network than the resolver's.
+var ErrInvalidDestination = errors.New("invalid BTC destination address")
+
+// ErrInvalidRefundPubKey is returned for swaps whose user refund key is not a
+// compressed secp256k1 public key.
+var ErrInvalidRefundPubKey = errors.New("invalid user BTC refund public key")
+
+// ErrInvalidEvmAddress is returned for swaps whose EVM payout address is not
+// a hex address.
+var ErrInvalidEvmAddress = errors.New("invalid user EVM address")
+
+// ErrInvalidEvmAmount is returned for swaps quoted for a zero or negative
+// EVM amount.
+var ErrInvalidEvmAmount = errors.New("invalid EVM amount")
+
+// ErrSwapNotFound is returned for requests naming an unknown swap.
+var ErrSwapNotFound = errors.New("swap not found")
+
+// ErrNoDeposit is returned for refund PSBTs requested while the swap's HTLC
+// holds no unspent deposit.
+var ErrNoDeposit = errors.New("swap has no unspent BTC deposit")
+
+// ErrInvalidRefundRequest is returned for refund PSBT requests with a
+// malformed refund address or fee rate.
+var ErrInvalidRefundRequest = errors.New("invalid refund PSBT request")
+
 // NewSwapOrchestrator creates a new instance of the orchestrator.
-func NewSwapOrchestrator(btc *services.BtcHtlcService, evm *services.EvmService) *SwapOrchestrator {
+// It depends only on the BtcChain and EvmChain interfaces, so any backend
+// (or an in-memory fake in tests) can drive the swap lifecycle.
+// claimKeys supplies the resolver's HTLC claim keys and is only needed to
+// initiate and fund swaps; secrets derives swap secrets and is only needed to
+// initiate swaps and to recover lost secrets.
+func NewSwapOrchestrator(btc services.BtcChain, evm services.EvmChain, claimKeys *services.ClaimKeyring, secrets *services.SecretSeed, store SwapStore, cfg *config.SwapConfig) *SwapOrchestrator {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &SwapOrchestrator{
 		BtcService:  btc,
 		EvmService:  evm,
+		ClaimKeys:   claimKeys,
+		Secrets:     secrets,
+		Store:       store,
+		cfg:         cfg,
+		planner:     NewTimelockPlanner(cfg),
 		ActiveSwaps: make(map[string]*SwapState),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// ResumeSwaps loads every persisted swap and restarts the lifecycle of those
+// that have not reached a terminal status. It must be called once at startup,
+// before the API starts accepting requests.
+func (o *SwapOrchestrator) ResumeSwaps() error {
+	swaps, err := o.Store.LoadSwaps()
+	if err != nil {
+		return fmt.Errorf("failed to load persisted swaps: %v", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	resumed := 0
+	for _, state := range swaps {
+		if err := o.recoverSecret(state); err != nil {
+			return err
+		}
+		o.ActiveSwaps[state.ID] = state
+		if isTerminalStatus(state.Status) {
+			continue
+		}
+		log.Printf("[ORCHESTRATOR] Resuming swap %s from status %s", state.ID, state.Status)
+		o.launch(func(ctx context.Context) { o.runSwapLifecycle(ctx, state) })
+		resumed++
+	}
+
+	log.Printf("[ORCHESTRATOR] Loaded %d persisted swaps, resumed %d in-flight.", len(swaps), resumed)
+	return nil
+}
+
+// recoverSecret re-derives the secret of a swap whose persisted secret was
+// lost or does not match its hash, and persists it again. Swaps predating the
+// secret seed cannot be recovered and are left to their refund paths.
+func (o *SwapOrchestrator) recoverSecret(state *SwapState) error {
+	if secretRetired(state.Status) || sha256.Sum256(state.Secret) == state.SecretHash {
+		return nil
+	}
+	if o.Secrets == nil {
+		log.Printf("[ORCHESTRATOR] WARNING: secret of swap %s is lost and no secret seed is configured", state.ID)
+		return nil
+	}
+	secret := o.Secrets.Secret(state.SecretIndex)
+	if sha256.Sum256(secret) != state.SecretHash {
+		log.Printf("[ORCHESTRATOR] WARNING: secret of swap %s is lost and not derived from the secret seed", state.ID)
+		return nil
+	}
+	state.Secret = secret
+	if err := o.Store.SaveSwap(state); err != nil {
+		return fmt.Errorf("failed to persist recovered secret of swap %s: %v", state.ID, err)
+	}
+	log.Printf("[ORCHESTRATOR] Recovered secret of swap %s from the secret seed", state.ID)
+	return nil
+}
+
+// launch runs fn in a goroutine tracked by Shutdown, under the orchestrator's
+// context. The caller must hold o.mu and have checked o.closing.
+func (o *SwapOrchestrator) launch(fn func(ctx context.Context)) {
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		fn(o.ctx)
+	}()
+}
+
+// Shutdown stops accepting new swaps, cancels every lifecycle goroutine and
+// background job, and waits for them to return. Each swap stops at its last
+// persisted checkpoint and is resumed by ResumeSwaps on the next start. If ctx
+// expires first, Shutdown returns without waiting for the stragglers.
+func (o *SwapOrchestrator) Shutdown(ctx context.Context) error {
+	o.mu.Lock()
+	o.closing = true
+	o.mu.Unlock()
+
+	o.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("[ORCHESTRATOR] All swap lifecycles stopped at a durable checkpoint.")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for swap lifecycles to stop: %w", ctx.Err())
 	}
 }
 
 // InitiateSwapWithAmount sets up a new swap with the specified BTC amount and starts its lifecycle management.
-func (o *SwapOrchestrator) InitiateSwapWithAmount(req *localcommon.SwapRequest, btcAmount float64) (*localcommon.SwapResponse, error) {
+// The EVM escrow pays evmAmount wei to req.UserEvmAddress for a deposit of
+// exactly btcAmount. ctx bounds the chain queries made while setting the swap up; the lifecycle
+// itself runs until the swap finishes or the orchestrator shuts down.
+func (o *SwapOrchestrator) InitiateSwapWithAmount(ctx context.Context, req *localcommon.SwapRequest, btcAmount btcutil.Amount, evmAmount *big.Int) (*localcommon.SwapResponse, error) {
+	addrType := req.AddressType
+	switch addrType {
+	case "":
+		addrType = localcommon.HtlcP2SH
+	case localcommon.HtlcP2SH, localcommon.HtlcP2WSH, localcommon.HtlcP2TR:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAddressType, addrType)
+	}
+	timelockType := req.TimelockType
+	switch timelockType {
+	case "":
+		timelockType = localcommon.HtlcCLTV
+	case localcommon.HtlcCLTV, localcommon.HtlcCSV:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedTimelockType, timelockType)
+	}
+
+	// Catch a destination on the wrong network now, not at payout time.
+	if _, err := services.DecodeAddressForNet(req.BtcDestinationAddress, o.BtcService.NetParams()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDestination, err)
+	}
+	if !common.IsHexAddress(req.UserEvmAddress) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidEvmAddress, req.UserEvmAddress)
+	}
+	if evmAmount == nil || evmAmount.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvmAmount, evmAmount)
+	}
+	// The refund branch is the user's only way back, so it must be spendable.
+	userRefundPubKey, err := services.ParseRefundPubKey(req.UserBtcRefundPubkey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefundPubKey, err)
+	}
+
+	// 1. Plan both legs' timelocks from the current state of each chain,
+	// refusing the swap if they cannot be ordered safely.
+	plan, err := o.planTimelocks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A fresh key index per swap. Its claim key path is persisted to sign the
+	// claim, and its secret can be re-derived from the seed if it is lost.
+	keyIndex, err := o.Store.NextKeyIndex()
+	if err != nil {
+		return nil, err
+	}
+	claimKeyPath, resolverClaimPubKey, err := o.ClaimKeys.NewClaimKey(keyIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive claim key: %v", err)
+	}
+
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
-	// 1. Generate a new secret and its hash
-	secret := make([]byte, 32)
-	if _, err := rand.Read(secret); err != nil {
-		return nil, fmt.Errorf("failed to generate secret: %v", err)
+	if o.closing {
+		return nil, ErrShuttingDown
 	}
+
+	// 2. Derive the swap's secret and its hash
+	secret := o.Secrets.Secret(keyIndex)
 	secretHash := sha256.Sum256(secret)
 
-	// 2. Create the HTLC via the Bitcoin service
-	// Note: Public keys would need to be derived from user-provided data or resolver config.
-	// These are placeholders for the demonstration.
-	var mockUserBtcPubkey, mockResolverBtcPubkey []byte
-	var mockLockTime int64 = 100 // blocks in the future
+	// 3. Create the HTLC via the Bitcoin service
+	// A CSV refund opens a fixed number of blocks after the deposit confirms,
+	// however late in the deposit window that is, so a late deposit does not
+	// shrink the margin after the EVM escrow expires the way CLTV's fixed
+	// height does. Until the deposit confirms, BtcLockTime is the earliest
+	// height the refund could open.
+	lockValue, csvDelay, cltvLockTime := plan.BtcLockHeight, int64(0), plan.BtcLockHeight
+	if timelockType == localcommon.HtlcCSV {
+		lockValue, csvDelay, cltvLockTime = o.cfg.BtcLockBlocks, o.cfg.BtcLockBlocks, 0
+	}
 
 	htlcScript, htlcAddress, err := o.BtcService.CreateHtlc(
-		mockUserBtcPubkey,
-		mockResolverBtcPubkey,
+		userRefundPubKey,
+		resolverClaimPubKey,
 		secretHash[:],
-		mockLockTime,
+		lockValue,
+		timelockType,
+		addrType,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create BTC HTLC: %v", err)
 	}
 
-	// 3. Create and store the initial state for the swap
+	// Never hand out an address without checking what it commits to: the
+	// script must derive the address and pay the secret hash and keys above.
+	// A P2TR internal key can spend the whole deposit on its own, so it must
+	// be exactly the one the configured mode calls for.
+	var internalKey []byte
+	if addrType == localcommon.HtlcP2TR {
+		internalKey, err = services.TaprootInternalKey(userRefundPubKey, resolverClaimPubKey, o.BtcService.TaprootKeyMode())
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive taproot internal key: %v", err)
+		}
+	}
+	err = services.VerifyHtlc(htlcAddress, htlcScript, addrType, o.BtcService.NetParams(), &services.HtlcParams{
+		SecretHash:   secretHash[:],
+		ClaimPubKey:  resolverClaimPubKey,
+		RefundPubKey: userRefundPubKey,
+		LockTime:     lockValue,
+		TimelockType: timelockType,
+		InternalKey:  internalKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("BTC HTLC failed verification: %v", err)
+	}
+
+	// 4. Create and store the initial state for the swap
 	swapID := fmt.Sprintf("swap-%x", secretHash[:8])
 
-	log.Printf("[ORCHESTRATOR] Using BTC amount from quote: %.8f BTC", btcAmount)
+	log.Printf("[ORCHESTRATOR] Using BTC amount from quote: %s", btcAmount)
 
+	now := time.Now()
 	state := &SwapState{
 		ID:                    swapID,
 		Status:                localcommon.StatusPendingDeposit,
 		Secret:                secret,
 		SecretHash:            secretHash,
+		SecretIndex:           keyIndex,
 		BtcDepositAddress:     htlcAddress.EncodeAddress(),
 		BtcHtlcScript:         htlcScript,
+		BtcClaimKeyPath:       claimKeyPath,
+		BtcAddressType:        addrType,
+		BtcLockTime:           plan.BtcLockHeight,
+		BtcTimelockType:       timelockType,
+		BtcCsvDelay:           csvDelay,
 		BtcDestinationAddress: req.BtcDestinationAddress, // Store where to send Bitcoin
 		BtcAmount:             btcAmount,                 // Store how much to send
+		BtcQuotedAmount:       btcAmount,
+		UserEvmAddress:        common.HexToAddress(req.UserEvmAddress).Hex(),
+		EvmAmount:             new(big.Int).Set(evmAmount),
+		EvmQuotedAmount:       new(big.Int).Set(evmAmount),
+		ExpiresAt:             now.Add(o.cfg.DepositWindow),
+		EvmEscrowTimelock:     plan.EvmTimelock.Unix(),
+		CreatedAt:             now,
+		UpdatedAt:             now,
+		History: []localcommon.SwapTransition{{
+			To:     localcommon.StatusPendingDeposit,
+			Reason: "swap initiated",
+			At:     now,
+		}},
+	}
+
+	// The secret must be durable before the deposit address is handed out,
+	// otherwise a crash could leave user funds locked behind a lost preimage.
+	if err := o.Store.SaveSwap(state); err != nil {
+		return nil, fmt.Errorf("failed to persist swap: %v", err)
 	}
 	o.ActiveSwaps[swapID] = state
 
 	log.Printf("[ORCHESTRATOR] New swap initiated. ID: %s, BTC Deposit Address: %s", swapID, htlcAddress.EncodeAddress())
 
-	// 4. Launch the background lifecycle manager for this swap
-	go o.runSwapLifecycle(state)
+	// 5. Launch the background lifecycle manager for this swap
+	o.launch(func(ctx context.Context) { o.runSwapLifecycle(ctx, state) })
 
-	// 5. Return the deposit details to the user
+	// 6. Return the deposit details to the user
 	return &localcommon.SwapResponse{
 		SwapID:            swapID,
 		BtcDepositAddress: htlcAddress.EncodeAddress(),
-		ExpiresAt:         time.Now().Add(1 * time.Hour), // Example expiration
+		AddressType:       addrType,
+		TimelockType:      timelockType,
+		RefundDelay:       csvDelay,
+		LockTime:          cltvLockTime,
+		RedeemScript:      hex.EncodeToString(htlcScript),
+		ExpiresAt:         state.ExpiresAt,
 	}, nil
 }
 
@@ -142,100 +484,549 @@ func (o *SwapOrchestrator) GetSwapStatus(swapID string) (*localcommon.SwapStatus
 
 	state, ok := o.ActiveSwaps[swapID]
 	if !ok {
-		return nil, fmt.Errorf("swap with ID %s not found", swapID)
+		return nil, fmt.Errorf("%w: %s", ErrSwapNotFound, swapID)
 	}
 
+	history := make([]localcommon.SwapTransition, len(state.History))
+	copy(history, state.History)
+
 	return &localcommon.SwapStatusResponse{
 		SwapID:  swapID,
 		Status:  state.Status,
 		Message: fmt.Sprintf("Swap is currently in state: %s", state.Status),
+		Deposit: depositSummary(state),
+		History: history,
 	}, nil
 }
 
+// planTimelocks derives a safe timelock plan from both chains' current state.
+func (o *SwapOrchestrator) planTimelocks(ctx context.Context) (*TimelockPlan, error) {
+	btcTip, err := o.BtcService.CurrentHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	evmNow, err := o.EvmService.LatestBlockTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return o.planner.Plan(btcTip, evmNow)
+}
+
+// validateTimelocks re-checks a swap's planned timelocks against both chains.
+func (o *SwapOrchestrator) validateTimelocks(ctx context.Context, state *SwapState) error {
+	btcTip, err := o.BtcService.CurrentHeight(ctx)
+	if err != nil {
+		return err
+	}
+	evmNow, err := o.EvmService.LatestBlockTime(ctx)
+	if err != nil {
+		return err
+	}
+	plan := &TimelockPlan{
+		BtcLockHeight: state.BtcLockTime,
+		EvmTimelock:   time.Unix(state.EvmEscrowTimelock, 0),
+	}
+	return o.planner.Validate(plan, btcTip, evmNow)
+}
+
+// checkpoint applies update to a swap under the orchestrator lock and persists
+// the result, without changing its status. Status changes go through
+// transition instead. The lifecycle only moves on once its checkpoint is
+// durable, which is what makes ResumeSwaps safe.
+func (o *SwapOrchestrator) checkpoint(state *SwapState, update func(s *SwapState)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	update(state)
+	state.UpdatedAt = time.Now()
+	if err := o.Store.SaveSwap(state); err != nil {
+		return fmt.Errorf("failed to persist swap %s: %v", state.ID, err)
+	}
+	return nil
+}
+
+// RecordTxReplacement points any swap whose payout, surplus refund or refund
+// was oldHash at newHash, after a fee bump replaced the transaction.
+func (o *SwapOrchestrator) RecordTxReplacement(oldHash, newHash chainhash.Hash) {
+	old := oldHash.String()
+	o.mu.Lock()
+	var affected []*SwapState
+	for _, state := range o.ActiveSwaps {
+		if state.BtcPayoutTxHash == old || state.BtcSurplusRefundTxHash == old || state.RefundTxHash == old {
+			affected = append(affected, state)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, state := range affected {
+		log.Printf("[LIFECYCLE-%s] BTC tx %s was replaced by %s", state.ID, old, newHash)
+		err := o.checkpoint(state, func(s *SwapState) {
+			if s.BtcPayoutTxHash == old {
+				s.BtcPayoutTxHash = newHash.String()
+			}
+			if s.BtcSurplusRefundTxHash == old {
+				s.BtcSurplusRefundTxHash = newHash.String()
+			}
+			if s.RefundTxHash == old {
+				s.RefundTxHash = newHash.String()
+			}
+		})
+		if err != nil {
+			log.Printf("[LIFECYCLE-%s] ERROR: %v", state.ID, err)
+		}
+	}
+}
+
+// fail moves a swap to the error status, recording why.
+func (o *SwapOrchestrator) fail(state *SwapState, cause error) {
+	log.Printf("[LIFECYCLE-%s] ERROR: %v", state.ID, cause)
+	err := o.transition(state, localcommon.StatusError, cause.Error(), "", func(s *SwapState) {
+		s.LastError = cause.Error()
+	})
+	if err != nil {
+		log.Printf("[LIFECYCLE-%s] ERROR: %v", state.ID, err)
+	}
+}
+
 // runSwapLifecycle is the core state machine for a single swap.
-// It runs in a dedicated goroutine.
-func (o *SwapOrchestrator) runSwapLifecycle(state *SwapState) {
-	log.Printf("[LIFECYCLE-%s] Starting lifecycle management.", state.ID)
-
-	// === Phase 1: Wait for BTC Deposit ===
-	state.Status = localcommon.StatusPendingDeposit
-	// In a real app, amounts would come from the quote request
-	// Demo: Simulate BTC deposit detection for testing
-	log.Printf("[LIFECYCLE-%s] Demo: Simulating BTC deposit detection...", state.ID)
-	time.Sleep(2 * time.Second) // Simulate monitoring delay
-
-	// Mock transaction hash for demo
-	mockTxHash := "demo-btc-tx-hash-12345"
-	log.Printf("[LIFECYCLE-%s] Demo: Simulated BTC deposit detected", state.ID)
-
-	// Remove the orphaned error check since we're simulating success
-	log.Printf("[LIFECYCLE-%s] BTC deposit confirmed. TxHash: %s", state.ID, mockTxHash)
-	state.Status = localcommon.StatusBtcConfirmed
-
-	// === Phase 2: Fulfill on EVM Chain ===
-
-	// Convert user address to proper Ethereum address type and amounts to big.Int
-	userAddr := common.HexToAddress("0x742d35Cc6b29d7d8a1b8d8D0c3B7f1234567890") // Demo user address
-	amount := big.NewInt(1000000)                                                // Demo amount in wei
-	lockTime := big.NewInt(time.Now().Add(24 * time.Hour).Unix())                // 24 hour timeout
-
-	_, evmErr := o.EvmService.DepositIntoEscrow(userAddr, amount, state.SecretHash, lockTime)
-	if evmErr != nil {
-		log.Printf("[LIFECYCLE-%s] ERROR: Failed to deposit into EVM escrow: %v", state.ID, evmErr)
-		state.Status = localcommon.StatusError
-		// Here you would trigger a refund on the BTC side.
-		return
+// It runs in a dedicated goroutine and picks up from whatever phase the swap
+// last persisted, so it serves both new swaps and swaps resumed after a restart.
+// When ctx is cancelled the current phase is abandoned and the swap is left at
+// its last checkpoint rather than failed.
+func (o *SwapOrchestrator) runSwapLifecycle(ctx context.Context, state *SwapState) {
+	log.Printf("[LIFECYCLE-%s] Starting lifecycle management from status %s.", state.ID, state.Status)
+
+	for !isTerminalStatus(state.Status) {
+		var err error
+		switch state.Status {
+		case localcommon.StatusPendingDeposit:
+			err = o.awaitBtcDeposit(ctx, state)
+		case localcommon.StatusBtcConfirmed:
+			err = o.fulfillEvmEscrow(ctx, state)
+		case localcommon.StatusEvmFulfilled:
+			err = o.awaitEvmClaim(ctx, state)
+		case localcommon.StatusEvmClaimed:
+			err = o.deliverBtc(ctx, state)
+		case localcommon.StatusBtcWithdrawn:
+			err = o.confirmBtcPayout(ctx, state)
+		case localcommon.StatusRefundPending:
+			err = o.refundBtc(ctx, state)
+		default:
+			err = fmt.Errorf("no lifecycle phase handles status %s", state.Status)
+		}
+
+		if err != nil && ctx.Err() != nil {
+			log.Printf("[LIFECYCLE-%s] Stopping at status %s for shutdown.", state.ID, state.Status)
+			return
+		}
+		if err != nil {
+			o.fail(state, err)
+			return
+		}
+	}
+
+	log.Printf("[LIFECYCLE-%s] Lifecycle finished with status %s.", state.ID, state.Status)
+}
+
+// === Phase 1: Wait for BTC Deposit ===
+func (o *SwapOrchestrator) awaitBtcDeposit(ctx context.Context, state *SwapState) error {
+	htlcAddress, err := services.DecodeAddressForNet(state.BtcDepositAddress, o.BtcService.NetParams())
+	if err != nil {
+		return fmt.Errorf("invalid HTLC deposit address %s: %v", state.BtcDepositAddress, err)
+	}
+	expectedAmount := state.BtcQuotedAmount
+	if expectedAmount <= 0 {
+		return fmt.Errorf("invalid BTC amount %d sat", expectedAmount)
+	}
+
+	log.Printf("[LIFECYCLE-%s] Waiting for BTC deposit until %s...", state.ID, state.ExpiresAt.Format(time.RFC3339))
+	deposit, err := o.BtcService.MonitorForDeposit(ctx, htlcAddress, expectedAmount, state.ExpiresAt)
+	if errors.Is(err, services.ErrDepositExpired) {
+		return o.transition(state, localcommon.StatusExpired, "no BTC deposit before expiry", "", nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to detect BTC deposit: %v", err)
+	}
+
+	log.Printf("[LIFECYCLE-%s] BTC deposit confirmed: %s in %d outputs", state.ID, deposit.Total, len(deposit.Utxos))
+
+	// The confirming blocks are recorded so that a reorg can be detected
+	// later. A CSV refund can only spend every output once the last of them
+	// has matured.
+	utxos := make([]DepositUtxo, len(deposit.Utxos))
+	blocks := make(map[chainhash.Hash]string)
+	var lastHeight int64
+	for i, u := range deposit.Utxos {
+		txHash := u.OutPoint.Hash
+		if _, ok := blocks[txHash]; !ok {
+			blockHash, err := o.BtcService.GetTxBlock(ctx, &txHash)
+			if err != nil {
+				return fmt.Errorf("failed to look up the block of deposit %s: %v", txHash, err)
+			}
+			if blockHash != nil {
+				blocks[txHash] = blockHash.String()
+			} else {
+				blocks[txHash] = ""
+			}
+			if state.BtcTimelockType == localcommon.HtlcCSV {
+				height, err := o.confirmationHeight(ctx, &txHash)
+				if err != nil {
+					return err
+				}
+				lastHeight = max(lastHeight, height)
+			}
+		}
+		utxos[i] = DepositUtxo{TxHash: txHash.String(), Vout: u.OutPoint.Index, Amount: u.Amount, BlockHash: blocks[txHash]}
+	}
+
+	lockTime := state.BtcLockTime
+	if state.BtcTimelockType == localcommon.HtlcCSV {
+		lockTime = lastHeight + state.BtcCsvDelay
+		log.Printf("[LIFECYCLE-%s] Deposit confirmed by block %d, CSV refund opens at block %d", state.ID, lastHeight, lockTime)
+	}
+
+	outcome, swapAmount, err := o.depositOutcome(expectedAmount, deposit.Total)
+	if err != nil {
+		return err
+	}
+	update := func(s *SwapState) {
+		s.BtcDeposits = utxos
+		s.BtcReceivedAmount = deposit.Total
+		s.DepositOutcome = outcome
+		s.BtcAmount = swapAmount
+		s.EvmAmount = evmAmountFor(s, swapAmount)
+		s.BtcLockTime = lockTime
+	}
+
+	txHash := utxos[0].TxHash
+	reason := "BTC deposit confirmed"
+	if outcome != localcommon.DepositExact {
+		reason = fmt.Sprintf("BTC deposit confirmed with %s of %s quoted: %s", deposit.Total, expectedAmount, outcome)
+	}
+	if outcome == localcommon.DepositUnderpaidRefunded {
+		log.Printf("[LIFECYCLE-%s] Deposit underpaid, scheduling a refund after block %d", state.ID, lockTime)
+		return o.transition(state, localcommon.StatusRefundPending, reason, txHash, func(s *SwapState) {
+			update(s)
+			s.LastError = reason
+		})
+	}
+	return o.transition(state, localcommon.StatusBtcConfirmed, reason, txHash, update)
+}
+
+// confirmationHeight returns the height of the block that confirmed a
+// transaction. Confirmations are read before the tip, so a block found in
+// between can only push the result later, never make a refund look open early.
+func (o *SwapOrchestrator) confirmationHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	confirmations, err := o.BtcService.GetConfirmations(ctx, txHash)
+	if err != nil {
+		return 0, err
+	}
+	if confirmations < 1 {
+		return 0, fmt.Errorf("deposit %s is not confirmed", txHash)
+	}
+	tip, err := o.BtcService.CurrentHeight(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return tip - confirmations + 1, nil
+}
+
+// === Phase 2: Fulfill on EVM Chain ===
+func (o *SwapOrchestrator) fulfillEvmEscrow(ctx context.Context, state *SwapState) error {
+	if !common.IsHexAddress(state.UserEvmAddress) || state.EvmAmount == nil || state.EvmAmount.Sign() <= 0 {
+		return o.scheduleBtcRefund(state, fmt.Errorf("swap has no EVM escrow terms: address %q, amount %v wei", state.UserEvmAddress, state.EvmAmount))
+	}
+	userAddr := common.HexToAddress(state.UserEvmAddress)
+	amount := new(big.Int).Set(state.EvmAmount)
+	lockTime := big.NewInt(state.EvmEscrowTimelock)
+
+	// Never fund an escrow for BTC the resolver could not claim, as when the
+	// claim key material changed since the swap was initiated.
+	if _, err := o.claimKey(state); err != nil {
+		return o.scheduleBtcRefund(state, err)
+	}
+
+	// The BTC chain may have advanced while we waited for the deposit. Never
+	// fund an escrow whose expiry no longer leaves room to claim the BTC.
+	if err := o.validateTimelocks(ctx, state); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return o.scheduleBtcRefund(state, err)
+	}
+
+	// The escrow cannot be created, let alone claimed, before the current
+	// block, so the claim monitor starts scanning from here.
+	scanFrom, err := o.EvmService.LatestBlockNumber(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return o.scheduleBtcRefund(state, err)
+	}
+
+	// A reorg may have undone the deposit since it was accepted.
+	fate, err := o.recheckDeposit(ctx, state)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return o.scheduleBtcRefund(state, fmt.Errorf("failed to recheck the BTC deposit: %v", err))
+	}
+	deposits := strings.Join(state.depositTxHashes(), ", ")
+	switch fate {
+	case depositUnconfirmed:
+		reason := fmt.Sprintf("BTC deposit %s was reorged out of the chain", deposits)
+		o.alert(state, "%s before the escrow was funded; waiting for it to confirm again", reason)
+		return o.transition(state, localcommon.StatusPendingDeposit, reason, state.BtcDeposits[0].TxHash, func(s *SwapState) {
+			s.BtcDeposits = nil
+			s.BtcReceivedAmount = 0
+			s.DepositOutcome = ""
+			s.BtcAmount = s.BtcQuotedAmount
+			s.EvmAmount = s.EvmQuotedAmount
+		})
+	case depositGone:
+		o.alert(state, "BTC deposit %s was double-spent before the escrow was funded", deposits)
+		return fmt.Errorf("BTC deposit %s was double-spent", deposits)
+	}
+
+	// Once submitted, the escrow deposit is allowed to finish even during
+	// shutdown, so that its tx hash is checkpointed rather than lost.
+	tx, err := o.EvmService.DepositIntoEscrow(context.WithoutCancel(ctx), userAddr, amount, state.SecretHash, lockTime)
+	if err != nil {
+		return o.scheduleBtcRefund(state, fmt.Errorf("failed to deposit into EVM escrow: %v", err))
 	}
 	log.Printf("[LIFECYCLE-%s] EVM escrow fulfilled. Waiting for user to claim.", state.ID)
-	state.Status = localcommon.StatusEvmFulfilled
 
-	// === Phase 3: Wait for User to Claim and Reveal Secret ===
-	revealedSecret, evmErr := o.EvmService.MonitorForClaimEvent(state.SecretHash)
-	if evmErr != nil {
-		log.Printf("[LIFECYCLE-%s] ERROR: Failed to monitor for EVM claim event: %v", state.ID, evmErr)
-		state.Status = localcommon.StatusError
-		// Here you would trigger a refund on the EVM side.
-		return
+	txHash := tx.Hash().Hex()
+	return o.transition(state, localcommon.StatusEvmFulfilled, "EVM escrow funded", txHash, func(s *SwapState) {
+		s.EvmEscrowTxHash = txHash
+		s.EvmClaimScanBlock = scanFrom
+	})
+}
+
+// claimKey re-derives the private key that claims a swap's HTLC, the key
+// RedeemHtlc signs a claim with, and checks it against the claim key the HTLC
+// script commits to.
+func (o *SwapOrchestrator) claimKey(state *SwapState) (*btcec.PrivateKey, error) {
+	if o.ClaimKeys == nil {
+		return nil, fmt.Errorf("no BTC claim keys are configured")
+	}
+	key, err := o.ClaimKeys.ClaimKey(state.BtcClaimKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	terms, err := services.DecodeHtlc(state.BtcHtlcScript, state.BtcAddressType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTLC script: %v", err)
+	}
+	// Taproot leaves hold x-only keys.
+	pubKey := key.PubKey().SerializeCompressed()
+	if state.BtcAddressType == localcommon.HtlcP2TR {
+		pubKey = schnorr.SerializePubKey(key.PubKey())
+	}
+	if !bytes.Equal(pubKey, terms.ClaimPubKey) {
+		return nil, fmt.Errorf("claim key at %q is %x, but the HTLC pays %x", state.BtcClaimKeyPath, pubKey, terms.ClaimPubKey)
+	}
+	return key, nil
+}
+
+// === Phase 3: Wait for User to Claim and Reveal Secret ===
+func (o *SwapOrchestrator) awaitEvmClaim(ctx context.Context, state *SwapState) error {
+	deadline := time.Unix(state.EvmEscrowTimelock, 0)
+	revealedSecret, err := o.EvmService.MonitorForClaimEvent(ctx, state.SecretHash, deadline, &claimCursor{o: o, state: state})
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
+	if errors.Is(err, services.ErrSecretMismatch) {
+		return err
+	}
+	if err != nil {
+		return o.scheduleBtcRefund(state, fmt.Errorf("failed to monitor for EVM claim event: %v", err))
+	}
+
+	// The service already checks the preimage, but paying out on a wrong one
+	// would be unrecoverable, so it is checked again against our own hash.
+	if sha256.Sum256(revealedSecret) != state.SecretHash {
+		return fmt.Errorf("%w: got %x", services.ErrSecretMismatch, revealedSecret)
+	}
+	log.Printf("[LIFECYCLE-%s] Secret revealed on EVM chain and verified.", state.ID)
+
+	return o.transition(state, localcommon.StatusEvmClaimed, "secret revealed by EVM claim", "", func(s *SwapState) {
+		s.EvmEscrowClaimed = true
+	})
+}
+
+// claimCursor keeps the EVM claim monitor's scan position in the swap state,
+// so a resumed swap continues scanning where it stopped.
+type claimCursor struct {
+	o     *SwapOrchestrator
+	state *SwapState
+}
+
+func (c *claimCursor) Next() uint64 {
+	return c.state.EvmClaimScanBlock
+}
+
+func (c *claimCursor) Advance(next uint64) error {
+	return c.o.checkpoint(c.state, func(s *SwapState) { s.EvmClaimScanBlock = next })
+}
+
+// === Phase 4: Send Bitcoin to User ===
+func (o *SwapOrchestrator) deliverBtc(ctx context.Context, state *SwapState) error {
+	if state.BtcPayoutTxHash == "" {
+		// A payout that was started but never recorded may already be on the
+		// network. Sending again could pay the user twice, so stop for manual review.
+		if state.BtcPayoutStarted {
+			return fmt.Errorf("BTC payout was started before a restart and its outcome is unknown; manual review required")
+		}
+		if err := o.checkpoint(state, func(s *SwapState) { s.BtcPayoutStarted = true }); err != nil {
+			return err
+		}
+
+		log.Printf("[LIFECYCLE-%s] Sending %s to user address: %s", state.ID, state.BtcAmount, state.BtcDestinationAddress)
+
+		// Actually send Bitcoin from resolver to user. The payout is not
+		// cancellable: abandoning it would leave BtcPayoutStarted set with no record
+		// of whether it went out.
+		btcTxHash, err := o.BtcService.SendBitcoinToUser(context.WithoutCancel(ctx), state.BtcDestinationAddress, state.BtcAmount)
+		if err != nil {
+			return fmt.Errorf("failed to send Bitcoin: %v", err)
+		}
+		log.Printf("[LIFECYCLE-%s] ✅ Bitcoin sent successfully! TxHash: %s", state.ID, btcTxHash)
+		if err := o.checkpoint(state, func(s *SwapState) { s.BtcPayoutTxHash = btcTxHash }); err != nil {
+			return err
+		}
 	}
-	log.Printf("[LIFECYCLE-%s] Secret revealed on EVM chain!", state.ID)
-	state.Status = localcommon.StatusEvmClaimed
 
-	// === Phase 4: Claim BTC with Revealed Secret ===
-	// Compare revealed secret with original to be sure
-	// In demo mode, we're more lenient with secret validation
-	if !bytes.Equal(revealedSecret, state.Secret) {
-		log.Printf("[LIFECYCLE-%s] WARNING: Demo mode - revealed secret differs from original", state.ID)
-		log.Printf("[LIFECYCLE-%s] Original: %x", state.ID, state.Secret)
-		log.Printf("[LIFECYCLE-%s] Revealed: %x", state.ID, revealedSecret)
-		log.Printf("[LIFECYCLE-%s] Continuing anyway in demo mode...", state.ID)
-		// In production, this would be a fatal error:
-		// state.Status = localcommon.StatusError
-		// return
-	} else {
-		log.Printf("[LIFECYCLE-%s] Secret validation PASSED!", state.ID)
+	if state.DepositOutcome == localcommon.DepositSurplusRefunded && state.BtcSurplusRefundTxHash == "" {
+		if err := o.refundSurplus(ctx, state); err != nil {
+			return err
+		}
 	}
 
-	// === Phase 5: Send Bitcoin to User ===
-	log.Printf("[LIFECYCLE-%s] Sending %.8f BTC to user address: %s", state.ID, state.BtcAmount, state.BtcDestinationAddress)
+	return o.transition(state, localcommon.StatusBtcWithdrawn, "BTC payout broadcast", state.BtcPayoutTxHash, nil)
+}
+
+// refundSurplus pays back what an overpaid deposit put in beyond the quote,
+// with the same never-twice guard as the payout.
+func (o *SwapOrchestrator) refundSurplus(ctx context.Context, state *SwapState) error {
+	if state.BtcSurplusRefundStarted {
+		return fmt.Errorf("BTC surplus refund was started before a restart and its outcome is unknown; manual review required")
+	}
+	if err := o.checkpoint(state, func(s *SwapState) { s.BtcSurplusRefundStarted = true }); err != nil {
+		return err
+	}
 
-	// Actually send Bitcoin from resolver to user
-	btcTxHash, err := o.BtcService.SendBitcoinToUser(state.BtcDestinationAddress, state.BtcAmount)
+	surplus := state.BtcReceivedAmount - state.BtcAmount
+	log.Printf("[LIFECYCLE-%s] Refunding the %s overpaid to user address: %s", state.ID, surplus, state.BtcDestinationAddress)
+	txHash, err := o.BtcService.SendBitcoinToUser(context.WithoutCancel(ctx), state.BtcDestinationAddress, surplus)
 	if err != nil {
-		log.Printf("[LIFECYCLE-%s] ERROR: Failed to send Bitcoin: %v", state.ID, err)
-		state.Status = localcommon.StatusError
-		return
+		return fmt.Errorf("failed to refund the overpaid surplus: %v", err)
 	}
+	return o.checkpoint(state, func(s *SwapState) { s.BtcSurplusRefundTxHash = txHash })
+}
 
-	log.Printf("[LIFECYCLE-%s] ✅ Bitcoin sent successfully! TxHash: %s", state.ID, btcTxHash)
-	log.Printf("[LIFECYCLE-%s] BTC successfully delivered to user.", state.ID)
-	state.Status = localcommon.StatusCompleted
+// === Phase 5: Wait for the BTC Payout to Confirm ===
+//
+// The swap stays BTC_WITHDRAWN until the payout, and the surplus refund if
+// any, have SWAP_PAYOUT_CONFIRMATIONS confirmations. The backend bumps their
+// fees while they are stuck, but only tracks them in memory, so they are
+// handed back to it each time this phase starts, e.g. after a restart.
+func (o *SwapOrchestrator) confirmBtcPayout(ctx context.Context, state *SwapState) error {
+	payouts, err := o.payoutTxs(state)
+	if err != nil {
+		return err
+	}
+	for _, p := range payouts {
+		if err := o.BtcService.TrackPayout(ctx, &p.hash, state.BtcDestinationAddress, p.amount); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Printf("[LIFECYCLE-%s] WARNING: could not resume fee bumping of payout %s: %v", state.ID, p.hash, err)
+		}
+	}
+
+	ticker := time.NewTicker(o.cfg.PayoutCheckInterval)
+	defer ticker.Stop()
+	for {
+		confirmed, err := o.payoutConfirmed(ctx, state)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			// The payout may be back in the mempool after a reorg, or not
+			// indexed yet: keep waiting.
+			log.Printf("[LIFECYCLE-%s] Payout check failed, will retry: %v", state.ID, err)
+		}
+		if confirmed {
+			log.Printf("[LIFECYCLE-%s] BTC successfully delivered to user.", state.ID)
+			return o.transition(state, localcommon.StatusCompleted, "BTC payout confirmed", state.BtcPayoutTxHash, nil)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
 
-	log.Printf("[LIFECYCLE-%s] Swap completed successfully!", state.ID)
+// payoutTx is a transaction paying the user and the amount it pays.
+type payoutTx struct {
+	hash   chainhash.Hash
+	amount btcutil.Amount
+}
+
+// payoutTxs returns the swap's payout and surplus refund under their current
+// txids, which a fee bump may have changed.
+func (o *SwapOrchestrator) payoutTxs(state *SwapState) ([]payoutTx, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if state.BtcPayoutTxHash == "" {
+		return nil, fmt.Errorf("swap %s has no recorded BTC payout", state.ID)
+	}
+	payouts := []payoutTx{{amount: state.BtcAmount}}
+	hashes := []string{state.BtcPayoutTxHash}
+	if state.BtcSurplusRefundTxHash != "" {
+		payouts = append(payouts, payoutTx{amount: state.BtcReceivedAmount - state.BtcAmount})
+		hashes = append(hashes, state.BtcSurplusRefundTxHash)
+	}
+	for i, hash := range hashes {
+		txHash, err := chainhash.NewHashFromStr(hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payout tx hash %q: %v", hash, err)
+		}
+		payouts[i].hash = *txHash
+	}
+	return payouts, nil
+}
+
+// payoutConfirmed reports whether every payout of the swap has enough
+// confirmations.
+func (o *SwapOrchestrator) payoutConfirmed(ctx context.Context, state *SwapState) (bool, error) {
+	payouts, err := o.payoutTxs(state)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range payouts {
+		confirmations, err := o.BtcService.GetConfirmations(ctx, &p.hash)
+		if err != nil {
+			return false, err
+		}
+		if confirmations < o.cfg.PayoutConfirmations {
+			log.Printf("[LIFECYCLE-%s] Payout %s has %d of %d confirmations", state.ID, p.hash, confirmations, o.cfg.PayoutConfirmations)
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 // InitiateSwap is a backward compatibility wrapper that uses a default amount
-func (o *SwapOrchestrator) InitiateSwap(req *localcommon.SwapRequest) (*localcommon.SwapResponse, error) {
+func (o *SwapOrchestrator) InitiateSwap(ctx context.Context, req *localcommon.SwapRequest) (*localcommon.SwapResponse, error) {
 	// Use default amount for backward compatibility
-	defaultBtcAmount := 0.00001000 // 1000 satoshis
-	return o.InitiateSwapWithAmount(req, defaultBtcAmount)
+	defaultBtcAmount := btcutil.Amount(1000) // 0.00001 BTC
+	defaultEvmAmount := big.NewInt(1000000)  // Demo amount in wei
+	return o.InitiateSwapWithAmount(ctx, req, defaultBtcAmount, defaultEvmAmount)
 }
@@ -0,0 +1,537 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/ethereum/go-ethereum/common"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
+	"fusion-btc-resolver/services"
+)
+
+// testDestination is a valid regtest address, matching fakeBtcChain's network.
+const testDestination = "bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu"
+
+// testRefundPubKey is the user's refund key in test swaps: the generator point.
+const testRefundPubKey = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+// testUserEvmAddress receives the EVM escrow of test swaps.
+const testUserEvmAddress = "0x00000000000000000000000000000000000000A1"
+
+// testEvmAmount is the wei test swaps are quoted for 10,000 sat.
+var testEvmAmount = big.NewInt(1_000_000_000_000)
+
+// newTestClaimKeys derives claim keys from a fixed test seed.
+func newTestClaimKeys(t *testing.T) *services.ClaimKeyring {
+	t.Helper()
+	keys, err := services.NewClaimKeyring(&config.BtcConfig{ClaimSeed: "000102030405060708090a0b0c0d0e0f"}, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewClaimKeyring failed: %v", err)
+	}
+	return keys
+}
+
+// newTestSecrets returns a secret seed for tests.
+func newTestSecrets(t *testing.T) *services.SecretSeed {
+	t.Helper()
+	secrets, err := services.NewSecretSeed(bytes.Repeat([]byte{0x5e}, 32))
+	if err != nil {
+		t.Fatalf("NewSecretSeed failed: %v", err)
+	}
+	return secrets
+}
+
+// newFakeOrchestrator wires an orchestrator to in-memory chains.
+func newFakeOrchestrator(t *testing.T) (*SwapOrchestrator, *fakeBtcChain, *fakeEvmChain) {
+	t.Helper()
+	btc := &fakeBtcChain{height: 800_000}
+	evm := newFakeEvmChain(time.Now())
+	o := NewSwapOrchestrator(btc, evm, newTestClaimKeys(t), newTestSecrets(t), newTestStore(t), testSwapConfig())
+	t.Cleanup(func() { o.Shutdown(context.Background()) })
+	return o, btc, evm
+}
+
+// waitForStatus polls until the swap reaches the wanted status.
+func waitForStatus(t *testing.T, o *SwapOrchestrator, swapID string, want localcommon.SwapStatus) *localcommon.SwapStatusResponse {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := o.GetSwapStatus(swapID)
+		if err != nil {
+			t.Fatalf("GetSwapStatus failed: %v", err)
+		}
+		if status.Status == want {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("swap stuck in %s, expected %s", status.Status, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestSwapLifecycleAgainstFakeChains drives a swap from deposit to payout
+// without any node.
+func TestSwapLifecycleAgainstFakeChains(t *testing.T) {
+	o, btc, evm := newFakeOrchestrator(t)
+	evm.reveal = func(ctx context.Context, secretHash [32]byte) ([]byte, error) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		for _, state := range o.ActiveSwaps {
+			if state.SecretHash == secretHash {
+				return state.Secret, nil
+			}
+		}
+		return nil, errors.New("unknown secret hash")
+	}
+
+	resp, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination}, 10_000, testEvmAmount)
+	if err != nil {
+		t.Fatalf("InitiateSwapWithAmount failed: %v", err)
+	}
+
+	status := waitForStatus(t, o, resp.SwapID, localcommon.StatusCompleted)
+
+	var path []localcommon.SwapStatus
+	for _, tr := range status.History {
+		path = append(path, tr.To)
+	}
+	expected := []localcommon.SwapStatus{
+		localcommon.StatusPendingDeposit,
+		localcommon.StatusBtcConfirmed,
+		localcommon.StatusEvmFulfilled,
+		localcommon.StatusEvmClaimed,
+		localcommon.StatusBtcWithdrawn,
+		localcommon.StatusCompleted,
+	}
+	if len(path) != len(expected) {
+		t.Fatalf("expected history %v, got %v", expected, path)
+	}
+	for i := range expected {
+		if path[i] != expected[i] {
+			t.Fatalf("expected history %v, got %v", expected, path)
+		}
+	}
+
+	o.mu.Lock()
+	state := o.ActiveSwaps[resp.SwapID]
+	depositTx, _ := chainhash.NewHashFromStr(state.BtcDeposits[0].TxHash)
+	if want := fakeTxBlock(depositTx); state.BtcDeposits[0].BlockHash != want.String() {
+		t.Errorf("expected the deposit block %s to be recorded, got %q", want, state.BtcDeposits[0].BlockHash)
+	}
+	o.mu.Unlock()
+
+	btc.mu.Lock()
+	defer btc.mu.Unlock()
+	if len(btc.payouts) != 1 || btc.payouts[0] != testDestination {
+		t.Errorf("expected a single payout to the destination, got %v", btc.payouts)
+	}
+}
+
+// TestSwapLifecycleSchedulesRefundWhenClaimFails checks that a failed EVM leg
+// moves the swap to REFUND_PENDING instead of stranding the deposit.
+func TestSwapLifecycleSchedulesRefundWhenClaimFails(t *testing.T) {
+	o, btc, _ := newFakeOrchestrator(t)
+	o.cfg.RefundRetryInterval = time.Hour
+
+	resp, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination}, 10_000, testEvmAmount)
+	if err != nil {
+		t.Fatalf("InitiateSwapWithAmount failed: %v", err)
+	}
+
+	waitForStatus(t, o, resp.SwapID, localcommon.StatusRefundPending)
+
+	btc.mu.Lock()
+	defer btc.mu.Unlock()
+	if len(btc.payouts) != 0 {
+		t.Errorf("expected no payout, got %v", btc.payouts)
+	}
+}
+
+// TestEscrowRefundJobRefundsExpiredEscrow runs the refund job's passes against
+// the fake EVM chain.
+func TestEscrowRefundJobRefundsExpiredEscrow(t *testing.T) {
+	o, _, evm := newFakeOrchestrator(t)
+
+	state := &SwapState{ID: "swap-escrow", Status: localcommon.StatusRefundPending, SecretHash: [32]byte{1}}
+	if _, err := evm.DepositIntoEscrow(context.Background(), common.Address{}, big.NewInt(1), state.SecretHash, big.NewInt(0)); err != nil {
+		t.Fatalf("DepositIntoEscrow failed: %v", err)
+	}
+	state.EvmEscrowTxHash = "0xescrow"
+	state.EvmEscrowTimelock = evm.now.Add(-time.Minute).Unix()
+	o.ActiveSwaps[state.ID] = state
+
+	// First pass submits the refund, second pass sees it confirmed on-chain.
+	o.refundExpiredEscrows(context.Background())
+	if len(evm.refunded) != 1 || state.EvmEscrowRefundTxHash == "" {
+		t.Fatalf("expected one refund submission, got %d", len(evm.refunded))
+	}
+	o.refundExpiredEscrows(context.Background())
+	if !state.EvmEscrowRefunded {
+		t.Error("expected escrow to be marked refunded")
+	}
+	o.refundExpiredEscrows(context.Background())
+	if len(evm.refunded) != 1 {
+		t.Errorf("expected no further refunds, got %d", len(evm.refunded))
+	}
+}
+
+// TestEscrowRefundJobWaitsForRefundReceipt checks that a submitted refund is
+// waited for while pending and only sent again once the node drops it.
+func TestEscrowRefundJobWaitsForRefundReceipt(t *testing.T) {
+	o, _, evm := newFakeOrchestrator(t)
+
+	state := &SwapState{ID: "swap-escrow", Status: localcommon.StatusRefundPending, SecretHash: [32]byte{1}}
+	if _, err := evm.DepositIntoEscrow(context.Background(), common.Address{}, big.NewInt(1), state.SecretHash, big.NewInt(0)); err != nil {
+		t.Fatalf("DepositIntoEscrow failed: %v", err)
+	}
+	state.EvmEscrowTxHash = "0xescrow"
+	state.EvmEscrowTimelock = evm.now.Add(-time.Minute).Unix()
+	o.ActiveSwaps[state.ID] = state
+
+	// The refund stays pending, and the escrow looks unrefunded meanwhile.
+	o.refundExpiredEscrows(context.Background())
+	refundTx := common.HexToHash(state.EvmEscrowRefundTxHash)
+	evm.receipts[refundTx] = nil
+	evm.escrows[state.SecretHash].Refunded = false
+	o.refundExpiredEscrows(context.Background())
+	if len(evm.refunded) != 1 || state.EvmEscrowRefunded {
+		t.Fatalf("expected the pending refund to be waited for, got %d refunds", len(evm.refunded))
+	}
+
+	// Dropped: sent again, and the new refund's receipt settles the escrow.
+	delete(evm.receipts, refundTx)
+	o.refundExpiredEscrows(context.Background())
+	if len(evm.refunded) != 2 || state.EvmEscrowRefundTxHash == refundTx.Hex() {
+		t.Fatalf("expected the dropped refund to be replaced, got %d refunds", len(evm.refunded))
+	}
+	o.refundExpiredEscrows(context.Background())
+	if !state.EvmEscrowRefunded {
+		t.Error("expected the escrow to be marked refunded from the receipt")
+	}
+}
+
+// TestEscrowRefundJobRecordsAbsentEscrow checks that an escrow missing
+// on-chain, as in demo mode, is looked up once rather than every pass.
+func TestEscrowRefundJobRecordsAbsentEscrow(t *testing.T) {
+	o, _, evm := newFakeOrchestrator(t)
+
+	state := &SwapState{ID: "swap-demo", Status: localcommon.StatusEvmFulfilled, SecretHash: [32]byte{2}}
+	state.EvmEscrowTxHash = "0xescrow"
+	state.EvmEscrowTimelock = evm.now.Add(-time.Minute).Unix()
+	o.ActiveSwaps[state.ID] = state
+
+	o.refundExpiredEscrows(context.Background())
+	if !state.EvmEscrowAbsent || escrowNeedsRefund(state) || len(evm.refunded) != 0 {
+		t.Errorf("expected the absent escrow to be recorded and left alone, got absent=%v with %d refunds", state.EvmEscrowAbsent, len(evm.refunded))
+	}
+}
+
+// TestShutdownStopsLifecyclesAtCheckpoint checks that Shutdown cancels a swap
+// blocked on the EVM claim monitor without failing or refunding it, and that
+// no new swaps are accepted afterwards.
+func TestShutdownStopsLifecyclesAtCheckpoint(t *testing.T) {
+	o, _, evm := newFakeOrchestrator(t)
+	evm.reveal = func(ctx context.Context, secretHash [32]byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	resp, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination}, 10_000, testEvmAmount)
+	if err != nil {
+		t.Fatalf("InitiateSwapWithAmount failed: %v", err)
+	}
+	waitForStatus(t, o, resp.SwapID, localcommon.StatusEvmFulfilled)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	swaps, err := o.Store.LoadSwaps()
+	if err != nil {
+		t.Fatalf("LoadSwaps failed: %v", err)
+	}
+	if len(swaps) != 1 || swaps[0].Status != localcommon.StatusEvmFulfilled {
+		t.Fatalf("expected the swap to stay persisted at EVM_FULFILLED, got %+v", swaps)
+	}
+
+	_, err = o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination}, 10_000, testEvmAmount)
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("expected ErrShuttingDown after Shutdown, got %v", err)
+	}
+}
+
+// TestSwapLifecycleFailsOnSecretMismatch checks that a revealed preimage that
+// does not hash to the swap's secret hash stops the swap instead of paying out.
+func TestSwapLifecycleFailsOnSecretMismatch(t *testing.T) {
+	o, btc, evm := newFakeOrchestrator(t)
+	evm.reveal = func(ctx context.Context, secretHash [32]byte) ([]byte, error) {
+		return secretHash[:], nil
+	}
+
+	resp, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination}, 10_000, testEvmAmount)
+	if err != nil {
+		t.Fatalf("InitiateSwapWithAmount failed: %v", err)
+	}
+
+	waitForStatus(t, o, resp.SwapID, localcommon.StatusError)
+
+	o.mu.Lock()
+	state := o.ActiveSwaps[resp.SwapID]
+	scanBlock, lastError := state.EvmClaimScanBlock, state.LastError
+	o.mu.Unlock()
+	if scanBlock != evm.block {
+		t.Errorf("expected the claim scan to start at block %d, got %d", evm.block, scanBlock)
+	}
+	if !strings.Contains(lastError, services.ErrSecretMismatch.Error()) {
+		t.Errorf("expected a secret mismatch error, got %q", lastError)
+	}
+
+	btc.mu.Lock()
+	defer btc.mu.Unlock()
+	if len(btc.payouts) != 0 {
+		t.Errorf("expected no payout, got %v", btc.payouts)
+	}
+}
+
+// TestInitiateSwapRejectsForeignDestination checks that a mainnet destination
+// is refused on a regtest resolver before any swap state is created.
+func TestInitiateSwapRejectsForeignDestination(t *testing.T) {
+	o, _, _ := newFakeOrchestrator(t)
+
+	_, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"}, 10_000, testEvmAmount)
+	if !errors.Is(err, ErrInvalidDestination) {
+		t.Fatalf("expected ErrInvalidDestination, got %v", err)
+	}
+	if len(o.ActiveSwaps) != 0 {
+		t.Errorf("expected no swap to be created, got %d", len(o.ActiveSwaps))
+	}
+}
+
+// TestInitiateSwapAddressTypes checks that the deposit address type is chosen per swap.
+func TestInitiateSwapAddressTypes(t *testing.T) {
+	o, _, _ := newFakeOrchestrator(t)
+	o.cfg.RefundRetryInterval = time.Hour
+
+	resp, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination, AddressType: localcommon.HtlcP2WSH}, 10_000, testEvmAmount)
+	if err != nil {
+		t.Fatalf("InitiateSwapWithAmount failed: %v", err)
+	}
+	if resp.AddressType != localcommon.HtlcP2WSH || !strings.HasPrefix(resp.BtcDepositAddress, "bcrt1q") {
+		t.Errorf("expected a P2WSH deposit address, got %s %s", resp.AddressType, resp.BtcDepositAddress)
+	}
+
+	_, err = o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination, AddressType: "p2pkh"}, 10_000, testEvmAmount)
+	if !errors.Is(err, ErrUnsupportedAddressType) {
+		t.Errorf("expected ErrUnsupportedAddressType, got %v", err)
+	}
+}
+
+// TestInitiateSwapChecksInternalKey checks that no P2TR deposit address is
+// handed out when its internal key is not the configured one, as it could
+// spend the deposit without either HTLC branch.
+func TestInitiateSwapChecksInternalKey(t *testing.T) {
+	o, btc, _ := newFakeOrchestrator(t)
+	refundKey, _ := services.ParseRefundPubKey(testRefundPubKey)
+	btc.internalKey = refundKey[1:]
+
+	_, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination, AddressType: localcommon.HtlcP2TR}, 10_000, testEvmAmount)
+	if err == nil || !strings.Contains(err.Error(), "internal key") {
+		t.Errorf("expected an internal key mismatch, got %v", err)
+	}
+	if len(o.ActiveSwaps) != 0 {
+		t.Errorf("expected no swap to be created, got %d", len(o.ActiveSwaps))
+	}
+}
+
+// TestInitiateSwapUsesSwapKeys checks that each HTLC pays the user's refund
+// key and a claim key of its own, which can be re-derived from its path.
+func TestInitiateSwapUsesSwapKeys(t *testing.T) {
+	o, _, _ := newFakeOrchestrator(t)
+	o.cfg.RefundRetryInterval = time.Hour
+
+	var claimKeys [][]byte
+	for _, addrType := range []localcommon.HtlcAddressType{localcommon.HtlcP2SH, localcommon.HtlcP2TR} {
+		resp, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination, AddressType: addrType}, 10_000, testEvmAmount)
+		if err != nil {
+			t.Fatalf("%s: InitiateSwapWithAmount failed: %v", addrType, err)
+		}
+		o.mu.Lock()
+		state := o.ActiveSwaps[resp.SwapID]
+		terms, err := services.DecodeHtlc(state.BtcHtlcScript, addrType)
+		if err != nil {
+			t.Fatalf("%s: DecodeHtlc failed: %v", addrType, err)
+		}
+		refundKey, _ := services.ParseRefundPubKey(testRefundPubKey)
+		if addrType == localcommon.HtlcP2TR {
+			refundKey = refundKey[1:]
+		}
+		if !bytes.Equal(terms.RefundPubKey, refundKey) {
+			t.Errorf("%s: expected the refund key %x, got %x", addrType, refundKey, terms.RefundPubKey)
+		}
+		if state.BtcClaimKeyPath == "" {
+			t.Errorf("%s: expected the claim key path to be recorded", addrType)
+		}
+		if _, err := o.claimKey(state); err != nil {
+			t.Errorf("%s: claim key does not re-derive: %v", addrType, err)
+		}
+		claimKeys = append(claimKeys, terms.ClaimPubKey)
+		o.mu.Unlock()
+	}
+	if bytes.Equal(claimKeys[0][1:], claimKeys[1]) {
+		t.Error("expected each swap to get its own claim key")
+	}
+
+	_, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey[2:], BtcDestinationAddress: testDestination}, 10_000, testEvmAmount)
+	if !errors.Is(err, ErrInvalidRefundPubKey) {
+		t.Errorf("expected ErrInvalidRefundPubKey, got %v", err)
+	}
+	_, err = o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: "0xnot-an-address", UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination}, 10_000, testEvmAmount)
+	if !errors.Is(err, ErrInvalidEvmAddress) {
+		t.Errorf("expected ErrInvalidEvmAddress, got %v", err)
+	}
+}
+
+// TestFulfillEvmEscrowRequiresClaimKey checks that no escrow is funded for an
+// HTLC the configured claim keys cannot spend.
+func TestFulfillEvmEscrowRequiresClaimKey(t *testing.T) {
+	o, _, evm := newFakeOrchestrator(t)
+	state, _ := newDepositedSwap(t, o, "rekeyed", localcommon.StatusBtcConfirmed)
+
+	keys, err := services.NewClaimKeyring(&config.BtcConfig{ClaimSeed: "0f0e0d0c0b0a09080706050403020100"}, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewClaimKeyring failed: %v", err)
+	}
+	o.ClaimKeys = keys
+	if err := o.fulfillEvmEscrow(context.Background(), state); err != nil {
+		t.Fatalf("fulfillEvmEscrow failed: %v", err)
+	}
+	if state.Status != localcommon.StatusRefundPending || len(evm.escrows) != 0 {
+		t.Errorf("expected a refund instead of an escrow, got %s with %d escrows", state.Status, len(evm.escrows))
+	}
+}
+
+// TestRecordTxReplacement checks that a fee-bumped payout is recorded under
+// its new txid, in memory and in the store.
+func TestRecordTxReplacement(t *testing.T) {
+	o, _, _ := newFakeOrchestrator(t)
+	oldHash := chainhash.DoubleHashH([]byte("payout"))
+	newHash := chainhash.DoubleHashH([]byte("replacement"))
+
+	state := &SwapState{ID: "replaced-swap", Status: localcommon.StatusCompleted, BtcPayoutTxHash: oldHash.String()}
+	o.mu.Lock()
+	o.ActiveSwaps[state.ID] = state
+	o.mu.Unlock()
+
+	o.RecordTxReplacement(oldHash, newHash)
+
+	swaps, err := o.Store.LoadSwaps()
+	if err != nil {
+		t.Fatalf("LoadSwaps failed: %v", err)
+	}
+	if len(swaps) != 1 || swaps[0].BtcPayoutTxHash != newHash.String() {
+		t.Errorf("expected the stored payout to be %s, got %+v", newHash, swaps)
+	}
+}
+
+// TestResumedPayoutTrackedUntilConfirmed checks that a swap restarted while
+// its payout is unconfirmed hands the payout and surplus refund back to the
+// fee bumper, and only completes once both confirm.
+func TestResumedPayoutTrackedUntilConfirmed(t *testing.T) {
+	o, btc, _ := newFakeOrchestrator(t)
+	payout := chainhash.DoubleHashH([]byte("payout"))
+	surplus := chainhash.DoubleHashH([]byte("surplus"))
+	btc.mempool = map[chainhash.Hash]bool{payout: true}
+
+	state := &SwapState{
+		ID:                     "withdrawn-swap",
+		Status:                 localcommon.StatusBtcWithdrawn,
+		BtcDestinationAddress:  testDestination,
+		BtcAmount:              10_000,
+		BtcReceivedAmount:      11_000,
+		DepositOutcome:         localcommon.DepositSurplusRefunded,
+		BtcPayoutStarted:       true,
+		BtcPayoutTxHash:        payout.String(),
+		BtcSurplusRefundTxHash: surplus.String(),
+	}
+	if err := o.Store.SaveSwap(state); err != nil {
+		t.Fatalf("SaveSwap failed: %v", err)
+	}
+	if err := o.ResumeSwaps(); err != nil {
+		t.Fatalf("ResumeSwaps failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		btc.mu.Lock()
+		tracked := len(btc.tracked)
+		btc.mu.Unlock()
+		if tracked == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the payouts to be tracked again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	btc.mu.Lock()
+	if btc.tracked[payout] != 10_000 || btc.tracked[surplus] != 1_000 {
+		t.Errorf("expected the payout of 10000 sat and the surplus of 1000 sat tracked, got %v", btc.tracked)
+	}
+	btc.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	if status, _ := o.GetSwapStatus(state.ID); status.Status != localcommon.StatusBtcWithdrawn {
+		t.Fatalf("expected the swap to wait for its payout, got %s", status.Status)
+	}
+
+	btc.mu.Lock()
+	delete(btc.mempool, payout)
+	btc.mu.Unlock()
+	waitForStatus(t, o, state.ID, localcommon.StatusCompleted)
+	btc.mu.Lock()
+	defer btc.mu.Unlock()
+	if len(btc.payouts) != 0 {
+		t.Errorf("expected nothing to be paid again, got %v", btc.payouts)
+	}
+}
+
+// TestCsvSwapRefundOpensAfterDeposit checks that a CSV swap's refund height
+// is counted from the block that confirmed the deposit.
+func TestCsvSwapRefundOpensAfterDeposit(t *testing.T) {
+	o, btc, _ := newFakeOrchestrator(t)
+	o.cfg.RefundRetryInterval = time.Hour
+	btc.confirmations = 6 // The deposit confirmed at block 799_995
+
+	resp, err := o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination, TimelockType: localcommon.HtlcCSV}, 10_000, testEvmAmount)
+	if err != nil {
+		t.Fatalf("InitiateSwapWithAmount failed: %v", err)
+	}
+	if resp.TimelockType != localcommon.HtlcCSV || resp.RefundDelay != 144 {
+		t.Errorf("expected a 144 block CSV refund delay, got %s %d", resp.TimelockType, resp.RefundDelay)
+	}
+
+	waitForStatus(t, o, resp.SwapID, localcommon.StatusRefundPending)
+	o.mu.Lock()
+	lockTime := o.ActiveSwaps[resp.SwapID].BtcLockTime
+	o.mu.Unlock()
+	if lockTime != 799_995+144 {
+		t.Errorf("expected the refund to open at block %d, got %d", 799_995+144, lockTime)
+	}
+
+	_, err = o.InitiateSwapWithAmount(context.Background(), &localcommon.SwapRequest{UserEvmAddress: testUserEvmAddress, UserBtcRefundPubkey: testRefundPubKey, BtcDestinationAddress: testDestination, TimelockType: "nlocktime"}, 10_000, testEvmAmount)
+	if !errors.Is(err, ErrUnsupportedTimelockType) {
+		t.Errorf("expected ErrUnsupportedTimelockType, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package orchestrator
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// swapsBucket is the bbolt bucket holding one JSON-encoded SwapState per swap ID.
+var swapsBucket = []byte("swaps")
+
+// keyIndexBucket is the bbolt bucket whose sequence numbers NextKeyIndex hands
+// out. It also holds the ID of the secret seed the indexes belong to.
+var keyIndexBucket = []byte("key-indexes")
+
+// secretSeedIDKey is the keyIndexBucket key holding the secret seed's ID.
+var secretSeedIDKey = []byte("secret-seed-id")
+
+// SwapStore persists swap state so that in-flight swaps, and the secrets they
+// depend on, survive a restart of the resolver.
+type SwapStore interface {
+	// SaveSwap durably writes the full state of a swap, replacing any previous copy.
+	SaveSwap(state *SwapState) error
+	// LoadSwaps returns every swap known to the store.
+	LoadSwaps() ([]*SwapState, error)
+	// NextKeyIndex durably reserves a key derivation index that has never
+	// been handed out before, so no two swaps share derived keys.
+	NextKeyIndex() (uint32, error)
+	// SkipKeyIndexes makes sure NextKeyIndex never hands out an index below next.
+	SkipKeyIndexes(next uint32) error
+	// SecretSeedID returns the ID of the secret seed the store's key indexes
+	// were handed out under, or nil if none was recorded.
+	SecretSeedID() ([]byte, error)
+	// SetSecretSeedID records the ID of the secret seed.
+	SetSecretSeedID(id []byte) error
+	// Close releases the underlying storage.
+	Close() error
+}
+
+// BoltSwapStore is an embedded, single-file SwapStore backed by bbolt.
+type BoltSwapStore struct {
+	db      *bolt.DB
+	secrets cipher.AEAD // Encrypts swap secrets at rest once SealSecrets is called
+}
+
+// storedSwap is the persisted form of a SwapState. With SealSecrets, the
+// secret is written encrypted to SealedSecret and Secret is left empty;
+// plaintext secrets of older records are still read.
+type storedSwap struct {
+	*SwapState
+	Secret       []byte `json:",omitempty"`
+	SealedSecret []byte `json:",omitempty"`
+}
+
+// NewBoltSwapStore opens (or creates) the swap database at the given path.
+func NewBoltSwapStore(path string) (*BoltSwapStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create swap store directory: %v", err)
+	}
+
+	// The file holds swap secrets, so it must only be readable by the resolver.
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open swap store %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(swapsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(keyIndexBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize swap store: %v", err)
+	}
+
+	return &BoltSwapStore{db: db}, nil
+}
+
+// SealSecrets makes the store encrypt swap secrets with AES-256-GCM under
+// key from now on, and decrypt those it loads. Swaps saved earlier keep their
+// plaintext secret until they are next saved.
+func (s *BoltSwapStore) SealSecrets(key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("invalid swap store key: %v", err)
+	}
+	s.secrets, err = cipher.NewGCM(block)
+	return err
+}
+
+// SaveSwap writes the swap in a single fsync'd transaction.
+func (s *BoltSwapStore) SaveSwap(state *SwapState) error {
+	stored := storedSwap{SwapState: state, Secret: state.Secret}
+	if s.secrets != nil && len(state.Secret) > 0 {
+		// The swap ID is authenticated too, so a sealed secret cannot be
+		// moved to another swap's record.
+		nonce := make([]byte, s.secrets.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return fmt.Errorf("failed to seal secret of swap %s: %v", state.ID, err)
+		}
+		stored.Secret = nil
+		stored.SealedSecret = s.secrets.Seal(nonce, nonce, state.Secret, []byte(state.ID))
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to encode swap %s: %v", state.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(swapsBucket).Put([]byte(state.ID), data)
+	})
+}
+
+// NextKeyIndex increments the key index bucket's sequence in its own fsync'd
+// transaction. Indexes start at 0 and are never reused, even if the swap they
+// were reserved for is never saved.
+func (s *BoltSwapStore) NextKeyIndex() (uint32, error) {
+	var seq uint64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		seq, err = tx.Bucket(keyIndexBucket).NextSequence()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve a key index: %v", err)
+	}
+	// Derived keys are hardened children, whose index must stay below 2^31.
+	if seq > 1<<31 {
+		return 0, fmt.Errorf("key indexes exhausted")
+	}
+	return uint32(seq - 1), nil
+}
+
+// SkipKeyIndexes advances the key index bucket's sequence to at least next.
+func (s *BoltSwapStore) SkipKeyIndexes(next uint32) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(keyIndexBucket)
+		if bucket.Sequence() >= uint64(next) {
+			return nil
+		}
+		return bucket.SetSequence(uint64(next))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to skip key indexes: %v", err)
+	}
+	return nil
+}
+
+// SecretSeedID reads the recorded secret seed ID.
+func (s *BoltSwapStore) SecretSeedID() ([]byte, error) {
+	var id []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		id = append(id, tx.Bucket(keyIndexBucket).Get(secretSeedIDKey)...)
+		return nil
+	})
+	return id, err
+}
+
+// SetSecretSeedID records the secret seed ID in its own fsync'd transaction.
+func (s *BoltSwapStore) SetSecretSeedID(id []byte) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(keyIndexBucket).Put(secretSeedIDKey, id)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record the secret seed: %v", err)
+	}
+	return nil
+}
+
+// LoadSwaps decodes every swap in the store.
+func (s *BoltSwapStore) LoadSwaps() ([]*SwapState, error) {
+	var swaps []*SwapState
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(swapsBucket).ForEach(func(k, v []byte) error {
+			state := &SwapState{}
+			stored := storedSwap{SwapState: state}
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return fmt.Errorf("failed to decode swap %s: %v", k, err)
+			}
+			if err := s.openSecret(&stored); err != nil {
+				return fmt.Errorf("failed to decode swap %s: %v", k, err)
+			}
+			swaps = append(swaps, state)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return swaps, nil
+}
+
+// openSecret sets the secret of a loaded swap, decrypting it if it was sealed.
+func (s *BoltSwapStore) openSecret(stored *storedSwap) error {
+	if len(stored.SealedSecret) == 0 {
+		stored.SwapState.Secret = stored.Secret
+		return nil
+	}
+	if s.secrets == nil {
+		return fmt.Errorf("its secret is sealed, but the store has no key")
+	}
+	nonceSize := s.secrets.NonceSize()
+	if len(stored.SealedSecret) < nonceSize {
+		return fmt.Errorf("sealed secret is truncated")
+	}
+	nonce, ciphertext := stored.SealedSecret[:nonceSize], stored.SealedSecret[nonceSize:]
+	secret, err := s.secrets.Open(nil, nonce, ciphertext, []byte(stored.ID))
+	if err != nil {
+		return fmt.Errorf("sealed secret does not open with the store key")
+	}
+	stored.SwapState.Secret = secret
+	return nil
+}
+
+// Close closes the underlying database file.
+func (s *BoltSwapStore) Close() error {
+	return s.db.Close()
+}
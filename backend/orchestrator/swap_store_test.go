@@ -0,0 +1,200 @@
+package orchestrator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+	"time"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestStore(t *testing.T) *BoltSwapStore {
+	t.Helper()
+	store, err := NewBoltSwapStore(filepath.Join(t.TempDir(), "swaps.db"))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// TestBoltSwapStoreRoundTrip checks that every field, including the secret, survives a reopen.
+func TestBoltSwapStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swaps.db")
+	store, err := NewBoltSwapStore(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	original := &SwapState{
+		ID:                "swap-roundtrip",
+		Status:            localcommon.StatusEvmFulfilled,
+		Secret:            secret,
+		SecretHash:        sha256.Sum256(secret),
+		BtcDepositAddress: "2N3oefVeg6stiTb5Kh3ozCSkaqmx91FDbsm",
+		BtcHtlcScript:     []byte{0x63, 0xa8},
+		BtcAmount:         10_000,
+		ExpiresAt:         time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+		BtcDeposits:       []DepositUtxo{{TxHash: "deposit", Amount: 10_000}},
+		EvmEscrowTxHash:   "escrow",
+	}
+	if err := store.SaveSwap(original); err != nil {
+		t.Fatalf("SaveSwap failed: %v", err)
+	}
+	store.Close()
+
+	reopened, err := NewBoltSwapStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+
+	swaps, err := reopened.LoadSwaps()
+	if err != nil {
+		t.Fatalf("LoadSwaps failed: %v", err)
+	}
+	if len(swaps) != 1 {
+		t.Fatalf("expected 1 swap, got %d", len(swaps))
+	}
+
+	loaded := swaps[0]
+	if string(loaded.Secret) != string(secret) || loaded.SecretHash != original.SecretHash {
+		t.Errorf("secret did not survive the round trip")
+	}
+	if loaded.Status != original.Status || loaded.EvmEscrowTxHash != "escrow" || loaded.BtcAmount != 10_000 || !loaded.ExpiresAt.Equal(original.ExpiresAt) {
+		t.Errorf("loaded swap %+v does not match saved swap %+v", loaded, original)
+	}
+}
+
+// TestBoltSwapStoreSealsSecrets checks that a sealing store never writes a
+// secret in the clear, and that a sealed secret only opens under its key and
+// for its own swap.
+func TestBoltSwapStoreSealsSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swaps.db")
+	store, err := NewBoltSwapStore(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	key := bytes.Repeat([]byte{0x42}, 32)
+	if err := store.SealSecrets(key); err != nil {
+		t.Fatalf("SealSecrets failed: %v", err)
+	}
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	if err := store.SaveSwap(&SwapState{ID: "swap-sealed", Status: localcommon.StatusPendingDeposit, Secret: secret}); err != nil {
+		t.Fatalf("SaveSwap failed: %v", err)
+	}
+
+	var raw []byte
+	store.db.View(func(tx *bolt.Tx) error {
+		raw = append(raw, tx.Bucket(swapsBucket).Get([]byte("swap-sealed"))...)
+		return nil
+	})
+	if bytes.Contains(raw, secret) || bytes.Contains(raw, []byte(base64.StdEncoding.EncodeToString(secret))) {
+		t.Fatal("secret was persisted in the clear")
+	}
+	swaps, err := store.LoadSwaps()
+	if err != nil || len(swaps) != 1 || !bytes.Equal(swaps[0].Secret, secret) {
+		t.Fatalf("expected the sealed secret to load, got %v", err)
+	}
+
+	// A record copied under another swap ID does not open.
+	store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(swapsBucket).Put([]byte("swap-copied"), bytes.Replace(raw, []byte(`"swap-sealed"`), []byte(`"swap-copied"`), 1))
+	})
+	if _, err := store.LoadSwaps(); err == nil {
+		t.Error("expected a sealed secret moved to another swap to be rejected")
+	}
+	store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(swapsBucket).Delete([]byte("swap-copied"))
+	})
+	store.Close()
+
+	unsealed, err := NewBoltSwapStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer unsealed.Close()
+	if _, err := unsealed.LoadSwaps(); err == nil {
+		t.Error("expected a sealed secret to need the store key")
+	}
+}
+
+// TestResumeSwapsSkipsTerminal checks that finished swaps are loaded for status queries but not restarted.
+func TestResumeSwapsSkipsTerminal(t *testing.T) {
+	store := newTestStore(t)
+	for _, state := range []*SwapState{
+		{ID: "swap-done", Status: localcommon.StatusCompleted},
+		{ID: "swap-failed", Status: localcommon.StatusError},
+	} {
+		if err := store.SaveSwap(state); err != nil {
+			t.Fatalf("SaveSwap failed: %v", err)
+		}
+	}
+
+	o := NewSwapOrchestrator(nil, nil, nil, nil, store, &config.SwapConfig{})
+	if err := o.ResumeSwaps(); err != nil {
+		t.Fatalf("ResumeSwaps failed: %v", err)
+	}
+
+	resp, err := o.GetSwapStatus("swap-done")
+	if err != nil {
+		t.Fatalf("GetSwapStatus failed: %v", err)
+	}
+	if resp.Status != localcommon.StatusCompleted {
+		t.Errorf("expected %s, got %s", localcommon.StatusCompleted, resp.Status)
+	}
+}
+
+// TestResumeSwapsRecoversLostSecret checks that a swap whose secret was lost
+// gets it back from the secret seed, durably.
+func TestResumeSwapsRecoversLostSecret(t *testing.T) {
+	store := newTestStore(t)
+	secrets := newTestSecrets(t)
+	state := &SwapState{ID: "swap-lost", Status: localcommon.StatusError, SecretHash: sha256.Sum256(secrets.Secret(5)), SecretIndex: 5}
+	if err := store.SaveSwap(state); err != nil {
+		t.Fatalf("SaveSwap failed: %v", err)
+	}
+
+	o := NewSwapOrchestrator(nil, nil, nil, secrets, store, &config.SwapConfig{})
+	if err := o.ResumeSwaps(); err != nil {
+		t.Fatalf("ResumeSwaps failed: %v", err)
+	}
+	swaps, err := store.LoadSwaps()
+	if err != nil {
+		t.Fatalf("LoadSwaps failed: %v", err)
+	}
+	if len(swaps) != 1 || sha256.Sum256(swaps[0].Secret) != state.SecretHash {
+		t.Errorf("expected the recovered secret to be persisted, got %+v", swaps)
+	}
+}
+
+// TestBoltSwapStoreKeyIndexes checks that key indexes are never handed out
+// twice, even across a reopen.
+func TestBoltSwapStoreKeyIndexes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swaps.db")
+	store, err := NewBoltSwapStore(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	for want := uint32(0); want < 2; want++ {
+		if got, err := store.NextKeyIndex(); err != nil || got != want {
+			t.Fatalf("expected key index %d, got %d %v", want, got, err)
+		}
+	}
+	store.Close()
+
+	reopened, err := NewBoltSwapStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	if got, err := reopened.NextKeyIndex(); err != nil || got != 2 {
+		t.Errorf("expected key index 2 after a reopen, got %d %v", got, err)
+	}
+}
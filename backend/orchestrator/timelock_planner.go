@@ -0,0 +1,74 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"fusion-btc-resolver/config"
+)
+
+// ErrUnsafeTimelocks is returned when the BTC and EVM timelocks of a swap are
+// not ordered with enough margin for the resolver to claim after the secret
+// is revealed.
+var ErrUnsafeTimelocks = errors.New("unsafe cross-chain timelocks")
+
+// TimelockPlan holds both legs' timelocks for a single swap.
+type TimelockPlan struct {
+	BtcLockHeight int64     // Absolute block height used for the HTLC's CHECKLOCKTIMEVERIFY
+	EvmTimelock   time.Time // Escrow timelock, compared by the contract against block time
+}
+
+// TimelockPlanner derives swap timelocks from the current BTC tip height and
+// EVM block time, and enforces the safety invariants between them:
+//
+//  1. The user must have at least MinEvmClaimWindow to claim the EVM escrow
+//     after it is funded, which can be as late as the end of the deposit window.
+//  2. The HTLC refund branch must open at least CrossChainMargin after the EVM
+//     escrow expires. A user claiming at the last moment reveals the secret on
+//     the EVM chain, and the resolver needs that margin to claim the BTC.
+type TimelockPlanner struct {
+	cfg *config.SwapConfig
+}
+
+// NewTimelockPlanner creates a planner using the swap configuration's margins.
+func NewTimelockPlanner(cfg *config.SwapConfig) *TimelockPlanner {
+	return &TimelockPlanner{cfg: cfg}
+}
+
+// Plan computes the timelocks for a new swap and refuses plans that would
+// violate the invariants.
+func (p *TimelockPlanner) Plan(btcTipHeight int64, evmNow time.Time) (*TimelockPlan, error) {
+	plan := &TimelockPlan{
+		BtcLockHeight: btcTipHeight + p.cfg.BtcLockBlocks,
+		EvmTimelock:   evmNow.Add(p.cfg.EvmLockDuration),
+	}
+
+	// The escrow may be funded as late as the end of the deposit window.
+	latestFunding := evmNow.Add(p.cfg.DepositWindow)
+	if claimWindow := plan.EvmTimelock.Sub(latestFunding); claimWindow < p.cfg.MinEvmClaimWindow {
+		return nil, fmt.Errorf("%w: user claim window %s is below the %s minimum", ErrUnsafeTimelocks, claimWindow, p.cfg.MinEvmClaimWindow)
+	}
+
+	if err := p.Validate(plan, btcTipHeight, evmNow); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Validate re-checks a plan against the current chain state. It is run again
+// right before the EVM escrow is funded, since the BTC chain may have
+// advanced faster than expected while waiting for the deposit.
+func (p *TimelockPlanner) Validate(plan *TimelockPlan, btcTipHeight int64, evmNow time.Time) error {
+	if plan.EvmTimelock.Sub(evmNow) < p.cfg.MinEvmClaimWindow {
+		return fmt.Errorf("%w: EVM escrow expires at %s, leaving the user less than %s to claim", ErrUnsafeTimelocks, plan.EvmTimelock.Format(time.RFC3339), p.cfg.MinEvmClaimWindow)
+	}
+
+	remainingBlocks := plan.BtcLockHeight - btcTipHeight
+	btcRefundOpens := evmNow.Add(time.Duration(remainingBlocks) * p.cfg.BtcBlockInterval)
+	if margin := btcRefundOpens.Sub(plan.EvmTimelock); margin < p.cfg.CrossChainMargin {
+		return fmt.Errorf("%w: BTC refund opens at block %d (~%s), only %s after the EVM escrow expires; %s required",
+			ErrUnsafeTimelocks, plan.BtcLockHeight, btcRefundOpens.Format(time.RFC3339), margin, p.cfg.CrossChainMargin)
+	}
+	return nil
+}
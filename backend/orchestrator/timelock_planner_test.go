@@ -0,0 +1,81 @@
+package orchestrator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"fusion-btc-resolver/config"
+)
+
+func testSwapConfig() *config.SwapConfig {
+	return &config.SwapConfig{
+		DepositWindow:     time.Hour,
+		BtcLockBlocks:     144,
+		BtcBlockInterval:  10 * time.Minute,
+		EvmLockDuration:   12 * time.Hour,
+		MinEvmClaimWindow: 2 * time.Hour,
+		CrossChainMargin:  6 * time.Hour,
+
+		PayoutCheckInterval: 10 * time.Millisecond,
+		PayoutConfirmations: 1,
+	}
+}
+
+// TestTimelockPlannerPlan checks that both timelocks are derived from the chain tips.
+func TestTimelockPlannerPlan(t *testing.T) {
+	planner := NewTimelockPlanner(testSwapConfig())
+	evmNow := time.Unix(1_700_000_000, 0)
+
+	plan, err := planner.Plan(800_000, evmNow)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if plan.BtcLockHeight != 800_144 {
+		t.Errorf("expected BTC lock height 800144, got %d", plan.BtcLockHeight)
+	}
+	if !plan.EvmTimelock.Equal(evmNow.Add(12 * time.Hour)) {
+		t.Errorf("unexpected EVM timelock %s", plan.EvmTimelock)
+	}
+}
+
+// TestTimelockPlannerRefusesUnsafePlans checks each invariant in isolation.
+func TestTimelockPlannerRefusesUnsafePlans(t *testing.T) {
+	evmNow := time.Unix(1_700_000_000, 0)
+
+	// 72 blocks is ~12h, the same as the EVM timelock: no margin at all.
+	cfg := testSwapConfig()
+	cfg.BtcLockBlocks = 72
+	if _, err := NewTimelockPlanner(cfg).Plan(800_000, evmNow); !errors.Is(err, ErrUnsafeTimelocks) {
+		t.Errorf("expected cross-chain margin violation, got %v", err)
+	}
+
+	// A deposit at the end of the window would leave the user only 30 minutes to claim.
+	cfg = testSwapConfig()
+	cfg.EvmLockDuration = 90 * time.Minute
+	if _, err := NewTimelockPlanner(cfg).Plan(800_000, evmNow); !errors.Is(err, ErrUnsafeTimelocks) {
+		t.Errorf("expected claim window violation, got %v", err)
+	}
+}
+
+// TestTimelockPlannerValidateAfterFastBlocks checks that a plan goes stale when
+// BTC blocks arrive faster than assumed while waiting for the deposit.
+func TestTimelockPlannerValidateAfterFastBlocks(t *testing.T) {
+	planner := NewTimelockPlanner(testSwapConfig())
+	evmNow := time.Unix(1_700_000_000, 0)
+
+	plan, err := planner.Plan(800_000, evmNow)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	// One hour later, at the expected pace, the plan still holds.
+	if err := planner.Validate(plan, 800_006, evmNow.Add(time.Hour)); err != nil {
+		t.Errorf("expected plan to remain valid, got %v", err)
+	}
+
+	// One hour later, but 60 blocks were mined: the refund branch opens too early.
+	if err := planner.Validate(plan, 800_060, evmNow.Add(time.Hour)); !errors.Is(err, ErrUnsafeTimelocks) {
+		t.Errorf("expected stale plan to be rejected, got %v", err)
+	}
+}
@@ -12,7 +12,7 @@ of Bitcoin transactions and scripting.
 
 KEY RESPONSIBILITIES:
 - Connecting to a Bitcoin Core node via RPC.
-- Generating a P2SH redeem script and address for a new HTLC.
+- Generating the HTLC redeem script and its P2SH, P2WSH or P2TR deposit address.
 - Constructing and broadcasting transactions to fund the HTLC.
 - Monitoring the blockchain for a user's deposit to the HTLC address.
 - Constructing and broadcasting the redemption transaction for both the claim
@@ -29,18 +29,23 @@ btcd library or Bitcoin's RPC interface.
 package services
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 
+	localcommon "fusion-btc-resolver/common"
 	"fusion-btc-resolver/config" // Assuming this path for our config package
 )
 
@@ -49,12 +54,21 @@ type BtcHtlcService struct {
 	cfg    *config.BtcConfig
 	net    *chaincfg.Params
 	client *rpcclient.Client
+
+	taprootInternalKey string          // TaprootInternalKeyNUMS or TaprootInternalKeyMuSig2
+	tracker            *TxTracker      // Bumps the fees of our broadcasts until they confirm
+	deposits           *DepositWatcher // Detects deposits to every active HTLC address
 }
 
 // NewBtcHtlcService creates a new instance of the Bitcoin HTLC service.
 func NewBtcHtlcService(cfg *config.BtcConfig) (*BtcHtlcService, error) {
-	// Switch from regtest to testnet parameters. This is a critical change.
-	netParams := &chaincfg.TestNet3Params
+	netParams, err := validateBtcConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RPCUser == "" || cfg.RPCPass == "" {
+		return nil, fmt.Errorf("BTC_RPC_USER and BTC_RPC_PASS are required by the bitcoind backend")
+	}
 
 	connCfg := &rpcclient.ConnConfig{
 		Host:         cfg.RPCHost,
@@ -68,158 +82,343 @@ func NewBtcHtlcService(cfg *config.BtcConfig) (*BtcHtlcService, error) {
 		return nil, fmt.Errorf("failed to create Bitcoin RPC client: %v", err)
 	}
 
-	return &BtcHtlcService{
+	s := &BtcHtlcService{
 		cfg:    cfg,
 		net:    netParams,
 		client: client,
-	}, nil
+
+		taprootInternalKey: cfg.TaprootInternalKey,
+	}
+	s.tracker = newTxTracker(s, cfg.BumpAfterBlocks, FeeRatePerVByte(cfg.MaxFeeRate))
+	s.deposits = newDepositWatcher(s)
+	return s, nil
 }
 
-// CreateHtlc generates the redeem script and P2SH address for a new swap.
-func (s *BtcHtlcService) CreateHtlc(senderPubKey, receiverPubKey []byte, secretHash []byte, lockTime int64) ([]byte, btcutil.Address, error) {
-	builder := txscript.NewScriptBuilder()
+// validateBtcConfig checks the settings shared by every BTC backend and
+// returns the network they select.
+func validateBtcConfig(cfg *config.BtcConfig) (*chaincfg.Params, error) {
+	netParams, err := NetParamsForNetwork(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+	// Paying out from, or handing out HTLCs for, the wrong network would lose
+	// funds, so a resolver address from another network is a startup error.
+	if _, err := DecodeAddressForNet(cfg.ResolverAddress, netParams); err != nil {
+		return nil, fmt.Errorf("BTC_RESOLVER_ADDRESS: %v", err)
+	}
 
-	// Path 1: Claim with secret (Resolver's path)
-	builder.AddOp(txscript.OP_IF)
-	builder.AddOp(txscript.OP_SHA256)
-	builder.AddData(secretHash)
-	builder.AddOp(txscript.OP_EQUALVERIFY)
-	builder.AddData(receiverPubKey) // Resolver's public key
+	if cfg.DepositPollInterval <= 0 {
+		return nil, fmt.Errorf("BTC_DEPOSIT_POLL_INTERVAL must be positive, got %s", cfg.DepositPollInterval)
+	}
+	if cfg.FeeConfTarget < 1 {
+		return nil, fmt.Errorf("BTC_FEE_CONF_TARGET must be at least 1, got %d", cfg.FeeConfTarget)
+	}
+	if cfg.MinFeeRate < 1 || cfg.MaxFeeRate < cfg.MinFeeRate {
+		return nil, fmt.Errorf("BTC_MIN_FEE_RATE (%d) must be at least 1 and at most BTC_MAX_FEE_RATE (%d)", cfg.MinFeeRate, cfg.MaxFeeRate)
+	}
+	if cfg.BumpAfterBlocks < 1 {
+		return nil, fmt.Errorf("BTC_BUMP_AFTER_BLOCKS must be at least 1, got %d", cfg.BumpAfterBlocks)
+	}
+	if cfg.TxTrackInterval <= 0 {
+		return nil, fmt.Errorf("BTC_TX_TRACK_INTERVAL must be positive, got %s", cfg.TxTrackInterval)
+	}
+	switch cfg.TaprootInternalKey {
+	case TaprootInternalKeyNUMS, TaprootInternalKeyMuSig2:
+	default:
+		return nil, fmt.Errorf("BTC_TAPROOT_INTERNAL_KEY must be %s or %s, got %q", TaprootInternalKeyNUMS, TaprootInternalKeyMuSig2, cfg.TaprootInternalKey)
+	}
+	return netParams, nil
+}
 
-	// Path 2: Refund after timeout (User's path)
-	builder.AddOp(txscript.OP_ELSE)
-	builder.AddInt64(lockTime)
-	builder.AddOp(txscript.OP_CHECKLOCKTIMEVERIFY)
-	builder.AddOp(txscript.OP_DROP)
-	builder.AddData(senderPubKey) // User's public key for refund
+// RunTxTracker watches every transaction the service broadcasts, bumping the
+// fees of any that get stuck, until ctx is cancelled.
+func (s *BtcHtlcService) RunTxTracker(ctx context.Context) {
+	s.tracker.Run(ctx, s.cfg.TxTrackInterval)
+}
 
-	builder.AddOp(txscript.OP_ENDIF)
-	builder.AddOp(txscript.OP_CHECKSIG)
+// RunDepositWatcher detects deposits for MonitorForDeposit until ctx is
+// cancelled: from bitcoind's ZMQ feeds if BTC_ZMQ_RAWTX and BTC_ZMQ_HASHBLOCK
+// are set, and by a reconciliation poll every BTC_DEPOSIT_POLL_INTERVAL.
+func (s *BtcHtlcService) RunDepositWatcher(ctx context.Context) {
+	s.deposits.Run(ctx, s.cfg.DepositPollInterval, s.cfg.ZmqRawTx, s.cfg.ZmqHashBlock)
+}
 
-	htlcScript, err := builder.Script()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to build HTLC script: %v", err)
+// SetTxReplacedHandler registers fn to be told when a fee bump replaces one
+// of the service's transactions with a new txid.
+func (s *BtcHtlcService) SetTxReplacedHandler(fn func(oldHash, newHash chainhash.Hash)) {
+	s.tracker.SetReplacedHandler(fn)
+}
+
+// NetParamsForNetwork returns the chain parameters for a BTC_NETWORK name.
+func NetParamsForNetwork(name string) (*chaincfg.Params, error) {
+	switch name {
+	case "mainnet":
+		return &chaincfg.MainNetParams, nil
+	case "testnet3":
+		return &chaincfg.TestNet3Params, nil
+	case "signet":
+		return &chaincfg.SigNetParams, nil
+	case "regtest":
+		return &chaincfg.RegressionNetParams, nil
+	default:
+		return nil, fmt.Errorf("unknown BTC_NETWORK %q: expected mainnet, testnet3, signet or regtest", name)
 	}
+}
 
-	htlcAddress, err := btcutil.NewAddressScriptHash(htlcScript, s.net)
+// DecodeAddressForNet decodes a Bitcoin address and checks that it belongs to
+// net. DecodeAddress alone does not check a bech32 address's prefix, so the
+// IsForNet check is what actually rejects e.g. a bc1 address on regtest.
+// Legacy base58 addresses cannot tell testnet3, signet and regtest apart.
+func DecodeAddressForNet(address string, net *chaincfg.Params) (btcutil.Address, error) {
+	addr, err := btcutil.DecodeAddress(address, net)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create P2SH address: %v", err)
+		return nil, fmt.Errorf("invalid address %q: %v", address, err)
+	}
+	if !addr.IsForNet(net) {
+		return nil, fmt.Errorf("address %q is not a %s address", address, net.Name)
 	}
+	return addr, nil
+}
+
+// NetParams returns the Bitcoin network parameters the service operates on.
+func (s *BtcHtlcService) NetParams() *chaincfg.Params {
+	return s.net
+}
 
-	return htlcScript, htlcAddress, nil
+// TaprootKeyMode returns the BTC_TAPROOT_INTERNAL_KEY mode of P2TR HTLCs.
+func (s *BtcHtlcService) TaprootKeyMode() string {
+	return s.taprootInternalKey
 }
 
-// RedeemHtlc creates and broadcasts a transaction to redeem funds from the HTLC.
+// CreateHtlc generates the redeem script and the deposit address of the
+// requested type for a new swap. For P2TR, the internal key follows
+// BTC_TAPROOT_INTERNAL_KEY and the script returned is a tapscript bundle.
+func (s *BtcHtlcService) CreateHtlc(senderPubKey, receiverPubKey []byte, secretHash []byte, lockTime int64, timelockType localcommon.HtlcTimelockType, addrType localcommon.HtlcAddressType) ([]byte, btcutil.Address, error) {
+	return createHtlc(s.net, s.taprootInternalKey, senderPubKey, receiverPubKey, secretHash, lockTime, timelockType, addrType)
+}
+
+// createHtlc is CreateHtlc for any backend.
+func createHtlc(net *chaincfg.Params, internalKeyMode string, senderPubKey, receiverPubKey []byte, secretHash []byte, lockTime int64, timelockType localcommon.HtlcTimelockType, addrType localcommon.HtlcAddressType) ([]byte, btcutil.Address, error) {
+	params := &HtlcParams{
+		SecretHash:   secretHash,
+		ClaimPubKey:  receiverPubKey, // Resolver's public key
+		RefundPubKey: senderPubKey,   // User's public key for refund
+		LockTime:     lockTime,
+		TimelockType: timelockType,
+	}
+	if addrType == localcommon.HtlcP2TR {
+		internalKey, err := TaprootInternalKey(senderPubKey, receiverPubKey, internalKeyMode)
+		if err != nil {
+			return nil, nil, err
+		}
+		params.InternalKey = internalKey
+	}
+	return BuildHtlc(params, addrType, net)
+}
+
+// RedeemHtlc creates and broadcasts a transaction to redeem funds from the
+// HTLC, sweeping its outputs in every funding transaction into one spend.
 // To claim, provide the resolver's key and the preimage.
 // To refund, provide the user's key and a nil preimage after the locktime has passed.
-func (s *BtcHtlcService) RedeemHtlc(fundingTxHash *chainhash.Hash, htlcScript []byte, redeemAddress btcutil.Address, key *btcec.PrivateKey, preimage []byte, lockTime int64) (*chainhash.Hash, error) {
-	fundingTxRaw, err := s.client.GetRawTransaction(fundingTxHash)
+// For a CSV HTLC, the refund's input sequences are set to the script's delay.
+// The fee rate comes from estimatesmartfee, clamped to BTC_MIN_FEE_RATE and
+// BTC_MAX_FEE_RATE.
+func (s *BtcHtlcService) RedeemHtlc(ctx context.Context, fundingTxHashes []*chainhash.Hash, htlcScript []byte, addrType localcommon.HtlcAddressType, redeemAddress btcutil.Address, key *btcec.PrivateKey, preimage []byte, lockTime int64) (*chainhash.Hash, error) {
+	fundingTxs, err := s.fundingTxs(ctx, fundingTxHashes)
 	if err != nil {
-		return nil, fmt.Errorf("could not get funding tx: %v", err)
+		return nil, err
 	}
 
-	htlcP2SHAddress, err := btcutil.NewAddressScriptHash(htlcScript, s.net)
+	feeRate := s.estimateFeeRate(ctx)
+	tx, err := buildRedeemTx(fundingTxs, htlcScript, addrType, s.net, redeemAddress, key, preimage, lockTime, feeRate)
 	if err != nil {
 		return nil, err
 	}
-	htlcPkScript, _ := txscript.PayToAddrScript(htlcP2SHAddress)
+	log.Printf("[BTC_SERVICE] Redeeming %d HTLC outputs at %s", len(tx.TxIn), feeRate)
 
-	var htlcOutputIndex uint32 = 0
-	var htlcOutputValue btcutil.Amount
-	for i, out := range fundingTxRaw.MsgTx().TxOut {
-		if bytes.Equal(out.PkScript, htlcPkScript) {
-			htlcOutputIndex = uint32(i)
-			htlcOutputValue = btcutil.Amount(out.Value)
-			break
-		}
+	redeemTxHash, err := s.sendRawTx(ctx, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to broadcast redemption tx: %v", err)
 	}
 
-	if htlcOutputValue == 0 {
-		return nil, fmt.Errorf("could not find HTLC output in funding tx")
+	label := "HTLC refund"
+	if len(preimage) > 0 {
+		label = "HTLC claim"
 	}
+	s.tracker.track(&trackedTx{
+		hash:    *redeemTxHash,
+		label:   label,
+		kind:    txRedeem,
+		raw:     tx,
+		feeRate: feeRate,
+		rebuild: func(rate FeeRate) (*wire.MsgTx, error) {
+			return buildRedeemTx(fundingTxs, htlcScript, addrType, s.net, redeemAddress, key, preimage, lockTime, rate)
+		},
+	})
+	return redeemTxHash, nil
+}
 
-	tx := wire.NewMsgTx(2)
-	// A real implementation would calculate fees dynamically.
-	fee := btcutil.Amount(1000)
-	tx.AddTxOut(wire.NewTxOut(int64(htlcOutputValue-fee), mustPayToAddrScript(redeemAddress)))
-
-	isClaim := len(preimage) > 0
-	outpoint := wire.NewOutPoint(fundingTxHash, htlcOutputIndex)
-	txIn := wire.NewTxIn(outpoint, nil, nil)
-
-	if !isClaim {
-		tx.LockTime = uint32(lockTime)
-		txIn.Sequence = 0 // Required for CLTV
+// BuildRefundPsbt builds an unsigned PSBT refunding the HTLC outputs of the
+// funding transactions to refundAddress, for the user to sign with their own
+// wallet. A zero feeRate means estimatesmartfee's, clamped as for RedeemHtlc.
+func (s *BtcHtlcService) BuildRefundPsbt(ctx context.Context, fundingTxHashes []*chainhash.Hash, htlcScript []byte, addrType localcommon.HtlcAddressType, refundAddress btcutil.Address, lockTime int64, feeRate FeeRate) (*psbt.Packet, error) {
+	fundingTxs, err := s.fundingTxs(ctx, fundingTxHashes)
+	if err != nil {
+		return nil, err
 	}
-	tx.AddTxIn(txIn)
+	if feeRate == 0 {
+		feeRate = s.estimateFeeRate(ctx)
+	}
+	return buildRefundPsbt(fundingTxs, htlcScript, addrType, s.net, refundAddress, lockTime, feeRate)
+}
 
-	sig, err := txscript.RawTxInSignature(tx, 0, htlcScript, txscript.SigHashAll, key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to sign redemption tx: %v", err)
+// fundingTxs fetches the transactions that paid an HTLC.
+func (s *BtcHtlcService) fundingTxs(ctx context.Context, fundingTxHashes []*chainhash.Hash) ([]*wire.MsgTx, error) {
+	fundingTxs := make([]*wire.MsgTx, len(fundingTxHashes))
+	for i, fundingTxHash := range fundingTxHashes {
+		fundingTxRaw, err := withContext(ctx, func() (*btcutil.Tx, error) {
+			return s.client.GetRawTransaction(fundingTxHash)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not get funding tx %s: %v", fundingTxHash, err)
+		}
+		fundingTxs[i] = fundingTxRaw.MsgTx()
 	}
+	return fundingTxs, nil
+}
 
-	var scriptSig []byte
-	builder := txscript.NewScriptBuilder()
-	builder.AddData(sig)
-	if isClaim {
-		builder.AddData(preimage)
-		builder.AddOp(txscript.OP_TRUE) // Select the IF branch
-	} else {
-		builder.AddOp(txscript.OP_FALSE) // Select the ELSE branch
+// ErrDepositExpired is returned by MonitorForDeposit when the swap's deadline
+// passes without any deposit being seen at the HTLC address.
+var ErrDepositExpired = errors.New("no deposit received before the swap expired")
+
+// MonitorForDeposit watches the HTLC address until the outputs paid to it,
+// each with the configured number of confirmations, add up to expectedAmount,
+// and returns them. A deposit may be split over several transactions.
+// Deposits are detected by the service's DepositWatcher, which must be running.
+// If nothing has been paid to the address by the deadline, ErrDepositExpired
+// is returned; otherwise what was paid is returned once it has confirmed,
+// even if it falls short. A deposit that is already in the mempool at the
+// deadline is still waited for, since the user has paid.
+// Cancelling ctx stops the watch and returns ctx.Err().
+func (s *BtcHtlcService) MonitorForDeposit(ctx context.Context, htlcAddress btcutil.Address, expectedAmount btcutil.Amount, deadline time.Time) (*Deposit, error) {
+	log.Printf("[BTC_SERVICE] Monitoring for deposit of %s to address %s (%d confirmations required)", expectedAmount, htlcAddress, s.cfg.DepositConfirmations)
+
+	// listunspent only reports outputs for addresses in the node's wallet,
+	// so the HTLC address is imported as watch-only first.
+	_, err := withContext(ctx, func() (struct{}, error) {
+		return struct{}{}, s.client.ImportAddressRescan(htlcAddress.EncodeAddress(), "htlc_swap", false)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import address for monitoring: %v", err)
 	}
-	builder.AddData(htlcScript)
-	scriptSig, _ = builder.Script()
 
-	tx.TxIn[0].SignatureScript = scriptSig
+	return s.deposits.await(ctx, htlcAddress, expectedAmount, s.cfg.DepositConfirmations, deadline)
+}
 
-	redeemTxHash, err := s.client.SendRawTransaction(tx, false)
+// CurrentHeight returns the height of the node's best chain tip.
+func (s *BtcHtlcService) CurrentHeight(ctx context.Context) (int64, error) {
+	height, err := withContext(ctx, s.client.GetBlockCount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to broadcast redemption tx: %v", err)
+		return 0, fmt.Errorf("failed to get block count: %v", err)
 	}
-
-	return redeemTxHash, nil
+	return height, nil
 }
 
-// MonitorForDeposit watches for a transaction to the specified address.
-// This is a simplified polling implementation for the hackathon. A production
-// system would use a more robust mechanism like ZeroMQ notifications.
-func (s *BtcHtlcService) MonitorForDeposit(htlcAddress btcutil.Address, expectedAmount btcutil.Amount) (*chainhash.Hash, error) {
-	log.Printf("[BTC_SERVICE] Monitoring for deposit of %s to address %s", expectedAmount, htlcAddress)
+// ListHtlcUtxos returns the unspent outputs paid to an HTLC address. It only
+// sees addresses MonitorForDeposit imported into the node's wallet as
+// watch-only; an HTLC never monitored by this node reports no outputs.
+func (s *BtcHtlcService) ListHtlcUtxos(ctx context.Context, htlcAddress btcutil.Address) ([]DepositUtxo, error) {
+	return listAddressUtxos(ctx, s, htlcAddress)
+}
 
-	// In a real app, this would be a long-running background task.
-	// For demo purposes, we'll just check recent transactions.
+// BroadcastTransaction submits an already-signed transaction to the network.
+// It is tracked until it confirms and rebroadcast if the node drops it, but
+// since someone else signed it, its fee is never bumped.
+func (s *BtcHtlcService) BroadcastTransaction(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error) {
+	txHash, err := s.sendRawTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	s.tracker.track(&trackedTx{hash: *txHash, label: "external tx", kind: txExternal, raw: tx})
+	return txHash, nil
+}
 
-	// This is a placeholder. A real implementation would need to scan the mempool
-	// and confirmed blocks, which is complex. For a hackathon, you might
-	// create a specific RPC call on your node to check this, or simply
-	// have a manual step in your demo.
+// GetConfirmations returns how many confirmations a transaction has, with 0
+// meaning it is in the mempool. An error means the node does not know the
+// transaction at all, e.g. because it was evicted and must be rebroadcast.
+// Looking up confirmed non-wallet transactions requires -txindex.
+func (s *BtcHtlcService) GetConfirmations(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	tx, err := withContext(ctx, func() (*btcjson.TxRawResult, error) {
+		return s.client.GetRawTransactionVerbose(txHash)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up tx %s: %v", txHash, err)
+	}
+	return int64(tx.Confirmations), nil
+}
 
-	// A simple way to simulate this is to check listunspent for that address.
-	// This requires importing the address into the node's wallet first.
-	err := s.client.ImportAddressRescan(htlcAddress.EncodeAddress(), "htlc_swap", false)
+// GetTxBlock returns the block that confirmed a transaction, or nil while it
+// is in the mempool. Like GetConfirmations, it needs -txindex for confirmed
+// transactions outside the wallet.
+func (s *BtcHtlcService) GetTxBlock(ctx context.Context, txHash *chainhash.Hash) (*chainhash.Hash, error) {
+	tx, err := withContext(ctx, func() (*btcjson.TxRawResult, error) {
+		return s.client.GetRawTransactionVerbose(txHash)
+	})
+	var rpcErr *btcjson.RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == btcjson.ErrRPCNoTxInfo {
+		return nil, fmt.Errorf("%w: %s", ErrTxNotFound, txHash)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to import address for monitoring: %v", err)
+		return nil, fmt.Errorf("failed to look up tx %s: %v", txHash, err)
+	}
+	if tx.BlockHash == "" {
+		return nil, nil
 	}
+	return chainhash.NewHashFromStr(tx.BlockHash)
+}
 
-	// Loop for a few minutes to check for the deposit
-	for i := 0; i < 30; i++ {
-		unspent, err := s.client.ListUnspentMinMaxAddresses(0, 999999, []btcutil.Address{htlcAddress})
-		if err != nil {
-			return nil, fmt.Errorf("error checking for unspent txs: %v", err)
-		}
+// IsInActiveChain reports whether a block is on the best chain. bitcoind
+// keeps the headers of stale blocks, reporting -1 confirmations for them.
+func (s *BtcHtlcService) IsInActiveChain(ctx context.Context, blockHash *chainhash.Hash) (bool, error) {
+	header, err := withContext(ctx, func() (*btcjson.GetBlockHeaderVerboseResult, error) {
+		return s.client.GetBlockHeaderVerbose(blockHash)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to look up block %s: %v", blockHash, err)
+	}
+	return header.Confirmations >= 0, nil
+}
 
-		for _, u := range unspent {
-			amount, _ := btcutil.NewAmount(u.Amount)
-			if amount == expectedAmount {
-				log.Printf("[BTC_SERVICE] Deposit detected! TxID: %s", u.TxID)
-				txHash, _ := chainhash.NewHashFromStr(u.TxID)
-				return txHash, nil
-			}
-		}
-		// time.Sleep(10 * time.Second)
+// BestBlockHash returns the hash of the node's best chain tip.
+func (s *BtcHtlcService) BestBlockHash(ctx context.Context) (*chainhash.Hash, error) {
+	hash, err := withContext(ctx, s.client.GetBestBlockHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block hash: %v", err)
 	}
+	return hash, nil
+}
 
-	return nil, fmt.Errorf("deposit not detected within timeout period")
+// withContext runs a blocking RPC call and returns early with ctx.Err() if
+// ctx is cancelled first. rpcclient has no per-call context, so an abandoned
+// call still completes in the background; its result is discarded.
+func withContext[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := call()
+		done <- result{value, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case r := <-done:
+		return r.value, r.err
+	}
 }
 
 // mustPayToAddrScript is a helper to panic on script creation failure.
@@ -233,26 +432,40 @@ func mustPayToAddrScript(addr btcutil.Address) []byte {
 
 // SendBitcoinToUser sends Bitcoin directly from the resolver address to the user's destination address.
 // This is used in the final step of the swap to deliver Bitcoin to the user.
-func (s *BtcHtlcService) SendBitcoinToUser(toAddress string, amountBTC float64) (string, error) {
-	log.Printf("[BTC_SERVICE] Sending %.8f BTC from resolver to %s", amountBTC, toAddress)
-
-	// Convert BTC to satoshis
-	amountSatoshis := btcutil.Amount(amountBTC * 1e8)
+func (s *BtcHtlcService) SendBitcoinToUser(ctx context.Context, toAddress string, amount btcutil.Amount) (string, error) {
+	log.Printf("[BTC_SERVICE] Sending %s from resolver to %s", amount, toAddress)
 
 	// Parse the destination address
-	destAddr, err := btcutil.DecodeAddress(toAddress, s.net)
+	destAddr, err := DecodeAddressForNet(toAddress, s.net)
 	if err != nil {
 		return "", fmt.Errorf("invalid destination address: %v", err)
 	}
 
 	// Use bitcoin-cli sendtoaddress for simplicity in regtest mode
 	// In production, you'd want more sophisticated transaction construction
-	txHash, err := s.client.SendToAddress(destAddr, amountSatoshis)
+	txHash, err := withContext(ctx, func() (*chainhash.Hash, error) {
+		return s.client.SendToAddress(destAddr, amount)
+	})
 	if err != nil {
 		log.Printf("[BTC_SERVICE] ERROR: Failed to send Bitcoin: %v", err)
 		return "", fmt.Errorf("failed to send Bitcoin: %v", err)
 	}
 
 	log.Printf("[BTC_SERVICE] ✅ Bitcoin sent successfully! TxHash: %s", txHash.String())
+	s.tracker.track(&trackedTx{hash: *txHash, label: "payout", kind: txWallet, feeRate: s.estimateFeeRate(ctx)})
 	return txHash.String(), nil
 }
+
+// TrackPayout resumes fee bumping of a payout broadcast before a restart. The
+// wallet still holds the payout, bumps it by txid and rebroadcasts it if the
+// node dropped it, so its hash is all that is needed.
+func (s *BtcHtlcService) TrackPayout(ctx context.Context, txHash *chainhash.Hash, toAddress string, amount btcutil.Amount) error {
+	if s.tracker.tracking(*txHash) {
+		return nil
+	}
+	if confirmations, err := s.GetConfirmations(ctx, txHash); err == nil && confirmations > 0 {
+		return nil
+	}
+	s.tracker.track(&trackedTx{hash: *txHash, label: "payout", kind: txWallet, feeRate: s.estimateFeeRate(ctx)})
+	return nil
+}
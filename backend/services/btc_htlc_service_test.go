@@ -0,0 +1,43 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestNetParamsForNetwork checks every supported BTC_NETWORK name and rejects unknown ones.
+func TestNetParamsForNetwork(t *testing.T) {
+	for name, want := range map[string]*chaincfg.Params{
+		"mainnet":  &chaincfg.MainNetParams,
+		"testnet3": &chaincfg.TestNet3Params,
+		"signet":   &chaincfg.SigNetParams,
+		"regtest":  &chaincfg.RegressionNetParams,
+	} {
+		got, err := NetParamsForNetwork(name)
+		if err != nil || got != want {
+			t.Errorf("NetParamsForNetwork(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := NetParamsForNetwork("testnet"); err == nil {
+		t.Error("expected an unknown network to be rejected")
+	}
+}
+
+// TestDecodeAddressForNet checks that bech32 prefixes are enforced, which
+// btcutil.DecodeAddress does not do by itself.
+func TestDecodeAddressForNet(t *testing.T) {
+	const regtestAddr = "bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu"
+
+	if _, err := DecodeAddressForNet(regtestAddr, &chaincfg.RegressionNetParams); err != nil {
+		t.Errorf("expected regtest address to be accepted: %v", err)
+	}
+	for _, net := range []*chaincfg.Params{&chaincfg.MainNetParams, &chaincfg.TestNet3Params, &chaincfg.SigNetParams} {
+		if _, err := DecodeAddressForNet(regtestAddr, net); err == nil {
+			t.Errorf("expected regtest address to be rejected on %s", net.Name)
+		}
+	}
+	if _, err := DecodeAddressForNet("not-an-address", &chaincfg.RegressionNetParams); err == nil {
+		t.Error("expected a malformed address to be rejected")
+	}
+}
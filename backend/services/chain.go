@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
+	"fusion-btc-resolver/contracts/settlement"
+)
+
+// BtcChain is the Bitcoin side of a swap as seen by the orchestrator: HTLC
+// creation, deposit watching, redemption and refunds. BtcHtlcService is the
+// bitcoind-backed implementation and EsploraService the REST API one; other
+// backends and in-memory fakes can be plugged in by implementing this
+// interface.
+//
+// Every method that talks to the network takes a context. Cancelling it
+// abandons the call, which is how shutdown stops in-flight monitors.
+type BtcChain interface {
+	// NetParams returns the network HTLC addresses are encoded for.
+	NetParams() *chaincfg.Params
+	// TaprootKeyMode returns how P2TR HTLCs pick their internal key:
+	// TaprootInternalKeyNUMS or TaprootInternalKeyMuSig2.
+	TaprootKeyMode() string
+	// CreateHtlc builds the HTLC redeem script and its deposit address of the
+	// given type. For a CSV timelock, lockTime is the refund delay in blocks.
+	CreateHtlc(senderPubKey, receiverPubKey []byte, secretHash []byte, lockTime int64, timelockType localcommon.HtlcTimelockType, addrType localcommon.HtlcAddressType) ([]byte, btcutil.Address, error)
+	// MonitorForDeposit blocks until the outputs paid to the HTLC add up to
+	// expectedAmount, or the deadline passes. What was paid by then is
+	// returned, possibly short of expectedAmount; ErrDepositExpired means
+	// nothing was.
+	MonitorForDeposit(ctx context.Context, htlcAddress btcutil.Address, expectedAmount btcutil.Amount, deadline time.Time) (*Deposit, error)
+	// RedeemHtlc spends every HTLC output of the funding transactions through
+	// its claim (preimage) or refund (timeout) branch.
+	RedeemHtlc(ctx context.Context, fundingTxHashes []*chainhash.Hash, htlcScript []byte, addrType localcommon.HtlcAddressType, redeemAddress btcutil.Address, key *btcec.PrivateKey, preimage []byte, lockTime int64) (*chainhash.Hash, error)
+	// BuildRefundPsbt builds an unsigned BIP174 PSBT spending every HTLC
+	// output of the funding transactions to refundAddress through the refund
+	// branch, for the user to sign. A zero feeRate means the backend's estimate.
+	BuildRefundPsbt(ctx context.Context, fundingTxHashes []*chainhash.Hash, htlcScript []byte, addrType localcommon.HtlcAddressType, refundAddress btcutil.Address, lockTime int64, feeRate FeeRate) (*psbt.Packet, error)
+	// ListHtlcUtxos returns the unspent outputs paid to an HTLC address,
+	// mempool ones included, ordered by outpoint. Unlike MonitorForDeposit it
+	// also finds payments made after a swap stopped watching.
+	ListHtlcUtxos(ctx context.Context, htlcAddress btcutil.Address) ([]DepositUtxo, error)
+	// SendBitcoinToUser pays the user from the resolver's wallet.
+	SendBitcoinToUser(ctx context.Context, toAddress string, amount btcutil.Amount) (string, error)
+	// TrackPayout hands a payout SendBitcoinToUser broadcast before a restart
+	// back to the fee bumper, until it confirms. toAddress and amount are what
+	// it pays. Payouts that are already tracked or confirmed are left alone.
+	TrackPayout(ctx context.Context, txHash *chainhash.Hash, toAddress string, amount btcutil.Amount) error
+	// CurrentHeight returns the best chain tip height.
+	CurrentHeight(ctx context.Context) (int64, error)
+	// BroadcastTransaction submits an already-signed transaction.
+	BroadcastTransaction(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error)
+	// GetConfirmations reports a transaction's confirmations, 0 meaning mempool.
+	GetConfirmations(ctx context.Context, txHash *chainhash.Hash) (int64, error)
+	// GetTxBlock returns the block that confirmed a transaction, or nil while it
+	// is in the mempool. ErrTxNotFound means it is in neither, e.g. because a
+	// conflicting transaction replaced it.
+	GetTxBlock(ctx context.Context, txHash *chainhash.Hash) (*chainhash.Hash, error)
+	// IsInActiveChain reports whether a block is part of the best chain, as
+	// opposed to a fork that was reorganized away.
+	IsInActiveChain(ctx context.Context, blockHash *chainhash.Hash) (bool, error)
+	// BestBlockHash returns the hash of the best chain tip.
+	BestBlockHash(ctx context.Context) (*chainhash.Hash, error)
+}
+
+// Deposit is what a user paid to an HTLC address, possibly over several
+// transactions.
+type Deposit struct {
+	Utxos []DepositUtxo // Ordered by outpoint
+	Total btcutil.Amount
+}
+
+// DepositUtxo is one confirmed output paid to an HTLC address.
+type DepositUtxo struct {
+	OutPoint wire.OutPoint
+	Amount   btcutil.Amount
+}
+
+// ErrTxNotFound is returned when a backend knows a transaction neither in its
+// mempool nor in the best chain.
+var ErrTxNotFound = errors.New("transaction not found in the mempool or best chain")
+
+// BtcBackend is a BtcChain together with the background loops it needs
+// running. main starts them for whichever backend BTC_BACKEND selects.
+type BtcBackend interface {
+	BtcChain
+	// RunTxTracker bumps the fees of the backend's stuck broadcasts until ctx
+	// is cancelled.
+	RunTxTracker(ctx context.Context)
+	// RunDepositWatcher detects deposits for MonitorForDeposit until ctx is
+	// cancelled.
+	RunDepositWatcher(ctx context.Context)
+	// SetTxReplacedHandler registers fn to be told when a fee bump replaces a
+	// broadcast with a new txid.
+	SetTxReplacedHandler(fn func(oldHash, newHash chainhash.Hash))
+}
+
+// NewBtcBackend creates the BTC backend selected by BTC_BACKEND.
+func NewBtcBackend(cfg *config.BtcConfig, walletKey *btcec.PrivateKey) (BtcBackend, error) {
+	switch cfg.Backend {
+	case "bitcoind", "":
+		return NewBtcHtlcService(cfg)
+	case "esplora":
+		return NewEsploraService(cfg, walletKey)
+	default:
+		return nil, fmt.Errorf("unknown BTC_BACKEND %q: expected bitcoind or esplora", cfg.Backend)
+	}
+}
+
+// EvmChain is the EVM side of a swap as seen by the orchestrator: escrow
+// creation, claim watching and refunds. EvmService is the go-ethereum-backed
+// implementation.
+type EvmChain interface {
+	// DepositIntoEscrow funds the settlement escrow for a secret hash.
+	DepositIntoEscrow(ctx context.Context, userAddress common.Address, amount *big.Int, secretHash [32]byte, lockTime *big.Int) (*types.Transaction, error)
+	// MonitorForClaimEvent blocks until the user claims the escrow, returning the
+	// revealed secret, or until the deadline passes on-chain without a claim.
+	// Scanning resumes from cursor, which is advanced as blocks are covered.
+	MonitorForClaimEvent(ctx context.Context, secretHash [32]byte, deadline time.Time, cursor BlockCursor) ([]byte, error)
+	// GetEscrow reads the on-chain escrow state.
+	GetEscrow(ctx context.Context, secretHash [32]byte) (*settlement.FusionBtcSettlementEscrow, error)
+	// RefundEscrow returns an expired, unclaimed escrow to the resolver.
+	RefundEscrow(ctx context.Context, secretHash [32]byte) (*types.Transaction, error)
+	// GetTxReceipt returns the receipt of a mined transaction, or nil while it
+	// is pending. ErrTxNotFound means the node knows it in neither state.
+	GetTxReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	// LatestBlockTime returns the timestamp of the latest block.
+	LatestBlockTime(ctx context.Context) (time.Time, error)
+	// LatestBlockNumber returns the number of the latest block.
+	LatestBlockNumber(ctx context.Context) (uint64, error)
+}
+
+// BlockCursor records how far a chain has been scanned for a swap, so that a
+// restarted monitor resumes where it left off instead of missing blocks.
+type BlockCursor interface {
+	// Next returns the first block that has not been scanned yet.
+	Next() uint64
+	// Advance records that every block before next has been scanned. It
+	// returns once the new position is durable.
+	Advance(next uint64) error
+}
+
+// Compile-time checks that the production services satisfy the interfaces.
+var (
+	_ BtcBackend = (*BtcHtlcService)(nil)
+	_ BtcBackend = (*EsploraService)(nil)
+	_ EvmChain   = (*EvmService)(nil)
+)
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+
+	"fusion-btc-resolver/config"
+)
+
+// The resolver claims HTLCs with either one fixed key, from BTC_CLAIM_KEY, or
+// a fresh key per swap derived from the BIP32 seed in BTC_CLAIM_SEED. Per-swap
+// keys are hardened children m/0'/<index>', so a leaked claim key reveals
+// neither the seed nor any other swap's key. A swap records the path of its
+// claim key, empty for the fixed key, and the key is re-derived to sign.
+
+// claimKeyAccount is the hardened account under which claim keys are derived.
+const claimKeyAccount = 0
+
+// ClaimKeyring holds the resolver's HTLC claim key material.
+type ClaimKeyring struct {
+	fixed   *btcec.PrivateKey       // BTC_CLAIM_KEY, nil when keys are derived
+	account *hdkeychain.ExtendedKey // m/0' of BTC_CLAIM_SEED, nil for a fixed key
+}
+
+// NewClaimKeyring loads the claim key material configured in cfg. Exactly one
+// of BTC_CLAIM_KEY and BTC_CLAIM_SEED must be set.
+func NewClaimKeyring(cfg *config.BtcConfig, net *chaincfg.Params) (*ClaimKeyring, error) {
+	switch {
+	case cfg.ClaimKey != "" && cfg.ClaimSeed != "":
+		return nil, fmt.Errorf("set only one of BTC_CLAIM_KEY and BTC_CLAIM_SEED")
+	case cfg.ClaimKey != "":
+		wif, err := decodeClaimKey(cfg.ClaimKey, net)
+		if err != nil {
+			return nil, err
+		}
+		return &ClaimKeyring{fixed: wif.PrivKey}, nil
+	case cfg.ClaimSeed != "":
+		seed, err := hex.DecodeString(cfg.ClaimSeed)
+		if err != nil {
+			return nil, fmt.Errorf("BTC_CLAIM_SEED must be hex: %v", err)
+		}
+		defer clear(seed)
+		return newSeedClaimKeyring(seed, net)
+	default:
+		return nil, fmt.Errorf("BTC_CLAIM_KEY or BTC_CLAIM_SEED is required to claim HTLCs")
+	}
+}
+
+// decodeClaimKey decodes a BTC_CLAIM_KEY WIF for net.
+func decodeClaimKey(claimKey string, net *chaincfg.Params) (*btcutil.WIF, error) {
+	wif, err := btcutil.DecodeWIF(claimKey)
+	if err != nil {
+		return nil, fmt.Errorf("BTC_CLAIM_KEY: %v", err)
+	}
+	if !wif.IsForNet(net) {
+		return nil, fmt.Errorf("BTC_CLAIM_KEY is not a %s key", net.Name)
+	}
+	return wif, nil
+}
+
+// newSeedClaimKeyring derives per-swap claim keys from a BIP32 seed.
+func newSeedClaimKeyring(seed []byte, net *chaincfg.Params) (*ClaimKeyring, error) {
+	master, err := hdkeychain.NewMaster(seed, net)
+	if err != nil {
+		return nil, fmt.Errorf("BTC_CLAIM_SEED: %v", err)
+	}
+	account, err := master.Derive(hdkeychain.HardenedKeyStart + claimKeyAccount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive claim key account: %v", err)
+	}
+	return &ClaimKeyring{account: account}, nil
+}
+
+// NewClaimKey returns the claim public key for the swap with the given key
+// index, in compressed form, and the path to re-derive its private key with.
+// The path is empty for a fixed key.
+func (k *ClaimKeyring) NewClaimKey(index uint32) (string, []byte, error) {
+	if k.account == nil {
+		return "", k.fixed.PubKey().SerializeCompressed(), nil
+	}
+	path := fmt.Sprintf("m/%d'/%d'", claimKeyAccount, index)
+	key, err := k.ClaimKey(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, key.PubKey().SerializeCompressed(), nil
+}
+
+// ClaimKey returns the claim private key at path, as returned by NewClaimKey.
+func (k *ClaimKeyring) ClaimKey(path string) (*btcec.PrivateKey, error) {
+	if k.account == nil {
+		if path != "" {
+			return nil, fmt.Errorf("claim key path %q needs BTC_CLAIM_SEED, but BTC_CLAIM_KEY is configured", path)
+		}
+		return k.fixed, nil
+	}
+
+	// Only the paths NewClaimKey hands out are accepted.
+	rest, ok := strings.CutPrefix(path, fmt.Sprintf("m/%d'/", claimKeyAccount))
+	digits, hardened := strings.CutSuffix(rest, "'")
+	index, err := strconv.ParseUint(digits, 10, 31)
+	if !ok || !hardened || err != nil || path != fmt.Sprintf("m/%d'/%d'", claimKeyAccount, index) {
+		return nil, fmt.Errorf("invalid claim key path %q", path)
+	}
+	child, err := k.account.Derive(hdkeychain.HardenedKeyStart + uint32(index))
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive claim key %s: %v", path, err)
+	}
+	return child.ECPrivKey()
+}
+
+// ParseRefundPubKey decodes the user's hex-encoded refund public key, which
+// must be a compressed secp256k1 point.
+func ParseRefundPubKey(pubKeyHex string) ([]byte, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(pubKeyHex, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("not hex: %v", err)
+	}
+	if len(raw) != btcec.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("expected a %d-byte compressed key, got %d bytes", btcec.PubKeyBytesLenCompressed, len(raw))
+	}
+	if _, err := btcec.ParsePubKey(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+
+	"fusion-btc-resolver/config"
+)
+
+// TestClaimKeyringDerivesPerSwapKeys checks that every key index gets its own
+// claim key, and that the returned path re-derives it.
+func TestClaimKeyringDerivesPerSwapKeys(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	keys, err := NewClaimKeyring(&config.BtcConfig{ClaimSeed: "000102030405060708090a0b0c0d0e0f"}, net)
+	if err != nil {
+		t.Fatalf("NewClaimKeyring failed: %v", err)
+	}
+
+	path0, pub0, err := keys.NewClaimKey(0)
+	if err != nil {
+		t.Fatalf("NewClaimKey failed: %v", err)
+	}
+	path1, pub1, _ := keys.NewClaimKey(1)
+	if path0 != "m/0'/0'" || path1 != "m/0'/1'" || bytes.Equal(pub0, pub1) {
+		t.Fatalf("expected distinct keys at m/0'/0' and m/0'/1', got %s %x and %s %x", path0, pub0, path1, pub1)
+	}
+
+	key, err := keys.ClaimKey(path1)
+	if err != nil {
+		t.Fatalf("ClaimKey failed: %v", err)
+	}
+	if !bytes.Equal(key.PubKey().SerializeCompressed(), pub1) {
+		t.Errorf("path %s re-derived a different key", path1)
+	}
+
+	for _, path := range []string{"", "m/0'/1", "m/1'/1'", "m/0'/01'", "m/0'/2147483648'", "m/0'/1'/2'"} {
+		if _, err := keys.ClaimKey(path); err == nil {
+			t.Errorf("expected path %q to be rejected", path)
+		}
+	}
+}
+
+// TestClaimKeyringFixedKey checks that BTC_CLAIM_KEY is used for every swap.
+func TestClaimKeyringFixedKey(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	priv, _ := btcec.NewPrivateKey()
+	wif, _ := btcutil.NewWIF(priv, net, true)
+	keys, err := NewClaimKeyring(&config.BtcConfig{ClaimKey: wif.String()}, net)
+	if err != nil {
+		t.Fatalf("NewClaimKeyring failed: %v", err)
+	}
+
+	path, pub, err := keys.NewClaimKey(5)
+	if err != nil || path != "" || !bytes.Equal(pub, priv.PubKey().SerializeCompressed()) {
+		t.Errorf("expected the fixed key with an empty path, got %q %x %v", path, pub, err)
+	}
+	if key, err := keys.ClaimKey(""); err != nil || !key.Key.Equals(&priv.Key) {
+		t.Errorf("expected the fixed key back, got %v", err)
+	}
+	if _, err := keys.ClaimKey("m/0'/5'"); err == nil {
+		t.Error("expected a derived path to be rejected without a seed")
+	}
+
+	mainnetWif, _ := btcutil.NewWIF(priv, &chaincfg.MainNetParams, true)
+	bad := []*config.BtcConfig{
+		{},
+		{ClaimKey: wif.String(), ClaimSeed: "000102030405060708090a0b0c0d0e0f"},
+		{ClaimKey: mainnetWif.String()},
+		{ClaimSeed: "not hex"},
+		{ClaimSeed: "0001"}, // Below the BIP32 minimum of 16 bytes
+	}
+	for _, cfg := range bad {
+		if _, err := NewClaimKeyring(cfg, net); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+// TestParseRefundPubKey checks that only compressed points are accepted.
+func TestParseRefundPubKey(t *testing.T) {
+	priv, _ := btcec.NewPrivateKey()
+	compressed := priv.PubKey().SerializeCompressed()
+	if key, err := ParseRefundPubKey(hex.EncodeToString(compressed)); err != nil || !bytes.Equal(key, compressed) {
+		t.Errorf("expected a compressed key to parse, got %x %v", key, err)
+	}
+
+	offCurve := append([]byte{0x02}, bytes.Repeat([]byte{0xff}, 32)...)
+	for name, input := range map[string]string{
+		"empty":        "",
+		"not hex":      "zz",
+		"uncompressed": hex.EncodeToString(priv.PubKey().SerializeUncompressed()),
+		"x-only":       hex.EncodeToString(compressed[1:]),
+		"off curve":    hex.EncodeToString(offCurve),
+	} {
+		if _, err := ParseRefundPubKey(input); err == nil {
+			t.Errorf("%s: expected %q to be rejected", name, input)
+		}
+	}
+}
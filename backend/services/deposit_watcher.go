@@ -0,0 +1,481 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/lightninglabs/gozmq"
+)
+
+// Deposits to HTLC addresses are detected by one DepositWatcher shared by
+// every swap, so that hundreds of concurrent swaps cost one subscription and
+// one batched poll instead of a polling loop each:
+//
+//   - Transactions from bitcoind's ZMQ rawtx feed are matched against the
+//     output scripts of every watched HTLC, so a deposit is seen as soon as it
+//     reaches the mempool.
+//   - Each block from the hashblock feed triggers a poll of just the addresses
+//     with deposits seen so far, to pick up their confirmations.
+//   - Every BTC_DEPOSIT_POLL_INTERVAL, a reconciliation poll lists the unspent
+//     outputs of every watched address in one call. It catches whatever the
+//     feeds missed: messages dropped while disconnected, or no ZMQ at all.
+//
+// A gap in a feed's sequence numbers also triggers an immediate
+// reconciliation.
+
+// ZMQ topics published by bitcoind.
+const (
+	zmqRawTx     = "rawtx"
+	zmqHashBlock = "hashblock"
+)
+
+// zmqReadTimeout bounds how long a subscriber blocks on a quiet connection
+// before checking whether it should stop.
+const zmqReadTimeout = 5 * time.Second
+
+// depositBackend is what a DepositWatcher needs from the node.
+type depositBackend interface {
+	// listUnspent returns the unspent outputs, mempool ones included, paid to
+	// any of addrs.
+	listUnspent(ctx context.Context, addrs []btcutil.Address) ([]btcjson.ListUnspentResult, error)
+}
+
+// listAddressUtxos returns the unspent outputs paid to address, ordered by
+// outpoint.
+func listAddressUtxos(ctx context.Context, backend depositBackend, address btcutil.Address) ([]DepositUtxo, error) {
+	unspent, err := backend.listUnspent(ctx, []btcutil.Address{address})
+	if err != nil {
+		return nil, fmt.Errorf("error checking for unspent txs: %v", err)
+	}
+	script := hex.EncodeToString(mustPayToAddrScript(address))
+	var utxos []DepositUtxo
+	for _, u := range unspent {
+		if u.ScriptPubKey != script {
+			continue
+		}
+		txHash, err := chainhash.NewHashFromStr(u.TxID)
+		if err != nil {
+			return nil, fmt.Errorf("node returned invalid txid %q: %v", u.TxID, err)
+		}
+		amount, err := btcutil.NewAmount(u.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("node returned invalid amount %v: %v", u.Amount, err)
+		}
+		utxos = append(utxos, DepositUtxo{OutPoint: *wire.NewOutPoint(txHash, u.Vout), Amount: amount})
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		a, b := utxos[i].OutPoint, utxos[j].OutPoint
+		if c := bytes.Compare(a.Hash[:], b.Hash[:]); c != 0 {
+			return c < 0
+		}
+		return a.Index < b.Index
+	})
+	return utxos, nil
+}
+
+// seenOutput is an output paid to a watched address.
+type seenOutput struct {
+	amount        btcutil.Amount
+	confirmations int64
+}
+
+// depositWatch is the state of one watched HTLC address.
+type depositWatch struct {
+	address btcutil.Address
+	outputs map[wire.OutPoint]seenOutput // Guarded by DepositWatcher.mu
+	wake    chan struct{}                // Signalled whenever outputs changes
+}
+
+func (d *depositWatch) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// DepositWatcher detects deposits to every active HTLC address at once.
+type DepositWatcher struct {
+	backend depositBackend
+
+	mu      sync.Mutex
+	watches map[string]*depositWatch // Keyed by output script
+
+	reconcileNow chan struct{} // Requests an immediate reconciliation
+	lastSeq      map[string]uint32
+}
+
+func newDepositWatcher(backend depositBackend) *DepositWatcher {
+	return &DepositWatcher{
+		backend:      backend,
+		watches:      make(map[string]*depositWatch),
+		reconcileNow: make(chan struct{}, 1),
+		lastSeq:      make(map[string]uint32),
+	}
+}
+
+// watch starts watching address. The returned function stops it.
+func (w *DepositWatcher) watch(address btcutil.Address) (*depositWatch, func()) {
+	key := string(mustPayToAddrScript(address))
+	d := &depositWatch{
+		address: address,
+		outputs: make(map[wire.OutPoint]seenOutput),
+		wake:    make(chan struct{}, 1),
+	}
+	w.mu.Lock()
+	w.watches[key] = d
+	w.mu.Unlock()
+	return d, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.watches[key] == d {
+			delete(w.watches, key)
+		}
+	}
+}
+
+// await blocks until the outputs paid to the watched address add up to at
+// least amount, counting only those with minConf confirmations, and returns
+// them. Payments split over several transactions are summed, and the total
+// may overshoot amount. Once the deadline passes, whatever was paid is
+// settled: with nothing paid ErrDepositExpired is returned, otherwise the
+// outputs are returned as soon as every one seen has confirmed, even if they
+// fall short of amount. A payment in flight is always waited for.
+func (w *DepositWatcher) await(ctx context.Context, address btcutil.Address, amount btcutil.Amount, minConf int64, deadline time.Time) (*Deposit, error) {
+	d, stop := w.watch(address)
+	defer stop()
+
+	// Anything paid before the watch started is only found by polling.
+	if err := w.reconcile(ctx, []*depositWatch{d}); err != nil {
+		return nil, err
+	}
+
+	expiry := time.NewTimer(time.Until(deadline))
+	defer expiry.Stop()
+	logged := make(map[wire.OutPoint]int64)
+	for {
+		deposit := &Deposit{}
+		var pending btcutil.Amount
+		w.mu.Lock()
+		for outpoint, out := range d.outputs {
+			if out.confirmations >= minConf {
+				deposit.Utxos = append(deposit.Utxos, DepositUtxo{OutPoint: outpoint, Amount: out.amount})
+				deposit.Total += out.amount
+				continue
+			}
+			pending += out.amount
+			if prev, ok := logged[outpoint]; !ok || prev != out.confirmations {
+				logged[outpoint] = out.confirmations
+				log.Printf("[BTC_SERVICE] Deposit %s of %s seen with %d/%d confirmations", outpoint, out.amount, out.confirmations, minConf)
+			}
+		}
+		w.mu.Unlock()
+
+		expired := time.Now().After(deadline)
+		if deposit.Total >= amount || (expired && pending == 0 && deposit.Total > 0) {
+			sort.Slice(deposit.Utxos, func(i, j int) bool {
+				a, b := deposit.Utxos[i].OutPoint, deposit.Utxos[j].OutPoint
+				if c := bytes.Compare(a.Hash[:], b.Hash[:]); c != 0 {
+					return c < 0
+				}
+				return a.Index < b.Index
+			})
+			log.Printf("[BTC_SERVICE] Deposit confirmed! %s of %s expected, in %d outputs to %s", deposit.Total, amount, len(deposit.Utxos), address)
+			return deposit, nil
+		}
+		if expired && pending == 0 {
+			return nil, ErrDepositExpired
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-d.wake:
+		case <-expiry.C:
+		}
+	}
+}
+
+// reconcile replaces the outputs of the given watches with what the node
+// lists, in one call. Outputs matched from the rawtx feed while the call was
+// in flight are kept, since the node's answer may predate them.
+func (w *DepositWatcher) reconcile(ctx context.Context, watches []*depositWatch) error {
+	if len(watches) == 0 {
+		return nil
+	}
+	addrs := make([]btcutil.Address, len(watches))
+	before := make([]map[wire.OutPoint]bool, len(watches))
+	w.mu.Lock()
+	for i, d := range watches {
+		addrs[i] = d.address
+		before[i] = make(map[wire.OutPoint]bool, len(d.outputs))
+		for outpoint := range d.outputs {
+			before[i][outpoint] = true
+		}
+	}
+	w.mu.Unlock()
+	unspent, err := w.backend.listUnspent(ctx, addrs)
+	if err != nil {
+		return fmt.Errorf("error checking for unspent txs: %v", err)
+	}
+
+	found := make(map[string]map[wire.OutPoint]seenOutput, len(watches))
+	for _, u := range unspent {
+		script, err := hex.DecodeString(u.ScriptPubKey)
+		if err != nil {
+			continue
+		}
+		txHash, err := chainhash.NewHashFromStr(u.TxID)
+		if err != nil {
+			return fmt.Errorf("node returned invalid txid %q: %v", u.TxID, err)
+		}
+		amount, err := btcutil.NewAmount(u.Amount)
+		if err != nil {
+			continue
+		}
+		outputs := found[string(script)]
+		if outputs == nil {
+			outputs = make(map[wire.OutPoint]seenOutput)
+			found[string(script)] = outputs
+		}
+		outputs[*wire.NewOutPoint(txHash, u.Vout)] = seenOutput{amount, u.Confirmations}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, d := range watches {
+		outputs := found[string(mustPayToAddrScript(d.address))]
+		if outputs == nil {
+			outputs = make(map[wire.OutPoint]seenOutput)
+		}
+		for outpoint, out := range d.outputs {
+			if _, listed := outputs[outpoint]; !listed {
+				if !before[i][outpoint] {
+					outputs[outpoint] = out
+				}
+			}
+		}
+		if !sameOutputs(d.outputs, outputs) {
+			d.outputs = outputs
+			d.signal()
+		}
+	}
+	return nil
+}
+
+func sameOutputs(a, b map[wire.OutPoint]seenOutput) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for outpoint, out := range a {
+		if b[outpoint] != out {
+			return false
+		}
+	}
+	return true
+}
+
+// allWatches returns every active watch, or only those with outputs seen.
+func (w *DepositWatcher) allWatches(withOutputs bool) []*depositWatch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watches := make([]*depositWatch, 0, len(w.watches))
+	for _, d := range w.watches {
+		if !withOutputs || len(d.outputs) > 0 {
+			watches = append(watches, d)
+		}
+	}
+	return watches
+}
+
+// matchTx records the outputs of tx that pay a watched address. They are
+// unconfirmed until a poll says otherwise.
+func (w *DepositWatcher) matchTx(tx *wire.MsgTx) {
+	txHash := tx.TxHash()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, out := range tx.TxOut {
+		d, ok := w.watches[string(out.PkScript)]
+		if !ok {
+			continue
+		}
+		outpoint := *wire.NewOutPoint(&txHash, uint32(i))
+		if _, known := d.outputs[outpoint]; known {
+			continue
+		}
+		d.outputs[outpoint] = seenOutput{amount: btcutil.Amount(out.Value)}
+		d.signal()
+		log.Printf("[BTC_SERVICE] Saw %s paid to %s in tx %s", btcutil.Amount(out.Value), d.address, txHash)
+	}
+}
+
+// handleMessage processes one ZMQ notification. It reports whether a block
+// was announced.
+func (w *DepositWatcher) handleMessage(topic string, body, seq []byte) (bool, error) {
+	if len(seq) == 4 {
+		n := binary.LittleEndian.Uint32(seq)
+		w.mu.Lock()
+		last, ok := w.lastSeq[topic]
+		w.lastSeq[topic] = n
+		w.mu.Unlock()
+		if ok && n != last+1 {
+			log.Printf("[BTC_SERVICE] WARN: ZMQ %s sequence jumped from %d to %d, reconciling", topic, last, n)
+			w.requestReconcile()
+		}
+	}
+
+	switch topic {
+	case zmqRawTx:
+		tx := wire.NewMsgTx(wire.TxVersion)
+		if err := tx.Deserialize(bytes.NewReader(body)); err != nil {
+			return false, fmt.Errorf("invalid rawtx notification: %v", err)
+		}
+		w.matchTx(tx)
+		return false, nil
+	case zmqHashBlock:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unexpected ZMQ topic %q", topic)
+	}
+}
+
+func (w *DepositWatcher) requestReconcile() {
+	select {
+	case w.reconcileNow <- struct{}{}:
+	default:
+	}
+}
+
+// Run polls every interval, and subscribes to the given ZMQ endpoints if they
+// are set, until ctx is cancelled.
+func (w *DepositWatcher) Run(ctx context.Context, interval time.Duration, rawTxEndpoint, hashBlockEndpoint string) {
+	blocks := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	subscribe := func(endpoint string, topics ...string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.subscribe(ctx, endpoint, topics, blocks)
+		}()
+	}
+	switch {
+	case rawTxEndpoint != "" && rawTxEndpoint == hashBlockEndpoint:
+		subscribe(rawTxEndpoint, zmqRawTx, zmqHashBlock)
+	default:
+		if rawTxEndpoint != "" {
+			subscribe(rawTxEndpoint, zmqRawTx)
+		}
+		if hashBlockEndpoint != "" {
+			subscribe(hashBlockEndpoint, zmqHashBlock)
+		}
+	}
+	defer wg.Wait()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var watches []*depositWatch
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			watches = w.allWatches(false)
+		case <-w.reconcileNow:
+			watches = w.allWatches(false)
+		case <-blocks:
+			watches = w.allWatches(true)
+		}
+		if err := w.reconcile(ctx, watches); err != nil && ctx.Err() == nil {
+			log.Printf("[BTC_SERVICE] ERROR: Deposit reconciliation failed: %v", err)
+		}
+	}
+}
+
+// subscribe reads notifications from one ZMQ endpoint until ctx is cancelled,
+// reconnecting as needed. Block announcements are forwarded to blocks.
+func (w *DepositWatcher) subscribe(ctx context.Context, endpoint string, topics []string, blocks chan<- struct{}) {
+	for ctx.Err() == nil {
+		conn, err := gozmq.Subscribe(endpoint, topics, zmqReadTimeout)
+		if err != nil {
+			log.Printf("[BTC_SERVICE] ERROR: ZMQ subscription to %s failed: %v", endpoint, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(zmqReadTimeout):
+			}
+			continue
+		}
+		log.Printf("[BTC_SERVICE] Subscribed to %v notifications from %s", topics, endpoint)
+		// Anything published before the subscription was missed.
+		w.requestReconcile()
+		w.receive(ctx, conn, blocks)
+	}
+}
+
+func (w *DepositWatcher) receive(ctx context.Context, conn *gozmq.Conn, blocks chan<- struct{}) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	for {
+		msg, err := conn.Receive(nil)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// A quiet connection, or one gozmq has just re-established.
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[BTC_SERVICE] ERROR: ZMQ connection lost: %v", err)
+			}
+			return
+		}
+		if len(msg) < 2 {
+			continue
+		}
+		var seq []byte
+		if len(msg) > 2 {
+			seq = msg[2]
+		}
+		block, err := w.handleMessage(string(msg[0]), msg[1], seq)
+		if err != nil {
+			log.Printf("[BTC_SERVICE] WARN: %v", err)
+			continue
+		}
+		if block {
+			select {
+			case blocks <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// listUnspent lists unspent outputs, mempool ones included, of watch-only
+// addresses.
+func (s *BtcHtlcService) listUnspent(ctx context.Context, addrs []btcutil.Address) ([]btcjson.ListUnspentResult, error) {
+	return withContext(ctx, func() ([]btcjson.ListUnspentResult, error) {
+		return s.client.ListUnspentMinMaxAddresses(0, 9999999, addrs)
+	})
+}
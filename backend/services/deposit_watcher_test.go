@@ -0,0 +1,241 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// fakeDepositBackend answers listunspent from an in-memory set of outputs.
+type fakeDepositBackend struct {
+	mu      sync.Mutex
+	unspent []btcjson.ListUnspentResult
+	calls   int
+}
+
+func (f *fakeDepositBackend) listUnspent(ctx context.Context, addrs []btcutil.Address) ([]btcjson.ListUnspentResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return append([]btcjson.ListUnspentResult(nil), f.unspent...), nil
+}
+
+func (f *fakeDepositBackend) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// pay lists output vout of tx as unspent, replacing any earlier listing of it.
+func (f *fakeDepositBackend) pay(tx *wire.MsgTx, vout uint32, confirmations int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := tx.TxOut[vout]
+	txid := tx.TxHash().String()
+	unspent := f.unspent[:0]
+	for _, u := range f.unspent {
+		if u.TxID != txid || u.Vout != vout {
+			unspent = append(unspent, u)
+		}
+	}
+	f.unspent = append(unspent, btcjson.ListUnspentResult{
+		TxID:          txid,
+		Vout:          vout,
+		ScriptPubKey:  hex.EncodeToString(out.PkScript),
+		Amount:        btcutil.Amount(out.Value).ToBTC(),
+		Confirmations: confirmations,
+	})
+}
+
+func testDepositTx(t *testing.T, to btcutil.Address, amount btcutil.Amount) *wire.MsgTx {
+	t.Helper()
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 7}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1_000, mustPayToAddrScript(to))) // Change-sized output first
+	tx.AddTxOut(wire.NewTxOut(int64(amount), mustPayToAddrScript(to)))
+	return tx
+}
+
+func zmqMessage(t *testing.T, w *DepositWatcher, topic string, body []byte, seq uint32) bool {
+	t.Helper()
+	var seqBytes [4]byte
+	binary.LittleEndian.PutUint32(seqBytes[:], seq)
+	block, err := w.handleMessage(topic, body, seqBytes[:])
+	if err != nil {
+		t.Fatalf("handleMessage(%s) failed: %v", topic, err)
+	}
+	return block
+}
+
+// TestDepositWatcherMatchesRawTx checks that a deposit announced over ZMQ is
+// seen without polling, and accepted once a block poll confirms it.
+func TestDepositWatcherMatchesRawTx(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	htlcAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+	backend := &fakeDepositBackend{}
+	w := newDepositWatcher(backend)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result := make(chan error, 1)
+	var got *Deposit
+	go func() {
+		deposit, err := w.await(ctx, htlcAddr, 50_000, 1, time.Now().Add(time.Hour))
+		got = deposit
+		result <- err
+	}()
+	for backend.callCount() == 0 {
+		time.Sleep(time.Millisecond) // Let the initial poll find nothing
+	}
+
+	tx := testDepositTx(t, htlcAddr, 50_000)
+	var raw bytes.Buffer
+	tx.Serialize(&raw)
+	if zmqMessage(t, w, zmqRawTx, raw.Bytes(), 0) {
+		t.Fatal("rawtx reported as a block")
+	}
+	if watches := w.allWatches(true); len(watches) != 1 || len(watches[0].outputs) != 2 {
+		t.Fatalf("expected both outputs of the deposit tx to be seen")
+	}
+	callsBefore := backend.callCount()
+
+	// A block triggers a poll of just the addresses with deposits seen.
+	if !zmqMessage(t, w, zmqHashBlock, make([]byte, 32), 0) {
+		t.Fatal("hashblock not reported as a block")
+	}
+	backend.pay(tx, 1, 1)
+	if err := w.reconcile(ctx, w.allWatches(true)); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	if err := <-result; err != nil {
+		t.Fatalf("await failed: %v", err)
+	}
+	if want := (wire.OutPoint{Hash: tx.TxHash(), Index: 1}); len(got.Utxos) != 1 || got.Utxos[0].OutPoint != want {
+		t.Errorf("expected outpoint %s, got %+v", want, got.Utxos)
+	}
+	if calls := backend.callCount() - callsBefore; calls != 1 {
+		t.Errorf("expected one poll for the block, got %d", calls)
+	}
+}
+
+// TestDepositWatcherReconciles checks that a deposit the feeds never
+// announced is still found by the reconciliation poll.
+func TestDepositWatcherReconciles(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	htlcAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+	backend := &fakeDepositBackend{}
+	w := newDepositWatcher(backend)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go w.Run(ctx, 10*time.Millisecond, "", "")
+
+	tx := testDepositTx(t, htlcAddr, 50_000)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		backend.pay(tx, 1, 3)
+	}()
+	deposit, err := w.await(ctx, htlcAddr, 50_000, 3, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("await failed: %v", err)
+	}
+	if deposit.Total != 50_000 || deposit.Utxos[0].OutPoint != (wire.OutPoint{Hash: tx.TxHash(), Index: 1}) {
+		t.Errorf("unexpected deposit %+v", deposit)
+	}
+}
+
+// TestDepositWatcherExpiry checks that an unpaid address expires, while one
+// with an unconfirmed deposit is waited on past the deadline.
+func TestDepositWatcherExpiry(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	htlcAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+	backend := &fakeDepositBackend{}
+	w := newDepositWatcher(backend)
+
+	_, err := w.await(context.Background(), htlcAddr, 50_000, 1, time.Now().Add(20*time.Millisecond))
+	if !errors.Is(err, ErrDepositExpired) {
+		t.Fatalf("expected ErrDepositExpired, got %v", err)
+	}
+
+	backend.pay(testDepositTx(t, htlcAddr, 50_000), 1, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = w.await(ctx, htlcAddr, 50_000, 1, time.Now().Add(20*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a seen deposit to be waited on, got %v", err)
+	}
+}
+
+// TestDepositWatcherSumsSplitDeposits checks that a deposit paid in several
+// transactions is summed, and that an underpayment is returned once the
+// deadline passes and everything paid has confirmed.
+func TestDepositWatcherSumsSplitDeposits(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	htlcAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Two payments that together overshoot the amount.
+	backend := &fakeDepositBackend{}
+	w := newDepositWatcher(backend)
+	first, second := testDepositTx(t, htlcAddr, 30_000), testDepositTx(t, htlcAddr, 25_000)
+	backend.pay(first, 1, 1)
+	backend.pay(second, 1, 1)
+	deposit, err := w.await(ctx, htlcAddr, 50_000, 1, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("await failed: %v", err)
+	}
+	if deposit.Total != 55_000 || len(deposit.Utxos) != 2 {
+		t.Errorf("expected 55000 sat in 2 outputs, got %s in %d", deposit.Total, len(deposit.Utxos))
+	}
+
+	// An underpayment still confirming at the deadline is waited for.
+	backend = &fakeDepositBackend{}
+	w = newDepositWatcher(backend)
+	go w.Run(ctx, 10*time.Millisecond, "", "")
+	backend.pay(first, 1, 0)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		backend.pay(first, 1, 1)
+	}()
+	deposit, err = w.await(ctx, htlcAddr, 50_000, 1, time.Now().Add(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("await failed: %v", err)
+	}
+	if deposit.Total != 30_000 || len(deposit.Utxos) != 1 {
+		t.Errorf("expected a 30000 sat underpayment, got %s in %d outputs", deposit.Total, len(deposit.Utxos))
+	}
+}
+
+// TestDepositWatcherSequenceGap checks that a skipped ZMQ message triggers a
+// reconciliation.
+func TestDepositWatcherSequenceGap(t *testing.T) {
+	w := newDepositWatcher(&fakeDepositBackend{})
+	block := make([]byte, 32)
+
+	zmqMessage(t, w, zmqHashBlock, block, 4)
+	zmqMessage(t, w, zmqHashBlock, block, 5)
+	select {
+	case <-w.reconcileNow:
+		t.Fatal("reconciliation requested without a gap")
+	default:
+	}
+
+	zmqMessage(t, w, zmqHashBlock, block, 7)
+	select {
+	case <-w.reconcileNow:
+	default:
+		t.Error("expected a gap to request reconciliation")
+	}
+}
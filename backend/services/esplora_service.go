@@ -0,0 +1,703 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
+)
+
+// EsploraService is a BtcChain backed by an Esplora-compatible REST API, such
+// as blockstream.info or a self-hosted electrs, so the resolver can run
+// without a bitcoind of its own. There is no node wallet to lean on:
+//
+//   - Deposits are found by the shared DepositWatcher, polling the UTXOs of
+//     each HTLC address. No address import is needed, and there is no ZMQ.
+//   - Payouts are built and signed locally from the confirmed UTXOs of the
+//     P2WPKH BTC_RESOLVER_ADDRESS, using BTC_WALLET_KEY.
+//   - Fees come from /fee-estimates. Redeems and payouts are signed locally,
+//     so stuck ones are replaced at a higher rate; CPFP is not available.
+type EsploraService struct {
+	cfg     *config.BtcConfig
+	net     *chaincfg.Params
+	baseURL string
+	http    *http.Client
+
+	walletKey  *btcec.PrivateKey
+	walletAddr btcutil.Address
+
+	payoutMu sync.Mutex             // Serializes payouts from coin selection to broadcast
+	reserved map[wire.OutPoint]bool // Coins spent by a broadcast payout that the API still lists as unspent
+
+	taprootInternalKey string
+	tracker            *TxTracker
+	deposits           *DepositWatcher
+}
+
+// esploraTimeout bounds every request to the API.
+const esploraTimeout = 30 * time.Second
+
+// errEsploraNotFound is returned for 404 responses, which Esplora gives for
+// unknown transactions and blocks.
+var errEsploraNotFound = errors.New("not found")
+
+// NewEsploraService creates a BtcChain that talks to the Esplora API at
+// BTC_ESPLORA_URL, paying out with walletKey, or with BTC_WALLET_KEY when it
+// is nil.
+func NewEsploraService(cfg *config.BtcConfig, walletKey *btcec.PrivateKey) (*EsploraService, error) {
+	netParams, err := validateBtcConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.EsploraURL == "" {
+		return nil, fmt.Errorf("BTC_ESPLORA_URL is required by the esplora backend")
+	}
+
+	if walletKey == nil {
+		wif, err := btcutil.DecodeWIF(cfg.WalletKey)
+		if err != nil {
+			return nil, fmt.Errorf("BTC_WALLET_KEY: %v", err)
+		}
+		walletKey = wif.PrivKey
+	}
+	walletAddr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(walletKey.PubKey().SerializeCompressed()), netParams)
+	if err != nil {
+		return nil, err
+	}
+	if walletAddr.EncodeAddress() != cfg.ResolverAddress {
+		return nil, fmt.Errorf("BTC_WALLET_KEY is the key of %s, not of BTC_RESOLVER_ADDRESS %s", walletAddr, cfg.ResolverAddress)
+	}
+
+	s := &EsploraService{
+		cfg:        cfg,
+		net:        netParams,
+		baseURL:    strings.TrimSuffix(cfg.EsploraURL, "/"),
+		http:       &http.Client{Timeout: esploraTimeout},
+		walletKey:  walletKey,
+		walletAddr: walletAddr,
+		reserved:   make(map[wire.OutPoint]bool),
+
+		taprootInternalKey: cfg.TaprootInternalKey,
+	}
+	s.tracker = newTxTracker(s, cfg.BumpAfterBlocks, FeeRatePerVByte(cfg.MaxFeeRate))
+	s.deposits = newDepositWatcher(s)
+	return s, nil
+}
+
+// RunTxTracker watches every transaction the service broadcasts, replacing
+// any that get stuck, until ctx is cancelled.
+func (s *EsploraService) RunTxTracker(ctx context.Context) {
+	s.tracker.Run(ctx, s.cfg.TxTrackInterval)
+}
+
+// RunDepositWatcher polls every HTLC address every BTC_DEPOSIT_POLL_INTERVAL
+// until ctx is cancelled.
+func (s *EsploraService) RunDepositWatcher(ctx context.Context) {
+	s.deposits.Run(ctx, s.cfg.DepositPollInterval, "", "")
+}
+
+// SetTxReplacedHandler registers fn to be told when a fee bump replaces one
+// of the service's transactions with a new txid.
+func (s *EsploraService) SetTxReplacedHandler(fn func(oldHash, newHash chainhash.Hash)) {
+	s.tracker.SetReplacedHandler(fn)
+}
+
+// NetParams returns the Bitcoin network parameters the service operates on.
+func (s *EsploraService) NetParams() *chaincfg.Params {
+	return s.net
+}
+
+// TaprootKeyMode returns the BTC_TAPROOT_INTERNAL_KEY mode of P2TR HTLCs.
+func (s *EsploraService) TaprootKeyMode() string {
+	return s.taprootInternalKey
+}
+
+// CreateHtlc generates the redeem script and the deposit address of the
+// requested type for a new swap.
+func (s *EsploraService) CreateHtlc(senderPubKey, receiverPubKey []byte, secretHash []byte, lockTime int64, timelockType localcommon.HtlcTimelockType, addrType localcommon.HtlcAddressType) ([]byte, btcutil.Address, error) {
+	return createHtlc(s.net, s.taprootInternalKey, senderPubKey, receiverPubKey, secretHash, lockTime, timelockType, addrType)
+}
+
+// MonitorForDeposit watches the HTLC address until the outputs paid to it add
+// up to expectedAmount, with the same confirmation and expiry rules as
+// BtcHtlcService.MonitorForDeposit.
+func (s *EsploraService) MonitorForDeposit(ctx context.Context, htlcAddress btcutil.Address, expectedAmount btcutil.Amount, deadline time.Time) (*Deposit, error) {
+	log.Printf("[BTC_SERVICE] Monitoring for deposit of %s to address %s (%d confirmations required)", expectedAmount, htlcAddress, s.cfg.DepositConfirmations)
+	return s.deposits.await(ctx, htlcAddress, expectedAmount, s.cfg.DepositConfirmations, deadline)
+}
+
+// RedeemHtlc creates and broadcasts a transaction to redeem funds from the
+// HTLC, like BtcHtlcService.RedeemHtlc.
+func (s *EsploraService) RedeemHtlc(ctx context.Context, fundingTxHashes []*chainhash.Hash, htlcScript []byte, addrType localcommon.HtlcAddressType, redeemAddress btcutil.Address, key *btcec.PrivateKey, preimage []byte, lockTime int64) (*chainhash.Hash, error) {
+	fundingTxs, err := s.fundingTxs(ctx, fundingTxHashes)
+	if err != nil {
+		return nil, err
+	}
+
+	feeRate := s.estimateFeeRate(ctx)
+	tx, err := buildRedeemTx(fundingTxs, htlcScript, addrType, s.net, redeemAddress, key, preimage, lockTime, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[BTC_SERVICE] Redeeming %d HTLC outputs at %s", len(tx.TxIn), feeRate)
+
+	redeemTxHash, err := s.sendRawTx(ctx, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to broadcast redemption tx: %v", err)
+	}
+
+	label := "HTLC refund"
+	if len(preimage) > 0 {
+		label = "HTLC claim"
+	}
+	s.tracker.track(&trackedTx{
+		hash:    *redeemTxHash,
+		label:   label,
+		kind:    txRedeem,
+		raw:     tx,
+		feeRate: feeRate,
+		rebuild: func(rate FeeRate) (*wire.MsgTx, error) {
+			return buildRedeemTx(fundingTxs, htlcScript, addrType, s.net, redeemAddress, key, preimage, lockTime, rate)
+		},
+	})
+	return redeemTxHash, nil
+}
+
+// BuildRefundPsbt builds an unsigned PSBT refunding the HTLC outputs of the
+// funding transactions, like BtcHtlcService.BuildRefundPsbt.
+func (s *EsploraService) BuildRefundPsbt(ctx context.Context, fundingTxHashes []*chainhash.Hash, htlcScript []byte, addrType localcommon.HtlcAddressType, refundAddress btcutil.Address, lockTime int64, feeRate FeeRate) (*psbt.Packet, error) {
+	fundingTxs, err := s.fundingTxs(ctx, fundingTxHashes)
+	if err != nil {
+		return nil, err
+	}
+	if feeRate == 0 {
+		feeRate = s.estimateFeeRate(ctx)
+	}
+	return buildRefundPsbt(fundingTxs, htlcScript, addrType, s.net, refundAddress, lockTime, feeRate)
+}
+
+// fundingTxs fetches the transactions that paid an HTLC.
+func (s *EsploraService) fundingTxs(ctx context.Context, fundingTxHashes []*chainhash.Hash) ([]*wire.MsgTx, error) {
+	fundingTxs := make([]*wire.MsgTx, len(fundingTxHashes))
+	for i, fundingTxHash := range fundingTxHashes {
+		fundingTx, err := s.getTx(ctx, fundingTxHash)
+		if err != nil {
+			return nil, fmt.Errorf("could not get funding tx %s: %v", fundingTxHash, err)
+		}
+		fundingTxs[i] = fundingTx
+	}
+	return fundingTxs, nil
+}
+
+// SendBitcoinToUser pays amount to toAddress from the confirmed UTXOs of the
+// resolver address, returning any change to it.
+func (s *EsploraService) SendBitcoinToUser(ctx context.Context, toAddress string, amount btcutil.Amount) (string, error) {
+	log.Printf("[BTC_SERVICE] Sending %s from resolver to %s", amount, toAddress)
+
+	destAddr, err := DecodeAddressForNet(toAddress, s.net)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination address: %v", err)
+	}
+
+	// Payouts run one at a time, and the coins of each stay reserved until
+	// the API stops listing them as unspent, so no two payouts spend the same
+	// coin even while the API lags behind the mempool.
+	s.payoutMu.Lock()
+	defer s.payoutMu.Unlock()
+
+	utxos, err := s.addressUtxos(ctx, s.walletAddr)
+	if err != nil {
+		return "", err
+	}
+	listed := make(map[wire.OutPoint]bool, len(utxos))
+	coins := make([]walletCoin, 0, len(utxos))
+	for _, u := range utxos {
+		txHash, err := chainhash.NewHashFromStr(u.TxID)
+		if err != nil {
+			return "", fmt.Errorf("API returned invalid txid %q: %v", u.TxID, err)
+		}
+		outpoint := *wire.NewOutPoint(txHash, u.Vout)
+		listed[outpoint] = true
+		if !s.reserved[outpoint] {
+			coins = append(coins, walletCoin{outpoint, btcutil.Amount(u.Value), u.Status.Confirmed})
+		}
+	}
+	for outpoint := range s.reserved {
+		if !listed[outpoint] {
+			delete(s.reserved, outpoint)
+		}
+	}
+
+	feeRate := s.estimateFeeRate(ctx)
+	selected, err := selectCoins(coins, amount, feeRate, destAddr, s.walletAddr)
+	if err != nil {
+		return "", err
+	}
+	tx, err := buildPayoutTx(selected, destAddr, amount, s.walletAddr, s.walletKey, feeRate)
+	if err != nil {
+		return "", err
+	}
+
+	txHash, err := s.sendRawTx(ctx, tx)
+	if err != nil {
+		log.Printf("[BTC_SERVICE] ERROR: Failed to send Bitcoin: %v", err)
+		return "", fmt.Errorf("failed to send Bitcoin: %v", err)
+	}
+	log.Printf("[BTC_SERVICE] ✅ Bitcoin sent successfully! TxHash: %s", txHash)
+	for _, coin := range selected {
+		s.reserved[coin.outpoint] = true
+	}
+
+	// The payout is ours to re-sign, so it is bumped like a redeem, spending
+	// the same coins with less change.
+	s.tracker.track(&trackedTx{
+		hash:    *txHash,
+		label:   "payout",
+		kind:    txRedeem,
+		raw:     tx,
+		feeRate: feeRate,
+		rebuild: func(rate FeeRate) (*wire.MsgTx, error) {
+			return buildPayoutTx(selected, destAddr, amount, s.walletAddr, s.walletKey, rate)
+		},
+	})
+	return txHash.String(), nil
+}
+
+// TrackPayout resumes fee bumping of a payout broadcast before a restart. The
+// payout and the coins it spends are fetched back from the API, so that it can
+// be re-signed at a higher fee like the payouts SendBitcoinToUser tracks. The
+// API must still know the payout: one it dropped while the resolver was down
+// cannot be rebroadcast.
+func (s *EsploraService) TrackPayout(ctx context.Context, txHash *chainhash.Hash, toAddress string, amount btcutil.Amount) error {
+	if s.tracker.tracking(*txHash) {
+		return nil
+	}
+	confirmations, err := s.GetConfirmations(ctx, txHash)
+	if err != nil {
+		return err
+	}
+	if confirmations > 0 {
+		return nil
+	}
+	destAddr, err := DecodeAddressForNet(toAddress, s.net)
+	if err != nil {
+		return fmt.Errorf("invalid destination address: %v", err)
+	}
+	tx, err := s.getTx(ctx, txHash)
+	if err != nil {
+		return fmt.Errorf("could not get payout %s: %v", txHash, err)
+	}
+
+	coins := make([]walletCoin, len(tx.TxIn))
+	var fee btcutil.Amount
+	for i, in := range tx.TxIn {
+		prev, err := s.getTx(ctx, &in.PreviousOutPoint.Hash)
+		if err != nil {
+			return fmt.Errorf("could not get payout input %s: %v", in.PreviousOutPoint, err)
+		}
+		if int(in.PreviousOutPoint.Index) >= len(prev.TxOut) {
+			return fmt.Errorf("payout input %s does not exist", in.PreviousOutPoint)
+		}
+		value := btcutil.Amount(prev.TxOut[in.PreviousOutPoint.Index].Value)
+		coins[i] = walletCoin{in.PreviousOutPoint, value, true}
+		fee += value
+	}
+	for _, out := range tx.TxOut {
+		fee -= btcutil.Amount(out.Value)
+	}
+	feeRate := FeeRate(int64(fee) * 1000 / mempool.GetTxVirtualSize(btcutil.NewTx(tx)))
+
+	s.tracker.track(&trackedTx{
+		hash:    *txHash,
+		label:   "payout",
+		kind:    txRedeem,
+		raw:     tx,
+		feeRate: feeRate,
+		rebuild: func(rate FeeRate) (*wire.MsgTx, error) {
+			return buildPayoutTx(coins, destAddr, amount, s.walletAddr, s.walletKey, rate)
+		},
+	})
+	return nil
+}
+
+// CurrentHeight returns the height of the API's best chain tip.
+func (s *EsploraService) CurrentHeight(ctx context.Context) (int64, error) {
+	body, err := s.get(ctx, "/blocks/tip/height")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get block count: %v", err)
+	}
+	height, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected tip height %q: %v", body, err)
+	}
+	return height, nil
+}
+
+// ListHtlcUtxos returns the unspent outputs paid to an HTLC address.
+func (s *EsploraService) ListHtlcUtxos(ctx context.Context, htlcAddress btcutil.Address) ([]DepositUtxo, error) {
+	return listAddressUtxos(ctx, s, htlcAddress)
+}
+
+// BroadcastTransaction submits an already-signed transaction to the network.
+// It is tracked until it confirms and rebroadcast if the API drops it, but
+// since someone else signed it, its fee is never bumped.
+func (s *EsploraService) BroadcastTransaction(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error) {
+	txHash, err := s.sendRawTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	s.tracker.track(&trackedTx{hash: *txHash, label: "external tx", kind: txExternal, raw: tx})
+	return txHash, nil
+}
+
+// GetConfirmations returns how many confirmations a transaction has, with 0
+// meaning it is in the mempool. An error means the API does not know it.
+func (s *EsploraService) GetConfirmations(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	var status esploraTxStatus
+	if err := s.getJSON(ctx, "/tx/"+txHash.String()+"/status", &status); err != nil {
+		return 0, fmt.Errorf("failed to look up tx %s: %v", txHash, err)
+	}
+	if !status.Confirmed {
+		return 0, nil
+	}
+	tip, err := s.CurrentHeight(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return tip - status.BlockHeight + 1, nil
+}
+
+// GetTxBlock returns the block that confirmed a transaction, or nil while it
+// is in the mempool.
+func (s *EsploraService) GetTxBlock(ctx context.Context, txHash *chainhash.Hash) (*chainhash.Hash, error) {
+	var status esploraTxStatus
+	err := s.getJSON(ctx, "/tx/"+txHash.String()+"/status", &status)
+	if errors.Is(err, errEsploraNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrTxNotFound, txHash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up tx %s: %v", txHash, err)
+	}
+	if !status.Confirmed {
+		return nil, nil
+	}
+	return chainhash.NewHashFromStr(status.BlockHash)
+}
+
+// IsInActiveChain reports whether a block is on the best chain.
+func (s *EsploraService) IsInActiveChain(ctx context.Context, blockHash *chainhash.Hash) (bool, error) {
+	var status struct {
+		InBestChain bool `json:"in_best_chain"`
+	}
+	if err := s.getJSON(ctx, "/block/"+blockHash.String()+"/status", &status); err != nil {
+		return false, fmt.Errorf("failed to look up block %s: %v", blockHash, err)
+	}
+	return status.InBestChain, nil
+}
+
+// BestBlockHash returns the hash of the API's best chain tip.
+func (s *EsploraService) BestBlockHash(ctx context.Context) (*chainhash.Hash, error) {
+	body, err := s.get(ctx, "/blocks/tip/hash")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block hash: %v", err)
+	}
+	return chainhash.NewHashFromStr(strings.TrimSpace(string(body)))
+}
+
+// esploraTxStatus is the confirmation status Esplora reports for a tx or UTXO.
+type esploraTxStatus struct {
+	Confirmed   bool   `json:"confirmed"`
+	BlockHeight int64  `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+}
+
+// esploraUtxo is an entry of /address/:address/utxo.
+type esploraUtxo struct {
+	TxID   string          `json:"txid"`
+	Vout   uint32          `json:"vout"`
+	Value  int64           `json:"value"`
+	Status esploraTxStatus `json:"status"`
+}
+
+func (s *EsploraService) addressUtxos(ctx context.Context, addr btcutil.Address) ([]esploraUtxo, error) {
+	var utxos []esploraUtxo
+	if err := s.getJSON(ctx, "/address/"+addr.EncodeAddress()+"/utxo", &utxos); err != nil {
+		return nil, fmt.Errorf("failed to list UTXOs of %s: %v", addr, err)
+	}
+	return utxos, nil
+}
+
+// listUnspent gives the DepositWatcher the UTXOs of each address, one
+// request per address since Esplora has no batch lookup.
+func (s *EsploraService) listUnspent(ctx context.Context, addrs []btcutil.Address) ([]btcjson.ListUnspentResult, error) {
+	tip, err := s.CurrentHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var unspent []btcjson.ListUnspentResult
+	for _, addr := range addrs {
+		utxos, err := s.addressUtxos(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		script := hex.EncodeToString(mustPayToAddrScript(addr))
+		for _, u := range utxos {
+			var confirmations int64
+			if u.Status.Confirmed {
+				confirmations = tip - u.Status.BlockHeight + 1
+			}
+			unspent = append(unspent, btcjson.ListUnspentResult{
+				TxID:          u.TxID,
+				Vout:          u.Vout,
+				Address:       addr.EncodeAddress(),
+				ScriptPubKey:  script,
+				Amount:        btcutil.Amount(u.Value).ToBTC(),
+				Confirmations: confirmations,
+			})
+		}
+	}
+	return unspent, nil
+}
+
+func (s *EsploraService) getTx(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	body, err := s.get(ctx, "/tx/"+txHash.String()+"/hex")
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid tx hex: %v", err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid tx: %v", err)
+	}
+	return tx, nil
+}
+
+// sendRawTx broadcasts tx without tracking it.
+func (s *EsploraService) sendRawTx(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	body, err := s.do(ctx, http.MethodPost, "/tx", strings.NewReader(hex.EncodeToString(buf.Bytes())))
+	if err != nil {
+		return nil, fmt.Errorf("failed to broadcast tx %s: %v", tx.TxHash(), err)
+	}
+	return chainhash.NewHashFromStr(strings.TrimSpace(string(body)))
+}
+
+// estimateFeeRate picks the /fee-estimates entry for the largest target
+// within FeeConfTarget blocks and clamps it to [MinFeeRate, MaxFeeRate].
+// Without one, as on a fresh regtest chain, the floor is used.
+func (s *EsploraService) estimateFeeRate(ctx context.Context) FeeRate {
+	floor := FeeRatePerVByte(s.cfg.MinFeeRate)
+	ceiling := FeeRatePerVByte(s.cfg.MaxFeeRate)
+
+	var estimates map[string]float64
+	if err := s.getJSON(ctx, "/fee-estimates", &estimates); err != nil {
+		log.Printf("[BTC_SERVICE] WARN: Fee estimates unavailable, using floor of %s: %v", floor, err)
+		return floor
+	}
+	rate, ok := pickFeeEstimate(estimates, s.cfg.FeeConfTarget)
+	if !ok {
+		log.Printf("[BTC_SERVICE] WARN: No fee estimate for %d blocks, using floor of %s", s.cfg.FeeConfTarget, floor)
+		return floor
+	}
+	return clampFeeRate(rate, floor, ceiling)
+}
+
+// pickFeeEstimate returns the sat/vB estimate for the largest target at most
+// confTarget, falling back to the fastest target if all are slower.
+func pickFeeEstimate(estimates map[string]float64, confTarget int64) (FeeRate, bool) {
+	targets := make([]int64, 0, len(estimates))
+	for key := range estimates {
+		target, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || target < 1 {
+			continue
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return 0, false
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+
+	best := targets[0]
+	for _, target := range targets {
+		if target <= confTarget {
+			best = target
+		}
+	}
+	return FeeRate(estimates[strconv.FormatInt(best, 10)] * 1000), true
+}
+
+// Esplora exposes no wallet, and the payouts it makes are re-signed instead,
+// so the wallet-based bumps are unavailable.
+var errNoEsploraWallet = errors.New("not available with the esplora backend")
+
+func (s *EsploraService) bumpWalletFee(ctx context.Context, txHash *chainhash.Hash, rate FeeRate) (*chainhash.Hash, error) {
+	return nil, errNoEsploraWallet
+}
+
+func (s *EsploraService) payForParent(ctx context.Context, parent *chainhash.Hash, rate FeeRate) (*chainhash.Hash, error) {
+	return nil, errNoEsploraWallet
+}
+
+func (s *EsploraService) getJSON(ctx context.Context, path string, out interface{}) error {
+	body, err := s.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("unexpected response from %s: %v", path, err)
+	}
+	return nil
+}
+
+func (s *EsploraService) get(ctx context.Context, path string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, path, nil)
+}
+
+func (s *EsploraService) do(ctx context.Context, method, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s %s", errEsploraNotFound, method, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// walletCoin is a UTXO of the resolver address.
+type walletCoin struct {
+	outpoint  wire.OutPoint
+	value     btcutil.Amount
+	confirmed bool
+}
+
+// p2wpkhWitnessSize is the worst-case witness of a P2WPKH input: the item
+// count, a signature and a compressed key, each with its length prefix.
+const p2wpkhWitnessSize = 1 + 1 + maxEcdsaSigLen + 1 + 33
+
+// payoutVSize estimates the virtual size of tx once its P2WPKH inputs are
+// signed.
+func payoutVSize(tx *wire.MsgTx) int64 {
+	weight := tx.SerializeSizeStripped()*4 + witnessHeaderLen + len(tx.TxIn)*p2wpkhWitnessSize
+	return int64((weight + 3) / 4)
+}
+
+// selectCoins picks confirmed coins to pay amount to dest at rate, larger
+// ones first. Unconfirmed coins are never spent: they are mostly the change
+// of an earlier payout, which the tracker may still replace, and replacing it
+// would evict any payout built on its change.
+func selectCoins(coins []walletCoin, amount btcutil.Amount, rate FeeRate, dest, change btcutil.Address) ([]walletCoin, error) {
+	var sorted []walletCoin
+	for _, coin := range coins {
+		if coin.confirmed {
+			sorted = append(sorted, coin)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].value > sorted[j].value })
+
+	var selected []walletCoin
+	var total btcutil.Amount
+	for _, coin := range sorted {
+		selected = append(selected, coin)
+		total += coin.value
+		tx := payoutTemplate(selected, dest, amount, change)
+		if total >= amount+rate.FeeForVSize(payoutVSize(tx)) {
+			return selected, nil
+		}
+	}
+	return nil, fmt.Errorf("resolver wallet holds %s in confirmed coins, not enough to pay %s plus fees", total, amount)
+}
+
+// payoutTemplate is an unsigned payout spending coins, with a change output
+// whose value is filled in later.
+func payoutTemplate(coins []walletCoin, dest btcutil.Address, amount btcutil.Amount, change btcutil.Address) *wire.MsgTx {
+	tx := wire.NewMsgTx(2)
+	for _, coin := range coins {
+		outpoint := coin.outpoint
+		// Signals RBF, so the tracker can replace a stuck payout.
+		tx.AddTxIn(&wire.TxIn{PreviousOutPoint: outpoint, Sequence: wire.MaxTxInSequenceNum - 2})
+	}
+	tx.AddTxOut(wire.NewTxOut(int64(amount), mustPayToAddrScript(dest)))
+	tx.AddTxOut(wire.NewTxOut(0, mustPayToAddrScript(change)))
+	return tx
+}
+
+// buildPayoutTx pays amount to dest from coins at rate, with the rest going
+// to change. Change too small to relay is left to the fee instead.
+func buildPayoutTx(coins []walletCoin, dest btcutil.Address, amount btcutil.Amount, change btcutil.Address, key *btcec.PrivateKey, rate FeeRate) (*wire.MsgTx, error) {
+	tx := payoutTemplate(coins, dest, amount, change)
+	var total btcutil.Amount
+	for _, coin := range coins {
+		total += coin.value
+	}
+
+	fee := rate.FeeForVSize(payoutVSize(tx))
+	tx.TxOut[1].Value = int64(total - amount - fee)
+	if total < amount+fee || mempool.IsDust(tx.TxOut[1], mempool.DefaultMinRelayTxFee) {
+		tx.TxOut = tx.TxOut[:1]
+		if fee = rate.FeeForVSize(payoutVSize(tx)); total < amount+fee {
+			return nil, fmt.Errorf("coins worth %s cannot pay %s plus a %s fee", total, amount, fee)
+		}
+	}
+	if mempool.IsDust(tx.TxOut[0], mempool.DefaultMinRelayTxFee) {
+		return nil, fmt.Errorf("%w: payout of %s", ErrDustOutput, amount)
+	}
+
+	pkScript := mustPayToAddrScript(change)
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for _, coin := range coins {
+		prevOuts.AddPrevOut(coin.outpoint, wire.NewTxOut(int64(coin.value), pkScript))
+	}
+	sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
+	for i, coin := range coins {
+		witness, err := txscript.WitnessSignature(tx, sigHashes, i, int64(coin.value), pkScript, txscript.SigHashAll, key, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign payout input %d: %v", i, err)
+		}
+		tx.TxIn[i].Witness = witness
+	}
+	return tx, nil
+}
@@ -0,0 +1,541 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+	"fusion-btc-resolver/config"
+)
+
+// esploraStub serves the parts of the Esplora API the service uses, from
+// in-memory state.
+type esploraStub struct {
+	mu        sync.Mutex
+	tip       int64
+	txs       map[string]*wire.MsgTx
+	heights   map[string]int64 // Confirmation height of each tx, 0 in the mempool
+	fees      map[string]float64
+	broadcast []*wire.MsgTx
+	stale     map[string]bool // Blocks reorged out of the best chain
+	lagging   bool            // Broadcasts are accepted but not indexed yet
+}
+
+// stubBlockHash names the stub's block at a height.
+func stubBlockHash(height int64) chainhash.Hash {
+	return chainhash.DoubleHashH([]byte(fmt.Sprint(height)))
+}
+
+func newEsploraStub(t *testing.T) (*esploraStub, *httptest.Server) {
+	stub := &esploraStub{
+		tip:     800_000,
+		txs:     make(map[string]*wire.MsgTx),
+		heights: make(map[string]int64),
+		stale:   make(map[string]bool),
+		fees:    map[string]float64{"1": 20, "3": 12, "6": 5.5, "144": 1},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(stub.serve))
+	t.Cleanup(srv.Close)
+	return stub, srv
+}
+
+// add records tx as mined at height, or in the mempool if height is 0.
+func (e *esploraStub) add(tx *wire.MsgTx, height int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.txs[tx.TxHash().String()] = tx
+	e.heights[tx.TxHash().String()] = height
+}
+
+func (e *esploraStub) status(txid string) esploraTxStatus {
+	height := e.heights[txid]
+	if height == 0 {
+		return esploraTxStatus{}
+	}
+	return esploraTxStatus{Confirmed: true, BlockHeight: height, BlockHash: stubBlockHash(height).String()}
+}
+
+func (e *esploraStub) serve(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.URL.Path == "/blocks/tip/height":
+		fmt.Fprint(w, e.tip)
+	case r.URL.Path == "/blocks/tip/hash":
+		fmt.Fprint(w, stubBlockHash(e.tip))
+	case len(parts) == 3 && parts[0] == "block" && parts[2] == "status":
+		json.NewEncoder(w).Encode(map[string]bool{"in_best_chain": !e.stale[parts[1]]})
+	case r.URL.Path == "/fee-estimates":
+		json.NewEncoder(w).Encode(e.fees)
+	case r.URL.Path == "/tx" && r.Method == http.MethodPost:
+		body, _ := io.ReadAll(r.Body)
+		raw, _ := hex.DecodeString(string(body))
+		tx := wire.NewMsgTx(2)
+		if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+			http.Error(w, "sendrawtransaction RPC error: TX decode failed", http.StatusBadRequest)
+			return
+		}
+		e.broadcast = append(e.broadcast, tx)
+		if !e.lagging {
+			e.txs[tx.TxHash().String()] = tx
+		}
+		fmt.Fprint(w, tx.TxHash())
+	case len(parts) == 3 && parts[0] == "tx":
+		tx, ok := e.txs[parts[1]]
+		if !ok {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		switch parts[2] {
+		case "hex":
+			var buf bytes.Buffer
+			tx.Serialize(&buf)
+			fmt.Fprint(w, hex.EncodeToString(buf.Bytes()))
+		case "status":
+			json.NewEncoder(w).Encode(e.status(parts[1]))
+		default:
+			http.NotFound(w, r)
+		}
+	case len(parts) == 3 && parts[0] == "address" && parts[2] == "utxo":
+		addr, err := btcutil.DecodeAddress(parts[1], &chaincfg.RegressionNetParams)
+		if err != nil {
+			http.Error(w, "Invalid Bitcoin address", http.StatusBadRequest)
+			return
+		}
+		pkScript := mustPayToAddrScript(addr)
+		utxos := []esploraUtxo{}
+		for txid, tx := range e.txs {
+			for vout, out := range tx.TxOut {
+				if bytes.Equal(out.PkScript, pkScript) && !e.spent(txid, uint32(vout)) {
+					utxos = append(utxos, esploraUtxo{TxID: txid, Vout: uint32(vout), Value: out.Value, Status: e.status(txid)})
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(utxos)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (e *esploraStub) spent(txid string, vout uint32) bool {
+	for _, tx := range e.txs {
+		for _, in := range tx.TxIn {
+			if in.PreviousOutPoint.Hash.String() == txid && in.PreviousOutPoint.Index == vout {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newTestEsploraService(t *testing.T, url string) (*EsploraService, *btcec.PrivateKey) {
+	t.Helper()
+	key, _ := btcec.NewPrivateKey()
+	wif, _ := btcutil.NewWIF(key, &chaincfg.RegressionNetParams, true)
+	addr, _ := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(key.PubKey().SerializeCompressed()), &chaincfg.RegressionNetParams)
+
+	s, err := NewEsploraService(&config.BtcConfig{
+		Backend:              "esplora",
+		Network:              "regtest",
+		ResolverAddress:      addr.EncodeAddress(),
+		DepositPollInterval:  time.Second,
+		DepositConfirmations: 2,
+		FeeConfTarget:        6,
+		MinFeeRate:           1,
+		MaxFeeRate:           500,
+		BumpAfterBlocks:      1,
+		TxTrackInterval:      time.Second,
+		TaprootInternalKey:   TaprootInternalKeyNUMS,
+		EsploraURL:           url + "/",
+		WalletKey:            wif.String(),
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewEsploraService failed: %v", err)
+	}
+	return s, key
+}
+
+// TestEsploraDeposit checks deposit detection and confirmation counting
+// against the API.
+func TestEsploraDeposit(t *testing.T) {
+	stub, srv := newEsploraStub(t)
+	s, _ := newTestEsploraService(t, srv.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	f := newHtlcFixture(t, localcommon.HtlcP2WSH)
+	htlcAddr, _ := HtlcAddress(f.script, localcommon.HtlcP2WSH, s.NetParams())
+	stub.add(f.fundingTx, 799_999)
+
+	deposit, err := s.MonitorForDeposit(ctx, htlcAddr, 100_000, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("MonitorForDeposit failed: %v", err)
+	}
+	outpoint := deposit.Utxos[0].OutPoint
+	if deposit.Total != 100_000 || outpoint.Hash != f.fundingTx.TxHash() || outpoint.Index != 0 {
+		t.Errorf("unexpected deposit %+v", deposit)
+	}
+
+	confirmations, err := s.GetConfirmations(ctx, &outpoint.Hash)
+	if err != nil || confirmations != 2 {
+		t.Errorf("expected 2 confirmations, got %d, %v", confirmations, err)
+	}
+	unknown := wire.NewMsgTx(2).TxHash()
+	if _, err := s.GetConfirmations(ctx, &unknown); err == nil {
+		t.Error("expected an unknown tx to be an error")
+	}
+
+	// A later payment is listed too, before it confirms.
+	late := wire.NewMsgTx(2)
+	late.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 7}, nil, nil))
+	late.AddTxOut(wire.NewTxOut(20_000, mustPayToAddrScript(htlcAddr)))
+	stub.add(late, 0)
+	utxos, err := s.ListHtlcUtxos(ctx, htlcAddr)
+	if err != nil {
+		t.Fatalf("ListHtlcUtxos failed: %v", err)
+	}
+	var total btcutil.Amount
+	for _, u := range utxos {
+		total += u.Amount
+	}
+	if len(utxos) != 2 || total != 120_000 {
+		t.Errorf("expected the deposit and the late payment, got %+v", utxos)
+	}
+}
+
+// TestEsploraReorgChecks checks that a tx reorged out of its block, or
+// dropped altogether, is reported as such.
+func TestEsploraReorgChecks(t *testing.T) {
+	stub, srv := newEsploraStub(t)
+	s, _ := newTestEsploraService(t, srv.URL)
+	ctx := context.Background()
+
+	f := newHtlcFixture(t, localcommon.HtlcP2WSH)
+	txHash := f.fundingTx.TxHash()
+	stub.add(f.fundingTx, 799_999)
+
+	tip, err := s.BestBlockHash(ctx)
+	if err != nil || *tip != stubBlockHash(800_000) {
+		t.Errorf("expected tip %s, got %v, %v", stubBlockHash(800_000), tip, err)
+	}
+	block, err := s.GetTxBlock(ctx, &txHash)
+	if err != nil || block == nil || *block != stubBlockHash(799_999) {
+		t.Fatalf("expected the tx in block %s, got %v, %v", stubBlockHash(799_999), block, err)
+	}
+	if active, err := s.IsInActiveChain(ctx, block); err != nil || !active {
+		t.Errorf("expected the block to be active, got %v, %v", active, err)
+	}
+
+	stub.mu.Lock()
+	stub.stale[block.String()] = true
+	stub.heights[txHash.String()] = 0
+	stub.mu.Unlock()
+	if active, err := s.IsInActiveChain(ctx, block); err != nil || active {
+		t.Errorf("expected the block to be stale, got %v, %v", active, err)
+	}
+	if block, err := s.GetTxBlock(ctx, &txHash); err != nil || block != nil {
+		t.Errorf("expected the tx back in the mempool, got %v, %v", block, err)
+	}
+
+	unknown := wire.NewMsgTx(2).TxHash()
+	if _, err := s.GetTxBlock(ctx, &unknown); !errors.Is(err, ErrTxNotFound) {
+		t.Errorf("expected ErrTxNotFound, got %v", err)
+	}
+}
+
+// TestEsploraRedeemHtlc checks that a claim is priced from /fee-estimates,
+// signed and broadcast.
+func TestEsploraRedeemHtlc(t *testing.T) {
+	stub, srv := newEsploraStub(t)
+	s, _ := newTestEsploraService(t, srv.URL)
+	ctx := context.Background()
+
+	f := newHtlcFixture(t, localcommon.HtlcP2WSH)
+	stub.add(f.fundingTx, 799_990)
+	fundingHash := f.fundingTx.TxHash()
+
+	txHash, err := s.RedeemHtlc(ctx, []*chainhash.Hash{&fundingHash}, f.script, localcommon.HtlcP2WSH, s.walletAddr, f.resolverKey, f.preimage, 0)
+	if err != nil {
+		t.Fatalf("RedeemHtlc failed: %v", err)
+	}
+	if len(stub.broadcast) != 1 || stub.broadcast[0].TxHash() != *txHash {
+		t.Fatalf("expected the claim to be broadcast")
+	}
+	claim := stub.broadcast[0]
+	if err := f.verify(t, claim); err != nil {
+		t.Errorf("broadcast claim does not verify: %v", err)
+	}
+
+	vsize, _ := redeemVSize(f.script, localcommon.HtlcP2WSH, len(f.preimage), mustPayToAddrScript(s.walletAddr), 1)
+	fee := btcutil.Amount(f.fundingTx.TxOut[0].Value - claim.TxOut[0].Value)
+	if want := FeeRate(5500).FeeForVSize(vsize); fee != want {
+		t.Errorf("expected the 6 block estimate of 5.5 sat/vB, paid %s instead of %s", fee, want)
+	}
+}
+
+// TestEsploraSendBitcoinToUser checks that payouts are funded from the
+// resolver address's UTXOs, signed locally and broadcast with change.
+func TestEsploraSendBitcoinToUser(t *testing.T) {
+	stub, srv := newEsploraStub(t)
+	s, _ := newTestEsploraService(t, srv.URL)
+	ctx := context.Background()
+
+	walletScript := mustPayToAddrScript(s.walletAddr)
+	funding := wire.NewMsgTx(2)
+	funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 3}, nil, nil))
+	funding.AddTxOut(wire.NewTxOut(30_000, walletScript))
+	funding.AddTxOut(wire.NewTxOut(40_000, walletScript))
+	funding.AddTxOut(wire.NewTxOut(5_000, walletScript))
+	stub.add(funding, 799_000)
+
+	dest := "bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu"
+	txid, err := s.SendBitcoinToUser(ctx, dest, 60_000)
+	if err != nil {
+		t.Fatalf("SendBitcoinToUser failed: %v", err)
+	}
+	if len(stub.broadcast) != 1 || stub.broadcast[0].TxHash().String() != txid {
+		t.Fatalf("expected the payout to be broadcast")
+	}
+	payout := stub.broadcast[0]
+
+	if len(payout.TxIn) != 2 || len(payout.TxOut) != 2 || payout.TxOut[0].Value != 60_000 {
+		t.Fatalf("expected two coins paying 60000 sat plus change, got %d inputs and outputs %v", len(payout.TxIn), payout.TxOut)
+	}
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for _, in := range payout.TxIn {
+		prevOuts.AddPrevOut(in.PreviousOutPoint, funding.TxOut[in.PreviousOutPoint.Index])
+	}
+	var in btcutil.Amount
+	for i, txIn := range payout.TxIn {
+		prevOut := funding.TxOut[txIn.PreviousOutPoint.Index]
+		in += btcutil.Amount(prevOut.Value)
+		vm, err := txscript.NewEngine(prevOut.PkScript, payout, i, txscript.StandardVerifyFlags, nil, txscript.NewTxSigHashes(payout, prevOuts), prevOut.Value, prevOuts)
+		if err != nil {
+			t.Fatalf("failed to create script engine: %v", err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Errorf("input %d does not verify: %v", i, err)
+		}
+	}
+
+	fee := in - btcutil.Amount(payout.TxOut[0].Value+payout.TxOut[1].Value)
+	if want := FeeRate(5500).FeeForVSize(payoutVSize(payout)); fee < want {
+		t.Errorf("paid %s, less than %s", fee, want)
+	}
+
+	if _, err := s.SendBitcoinToUser(ctx, dest, 100_000); err == nil {
+		t.Error("expected a payout beyond the wallet's balance to fail")
+	}
+}
+
+// TestEsploraPayoutsReserveCoins checks that payouts never spend the same
+// coin, whether they run at once or the API has not indexed the first yet.
+func TestEsploraPayoutsReserveCoins(t *testing.T) {
+	stub, srv := newEsploraStub(t)
+	s, _ := newTestEsploraService(t, srv.URL)
+	ctx := context.Background()
+
+	walletScript := mustPayToAddrScript(s.walletAddr)
+	funding := wire.NewMsgTx(2)
+	funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 3}, nil, nil))
+	for i := 0; i < 4; i++ {
+		funding.AddTxOut(wire.NewTxOut(50_000, walletScript))
+	}
+	stub.add(funding, 799_000)
+	stub.lagging = true
+
+	dest := "bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu"
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.SendBitcoinToUser(ctx, dest, 30_000); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("SendBitcoinToUser failed: %v", err)
+	}
+
+	spent := make(map[wire.OutPoint]bool)
+	for _, tx := range stub.broadcast {
+		for _, in := range tx.TxIn {
+			if spent[in.PreviousOutPoint] {
+				t.Fatalf("coin %v spent by two payouts", in.PreviousOutPoint)
+			}
+			spent[in.PreviousOutPoint] = true
+		}
+	}
+	if _, err := s.SendBitcoinToUser(ctx, dest, 60_000); err == nil {
+		t.Fatal("expected a payout needing reserved coins to fail")
+	}
+
+	// Once the API indexes the payouts, their coins are released and the
+	// last confirmed coin can be spent.
+	stub.mu.Lock()
+	for _, tx := range stub.broadcast {
+		stub.txs[tx.TxHash().String()] = tx
+	}
+	stub.lagging = false
+	stub.mu.Unlock()
+	if _, err := s.SendBitcoinToUser(ctx, dest, 30_000); err != nil {
+		t.Fatalf("SendBitcoinToUser after indexing failed: %v", err)
+	}
+	if len(s.reserved) != 1 {
+		t.Errorf("expected only the last payout's coin reserved, got %d", len(s.reserved))
+	}
+}
+
+// TestEsploraPayoutsSkipUnconfirmedChange checks that a payout never spends
+// the change of one the tracker may still replace, which would evict it.
+func TestEsploraPayoutsSkipUnconfirmedChange(t *testing.T) {
+	stub, srv := newEsploraStub(t)
+	s, _ := newTestEsploraService(t, srv.URL)
+	ctx := context.Background()
+
+	funding := wire.NewMsgTx(2)
+	funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 3}, nil, nil))
+	funding.AddTxOut(wire.NewTxOut(100_000, mustPayToAddrScript(s.walletAddr)))
+	stub.add(funding, 799_000)
+
+	dest := "bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu"
+	first, err := s.SendBitcoinToUser(ctx, dest, 30_000)
+	if err != nil {
+		t.Fatalf("SendBitcoinToUser failed: %v", err)
+	}
+	if _, err := s.SendBitcoinToUser(ctx, dest, 30_000); err == nil {
+		t.Fatal("expected the second payout to wait for confirmed coins")
+	}
+
+	// The first payout gets stuck and is replaced at a higher fee, which
+	// would have evicted a second payout spending its change.
+	s.tracker.checkAll(ctx)
+	stub.mu.Lock()
+	stub.tip++
+	stub.mu.Unlock()
+	s.tracker.checkAll(ctx)
+	if len(stub.broadcast) != 2 {
+		t.Fatalf("expected the first payout to be replaced, got %d broadcasts", len(stub.broadcast))
+	}
+	replacement := stub.broadcast[1]
+
+	stub.mu.Lock()
+	delete(stub.txs, first)
+	stub.heights[replacement.TxHash().String()] = stub.tip
+	stub.mu.Unlock()
+	if _, err := s.SendBitcoinToUser(ctx, dest, 30_000); err != nil {
+		t.Fatalf("SendBitcoinToUser after the replacement confirmed failed: %v", err)
+	}
+	second := stub.broadcast[2]
+	if len(second.TxIn) != 1 || second.TxIn[0].PreviousOutPoint.Hash != replacement.TxHash() {
+		t.Errorf("expected the second payout to spend the confirmed replacement's change, got %v", second.TxIn)
+	}
+}
+
+// TestEsploraTrackPayoutAfterRestart checks that a payout broadcast before a
+// restart is fetched back from the API and replaced at a higher fee once stuck.
+func TestEsploraTrackPayoutAfterRestart(t *testing.T) {
+	stub, srv := newEsploraStub(t)
+	s, _ := newTestEsploraService(t, srv.URL)
+	ctx := context.Background()
+
+	funding := wire.NewMsgTx(2)
+	funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 3}, nil, nil))
+	funding.AddTxOut(wire.NewTxOut(100_000, mustPayToAddrScript(s.walletAddr)))
+	stub.add(funding, 799_000)
+
+	dest := "bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu"
+	txid, err := s.SendBitcoinToUser(ctx, dest, 30_000)
+	if err != nil {
+		t.Fatalf("SendBitcoinToUser failed: %v", err)
+	}
+	payout := stub.broadcast[0]
+
+	restarted, err := NewEsploraService(s.cfg, s.walletKey)
+	if err != nil {
+		t.Fatalf("NewEsploraService failed: %v", err)
+	}
+	txHash, _ := chainhash.NewHashFromStr(txid)
+	if err := restarted.TrackPayout(ctx, txHash, dest, 30_000); err != nil {
+		t.Fatalf("TrackPayout failed: %v", err)
+	}
+	restarted.tracker.checkAll(ctx)
+	stub.mu.Lock()
+	stub.tip++
+	stub.mu.Unlock()
+	restarted.tracker.checkAll(ctx)
+
+	if len(stub.broadcast) != 2 {
+		t.Fatalf("expected the payout to be replaced, got %d broadcasts", len(stub.broadcast))
+	}
+	replacement := stub.broadcast[1]
+	if len(replacement.TxIn) != 1 || replacement.TxIn[0].PreviousOutPoint != payout.TxIn[0].PreviousOutPoint {
+		t.Fatalf("expected the replacement to spend the payout's coin, got %v", replacement.TxIn)
+	}
+	if replacement.TxOut[0].Value != 30_000 || replacement.TxOut[1].Value >= payout.TxOut[1].Value {
+		t.Errorf("expected 30000 sat paid with less change than %d, got %v", payout.TxOut[1].Value, replacement.TxOut)
+	}
+}
+
+// TestPickFeeEstimate checks which Esplora target is used for a
+// confirmation target.
+func TestPickFeeEstimate(t *testing.T) {
+	estimates := map[string]float64{"2": 20, "6": 5.5, "144": 1}
+	cases := map[int64]FeeRate{1: 20_000, 2: 20_000, 5: 20_000, 6: 5_500, 100: 5_500, 1008: 1_000}
+	for target, want := range cases {
+		if got, ok := pickFeeEstimate(estimates, target); !ok || got != want {
+			t.Errorf("pickFeeEstimate(%d) = %s, %v; want %s", target, got, ok, want)
+		}
+	}
+	if _, ok := pickFeeEstimate(map[string]float64{}, 6); ok {
+		t.Error("expected no estimate from an empty response")
+	}
+}
+
+// TestNewEsploraServiceChecksWalletKey checks that a wallet key that does not
+// own the resolver address is refused.
+func TestNewEsploraServiceChecksWalletKey(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	wif, _ := btcutil.NewWIF(key, &chaincfg.RegressionNetParams, true)
+	_, err := NewEsploraService(&config.BtcConfig{
+		Network:             "regtest",
+		ResolverAddress:     "bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu",
+		DepositPollInterval: time.Second,
+		FeeConfTarget:       6,
+		MinFeeRate:          1,
+		MaxFeeRate:          500,
+		BumpAfterBlocks:     1,
+		TxTrackInterval:     time.Second,
+		TaprootInternalKey:  TaprootInternalKeyNUMS,
+		EsploraURL:          "http://localhost:3002",
+		WalletKey:           wif.String(),
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "BTC_WALLET_KEY") {
+		t.Errorf("expected a BTC_WALLET_KEY mismatch, got %v", err)
+	}
+}
@@ -37,11 +37,15 @@ package services
 import (
 	"context"
 	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -62,22 +66,26 @@ type EvmService struct {
 	contractAddress    common.Address
 }
 
-// NewEvmService creates a new instance of the EVM service.
-func NewEvmService(cfg *config.EvmConfig) (*EvmService, error) {
+// NewEvmService creates a new instance of the EVM service, signing with
+// privateKey, or with EVM_PRIVATE_KEY when it is nil.
+func NewEvmService(cfg *config.EvmConfig, privateKey *ecdsa.PrivateKey) (*EvmService, error) {
+	if cfg.ClaimPollInterval <= 0 {
+		return nil, fmt.Errorf("EVM_CLAIM_POLL_INTERVAL must be positive, got %s", cfg.ClaimPollInterval)
+	}
+	if cfg.LogBlockRange == 0 {
+		return nil, fmt.Errorf("EVM_LOG_BLOCK_RANGE must be positive")
+	}
+
 	client, err := ethclient.Dial(cfg.RPCURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to EVM RPC client: %v", err)
 	}
 
-	// Remove "0x" prefix if present
-	privateKeyHex := cfg.PrivateKey
-	if len(privateKeyHex) > 2 && privateKeyHex[:2] == "0x" {
-		privateKeyHex = privateKeyHex[2:]
-	}
-
-	privateKey, err := crypto.HexToECDSA(privateKeyHex)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load EVM private key: %v", err)
+	if privateKey == nil {
+		privateKey, err = ParseEvmKey(cfg.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	publicKey := privateKey.Public()
@@ -107,9 +115,18 @@ func NewEvmService(cfg *config.EvmConfig) (*EvmService, error) {
 	}, nil
 }
 
+// ParseEvmKey decodes a hex EVM private key, with or without a 0x prefix.
+func ParseEvmKey(privateKeyHex string) (*ecdsa.PrivateKey, error) {
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load EVM private key: %v", err)
+	}
+	return privateKey, nil
+}
+
 // DepositIntoEscrow deposits funds into the 1inch Fusion+ style settlement contract.
 // This creates an escrow that will be released when the user reveals the secret.
-func (s *EvmService) DepositIntoEscrow(userAddress common.Address, amount *big.Int, secretHash [32]byte, lockTime *big.Int) (*types.Transaction, error) {
+func (s *EvmService) DepositIntoEscrow(ctx context.Context, userAddress common.Address, amount *big.Int, secretHash [32]byte, lockTime *big.Int) (*types.Transaction, error) {
 	log.Printf("[EVM_SERVICE] Creating escrow for %d wei, user %s, secretHash %x", amount, userAddress.Hex(), secretHash)
 
 	// Demo mode: Skip real blockchain transaction
@@ -117,7 +134,7 @@ func (s *EvmService) DepositIntoEscrow(userAddress common.Address, amount *big.I
 		log.Printf("[EVM_SERVICE] DEMO MODE: Simulating escrow creation (skipping real transaction)")
 
 		// Create a dummy transaction for demo
-		dummyTx := &types.Transaction{}
+		dummyTx := types.NewTx(&types.LegacyTx{})
 		dummyHash := "0xdemo1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
 
 		log.Printf("[EVM_SERVICE] DEMO: Escrow transaction simulated: %s", dummyHash)
@@ -125,7 +142,7 @@ func (s *EvmService) DepositIntoEscrow(userAddress common.Address, amount *big.I
 	}
 
 	// Real mode: Create actual blockchain transaction
-	auth, err := s.createAuth()
+	auth, err := s.createAuth(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create auth: %v", err)
 	}
@@ -141,56 +158,215 @@ func (s *EvmService) DepositIntoEscrow(userAddress common.Address, amount *big.I
 	return tx, nil
 }
 
-// MonitorForClaimEvent watches the settlement contract for SecretRevealed events.
-// This implements real event monitoring using go-ethereum's log filtering.
-func (s *EvmService) MonitorForClaimEvent(secretHash [32]byte) ([]byte, error) {
-	log.Printf("[EVM_SERVICE] Monitoring for SecretRevealed event for secretHash %x", secretHash)
-
-	// Note: In production, this would set up proper event filtering
-	// For demo purposes, we'll implement simplified polling
+// ErrSecretMismatch is returned when a SecretRevealed event carries a secret
+// that does not hash to the swap's secret hash. The settlement contract should
+// make this impossible, so it is never treated as a claim.
+var ErrSecretMismatch = errors.New("revealed secret does not match the secret hash")
+
+// ErrClaimWindowClosed is returned by MonitorForClaimEvent once the chain has
+// passed the escrow deadline and every block up to it was scanned without a claim.
+var ErrClaimWindowClosed = errors.New("escrow was not claimed before its timelock")
+
+// MonitorForClaimEvent watches the settlement contract for the SecretRevealed
+// event of secretHash and returns the revealed secret.
+//
+// Blocks are scanned with eth_getLogs from cursor.Next() up to the chain head,
+// in ranges of at most LogBlockRange, and the cursor is advanced after each
+// range. Between scans the monitor waits for ClaimPollInterval, or less when
+// the RPC endpoint supports log subscriptions: a subscribed event only wakes
+// the monitor early, the scan remains the source of truth. RPC errors are
+// logged and retried on the next scan.
+//
+// Once the head block's timestamp reaches the deadline and the scan has caught
+// up with it, ErrClaimWindowClosed is returned. Cancelling ctx returns ctx.Err().
+func (s *EvmService) MonitorForClaimEvent(ctx context.Context, secretHash [32]byte, deadline time.Time, cursor BlockCursor) ([]byte, error) {
+	log.Printf("[EVM_SERVICE] Monitoring for SecretRevealed event for secretHash %x from block %d", secretHash, cursor.Next())
+
+	wake := make(chan *settlement.FusionBtcSettlementSecretRevealed, 1)
+	sub, err := s.settlementContract.WatchSecretRevealed(&bind.WatchOpts{Context: ctx}, wake, [][32]byte{secretHash}, nil, nil)
+	if err != nil {
+		log.Printf("[EVM_SERVICE] Log subscriptions unavailable, polling every %s: %v", s.cfg.ClaimPollInterval, err)
+	} else {
+		defer sub.Unsubscribe()
+	}
 
-	// Poll for events with timeout
-	timeout := time.After(5 * time.Minute)    // 5 minute timeout
-	ticker := time.NewTicker(5 * time.Second) // Check every 5 seconds
+	ticker := time.NewTicker(s.cfg.ClaimPollInterval)
 	defer ticker.Stop()
 
 	for {
-		select {
-		case <-timeout:
-			return nil, fmt.Errorf("timeout waiting for secret revelation")
+		secret, closed, err := s.scanForSecret(ctx, secretHash, deadline, cursor)
+		if errors.Is(err, ErrSecretMismatch) || ctx.Err() != nil {
+			return nil, err
+		}
+		if err != nil {
+			log.Printf("[EVM_SERVICE] ERROR: scanning for SecretRevealed events, will retry: %v", err)
+		}
+		if secret != nil {
+			return secret, nil
+		}
+		if closed {
+			return nil, ErrClaimWindowClosed
+		}
 
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wake:
 		case <-ticker.C:
-			// For demo purposes, implement a simplified event polling
-			// In production, this would use proper event subscription
-			log.Printf("[EVM_SERVICE] Polling for SecretRevealed events...")
+		}
+	}
+}
+
+// scanForSecret scans every block from the cursor to the current head once.
+// It reports whether the head has reached the deadline, in which case no
+// later claim is possible.
+func (s *EvmService) scanForSecret(ctx context.Context, secretHash [32]byte, deadline time.Time, cursor BlockCursor) ([]byte, bool, error) {
+	head, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get latest EVM block: %v", err)
+	}
+	headNumber := head.Number.Uint64()
 
-			// Simulate finding the secret after a delay (demo implementation)
-			// In reality, this would filter blockchain logs
-			time.Sleep(2 * time.Second)
+	for from := cursor.Next(); from <= headNumber; from = cursor.Next() {
+		to := from + s.cfg.LogBlockRange - 1
+		if to > headNumber {
+			to = headNumber
+		}
 
-			// In demo mode, return the original secret hash to simulate successful revelation
-			// In production, this would come from parsing real blockchain events
-			log.Printf("[EVM_SERVICE] Demo: Simulating secret revelation")
+		secret, err := s.findSecretRevealed(ctx, secretHash, from, to)
+		if err != nil || secret != nil {
+			return secret, false, err
+		}
+		if err := cursor.Advance(to + 1); err != nil {
+			return nil, false, fmt.Errorf("failed to persist EVM block cursor: %v", err)
+		}
+	}
 
-			// For demo: Generate a secret that would hash to the expected secretHash
-			// In reality, this would be extracted from blockchain events
-			demoSecret := make([]byte, 32)
-			copy(demoSecret, secretHash[:]) // Use the hash as the secret for demo
+	return nil, !time.Unix(int64(head.Time), 0).Before(deadline), nil
+}
 
-			return demoSecret, nil
+// findSecretRevealed looks for the SecretRevealed event in blocks [from, to]
+// and checks that the revealed secret hashes to secretHash.
+func (s *EvmService) findSecretRevealed(ctx context.Context, secretHash [32]byte, from, to uint64) ([]byte, error) {
+	it, err := s.settlementContract.FilterSecretRevealed(&bind.FilterOpts{Start: from, End: &to, Context: ctx}, [][32]byte{secretHash}, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter SecretRevealed events in blocks %d-%d: %v", from, to, err)
+	}
+	defer it.Close()
+
+	for it.Next() {
+		event := it.Event
+		if event.Raw.Removed {
+			continue
+		}
+		if sha256.Sum256(event.Secret[:]) != secretHash {
+			return nil, fmt.Errorf("%w: tx %s revealed %x for %x", ErrSecretMismatch, event.Raw.TxHash.Hex(), event.Secret, secretHash)
 		}
+		log.Printf("[EVM_SERVICE] SecretRevealed for %x in block %d, tx %s", secretHash, event.Raw.BlockNumber, event.Raw.TxHash.Hex())
+		return event.Secret[:], nil
+	}
+	if err := it.Error(); err != nil {
+		return nil, fmt.Errorf("failed to read SecretRevealed events in blocks %d-%d: %v", from, to, err)
+	}
+	return nil, nil
+}
+
+// GetEscrow reads the on-chain state of the escrow for a secret hash. An
+// escrow that was never created comes back with a zero Amount.
+func (s *EvmService) GetEscrow(ctx context.Context, secretHash [32]byte) (*settlement.FusionBtcSettlementEscrow, error) {
+	// Demo mode never creates real escrows, so there is nothing to read.
+	if s.cfg.DemoMode {
+		return &settlement.FusionBtcSettlementEscrow{Amount: big.NewInt(0), Timelock: big.NewInt(0)}, nil
+	}
+
+	escrow, err := s.settlementContract.GetEscrow(&bind.CallOpts{Context: ctx}, secretHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read escrow %x: %v", secretHash, err)
+	}
+
+	return &settlement.FusionBtcSettlementEscrow{
+		User:     escrow.User,
+		Resolver: escrow.Resolver,
+		Token:    escrow.Token,
+		Amount:   escrow.Amount,
+		Timelock: escrow.Timelock,
+		Claimed:  escrow.Claimed,
+		Refunded: escrow.Refunded,
+	}, nil
+}
+
+// RefundEscrow returns the resolver's funds from an escrow whose timelock has
+// passed without the user claiming it. The contract reverts if the escrow was
+// already claimed or refunded, so callers should check GetEscrow first.
+func (s *EvmService) RefundEscrow(ctx context.Context, secretHash [32]byte) (*types.Transaction, error) {
+	log.Printf("[EVM_SERVICE] Refunding escrow for secretHash %x", secretHash)
+
+	if s.cfg.DemoMode {
+		log.Printf("[EVM_SERVICE] DEMO MODE: Simulating escrow refund (skipping real transaction)")
+		return types.NewTx(&types.LegacyTx{}), nil
+	}
+
+	auth, err := s.createAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auth: %v", err)
+	}
+
+	tx, err := s.settlementContract.RefundEscrow(auth, secretHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund escrow: %v", err)
+	}
+
+	log.Printf("[EVM_SERVICE] Successfully submitted escrow refund transaction: %s", tx.Hash().Hex())
+	return tx, nil
+}
+
+// GetTxReceipt returns the receipt of a mined transaction, nil while it is
+// pending, or ErrTxNotFound once the node has dropped or never seen it.
+func (s *EvmService) GetTxReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	receipt, err := s.client.TransactionReceipt(ctx, txHash)
+	if err == nil {
+		return receipt, nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return nil, fmt.Errorf("failed to get receipt of %s: %v", txHash.Hex(), err)
+	}
+	if _, _, err := s.client.TransactionByHash(ctx, txHash); errors.Is(err, ethereum.NotFound) {
+		return nil, ErrTxNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %v", txHash.Hex(), err)
+	}
+	return nil, nil
+}
+
+// LatestBlockTime returns the timestamp of the latest EVM block, which is the
+// clock the settlement contract compares escrow timelocks against.
+func (s *EvmService) LatestBlockTime(ctx context.Context) (time.Time, error) {
+	header, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get latest EVM block: %v", err)
+	}
+	return time.Unix(int64(header.Time), 0), nil
+}
+
+// LatestBlockNumber returns the number of the latest EVM block.
+func (s *EvmService) LatestBlockNumber(ctx context.Context) (uint64, error) {
+	number, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest EVM block number: %v", err)
 	}
+	return number, nil
 }
 
 // createAuth creates a new transactor with the loaded private key.
 // This is a helper for interacting with generated contract bindings.
-func (s *EvmService) createAuth() (*bind.TransactOpts, error) {
-	nonce, err := s.client.PendingNonceAt(context.Background(), s.walletAddr)
+// The transactor carries ctx, so the send itself is cancellable too.
+func (s *EvmService) createAuth(ctx context.Context) (*bind.TransactOpts, error) {
+	nonce, err := s.client.PendingNonceAt(ctx, s.walletAddr)
 	if err != nil {
 		return nil, err
 	}
 
-	gasPrice, err := s.client.SuggestGasPrice(context.Background())
+	gasPrice, err := s.client.SuggestGasPrice(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -205,6 +381,7 @@ func (s *EvmService) createAuth() (*bind.TransactOpts, error) {
 	auth.Value = big.NewInt(0)     // in wei
 	auth.GasLimit = uint64(300000) // in units
 	auth.GasPrice = gasPrice
+	auth.Context = ctx
 
 	return auth, nil
 }
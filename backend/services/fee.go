@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+)
+
+// FeeRate is a transaction fee rate in satoshis per 1000 virtual bytes, the
+// unit bitcoind reports. Keeping the extra three digits avoids rounding a
+// sub-sat/vB estimate away before it is multiplied by the tx size.
+type FeeRate btcutil.Amount
+
+// FeeRatePerVByte converts a rate in sat/vB, the unit users configure.
+func FeeRatePerVByte(satPerVByte int64) FeeRate {
+	return FeeRate(satPerVByte * 1000)
+}
+
+// FeeForVSize returns the fee for a transaction of vsize virtual bytes,
+// rounded up so the rate is never undershot.
+func (r FeeRate) FeeForVSize(vsize int64) btcutil.Amount {
+	return btcutil.Amount((int64(r)*vsize + 999) / 1000)
+}
+
+func (r FeeRate) String() string {
+	return fmt.Sprintf("%.3f sat/vB", float64(r)/1000)
+}
+
+// ErrDustOutput is returned when the fee for a redeem would leave an output
+// too small to relay.
+var ErrDustOutput = errors.New("redeem output would be dust after fees")
+
+// estimateFeeRate asks bitcoind for a fee rate that confirms within
+// FeeConfTarget blocks and clamps it to [MinFeeRate, MaxFeeRate]. When the
+// node has no estimate, as on a fresh regtest chain, the floor is used.
+func (s *BtcHtlcService) estimateFeeRate(ctx context.Context) FeeRate {
+	floor := FeeRatePerVByte(s.cfg.MinFeeRate)
+	ceiling := FeeRatePerVByte(s.cfg.MaxFeeRate)
+
+	res, err := withContext(ctx, func() (*btcjson.EstimateSmartFeeResult, error) {
+		return s.client.EstimateSmartFee(s.cfg.FeeConfTarget, &btcjson.EstimateModeConservative)
+	})
+	if err != nil {
+		log.Printf("[BTC_SERVICE] WARN: estimatesmartfee failed, using floor of %s: %v", floor, err)
+		return floor
+	}
+	if res.FeeRate == nil {
+		log.Printf("[BTC_SERVICE] WARN: No fee estimate for %d blocks (%v), using floor of %s", s.cfg.FeeConfTarget, res.Errors, floor)
+		return floor
+	}
+
+	perKvB, err := btcutil.NewAmount(*res.FeeRate)
+	if err != nil {
+		log.Printf("[BTC_SERVICE] WARN: Invalid fee estimate %v, using floor of %s", *res.FeeRate, floor)
+		return floor
+	}
+	return clampFeeRate(FeeRate(perKvB), floor, ceiling)
+}
+
+func clampFeeRate(rate, floor, ceiling FeeRate) FeeRate {
+	if rate < floor {
+		return floor
+	}
+	if rate > ceiling {
+		log.Printf("[BTC_SERVICE] WARN: Fee estimate of %s capped at %s", rate, ceiling)
+		return ceiling
+	}
+	return rate
+}
+
+// Worst-case signature sizes. DER-encoded ECDSA signatures are at most 72
+// bytes plus the sighash flag; BIP340 signatures with SigHashDefault are 64.
+const (
+	maxEcdsaSigLen   = 73
+	schnorrSigLen    = 64
+	txOverhead       = 4 + 4 + 1 + 1 // version, locktime, input and output counts
+	txInBaseSize     = 32 + 4 + 4    // outpoint and sequence, without the scriptSig
+	witnessHeaderLen = 2             // segwit marker and flag
+)
+
+// redeemVSize estimates the virtual size of a one-output transaction spending
+// inputs HTLC outputs through the claim branch (preimageLen > 0) or the
+// refund branch, paying to redeemPkScript. Signature sizes are taken at their
+// maximum, so the estimate never falls short of the signed tx.
+func redeemVSize(htlcScript []byte, addrType localcommon.HtlcAddressType, preimageLen int, redeemPkScript []byte, inputs int) (int64, error) {
+	isClaim := preimageLen > 0
+	outputSize := 8 + varIntLen(len(redeemPkScript)) + len(redeemPkScript)
+
+	var scriptSigLen int
+	var witness []int // Sizes of the witness items
+	switch addrType {
+	case localcommon.HtlcP2SH, "":
+		scriptSigLen = pushLen(maxEcdsaSigLen) + pushLen(len(htlcScript)) + 1 // Branch selector opcode
+		if isClaim {
+			scriptSigLen += pushLen(preimageLen)
+		}
+	case localcommon.HtlcP2WSH:
+		if isClaim {
+			witness = []int{maxEcdsaSigLen, preimageLen, 1, len(htlcScript)}
+		} else {
+			witness = []int{maxEcdsaSigLen, 0, len(htlcScript)}
+		}
+	case localcommon.HtlcP2TR:
+		htlc, err := parseTaprootHtlc(htlcScript)
+		if err != nil {
+			return 0, err
+		}
+		leafIndex, leafLen := taprootRefundLeaf, len(htlc.refundLeaf)
+		if isClaim {
+			leafIndex, leafLen = taprootClaimLeaf, len(htlc.claimLeaf)
+		}
+		controlBlockLen := 33 + len(htlc.tree().LeafMerkleProofs[leafIndex].InclusionProof)
+		if isClaim {
+			witness = []int{schnorrSigLen, preimageLen, leafLen, controlBlockLen}
+		} else {
+			witness = []int{schnorrSigLen, leafLen, controlBlockLen}
+		}
+	default:
+		return 0, fmt.Errorf("unsupported HTLC address type %q", addrType)
+	}
+
+	inputSize := txInBaseSize + varIntLen(scriptSigLen) + scriptSigLen
+	baseSize := txOverhead - 1 + varIntLen(inputs) + inputs*inputSize + outputSize
+	weight := baseSize * 4
+	if witness != nil {
+		witnessSize := varIntLen(len(witness))
+		for _, item := range witness {
+			witnessSize += varIntLen(item) + item
+		}
+		weight += witnessHeaderLen + inputs*witnessSize
+	}
+	return int64((weight + 3) / 4), nil
+}
+
+// redeemFee prices a redeem at rate and checks that the remaining output is
+// not dust.
+func redeemFee(value btcutil.Amount, rate FeeRate, htlcScript []byte, addrType localcommon.HtlcAddressType, preimageLen int, redeemPkScript []byte, inputs int) (btcutil.Amount, error) {
+	vsize, err := redeemVSize(htlcScript, addrType, preimageLen, redeemPkScript, inputs)
+	if err != nil {
+		return 0, err
+	}
+	fee := rate.FeeForVSize(vsize)
+	out := wire.NewTxOut(int64(value-fee), redeemPkScript)
+	if value <= fee || mempool.IsDust(out, mempool.DefaultMinRelayTxFee) {
+		return 0, fmt.Errorf("%w: %s HTLC output minus %s fee (%d vB at %s)", ErrDustOutput, value, fee, vsize, rate)
+	}
+	return fee, nil
+}
+
+// pushLen is the size of a minimal data push of n bytes.
+func pushLen(n int) int {
+	switch {
+	case n < 76:
+		return 1 + n
+	case n <= 0xff:
+		return 2 + n
+	case n <= 0xffff:
+		return 3 + n
+	default:
+		return 5 + n
+	}
+}
+
+func varIntLen(n int) int {
+	return wire.VarIntSerializeSize(uint64(n))
+}
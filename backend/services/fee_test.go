@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+)
+
+var testFeeRate = FeeRatePerVByte(2)
+
+// TestRedeemVSizeCoversSignedTx checks the vsize estimate of every spend type
+// against the size of the signed transaction.
+func TestRedeemVSizeCoversSignedTx(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	redeemAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+	redeemPkScript := mustPayToAddrScript(redeemAddr)
+
+	for _, addrType := range []localcommon.HtlcAddressType{localcommon.HtlcP2SH, localcommon.HtlcP2WSH, localcommon.HtlcP2TR} {
+		f := newHtlcFixture(t, addrType)
+		for _, preimage := range [][]byte{f.preimage, nil} {
+			key, lockTime := f.resolverKey, int64(0)
+			if preimage == nil {
+				key, lockTime = f.userKey, f.lockTime
+			}
+			tx, err := buildRedeemTx([]*wire.MsgTx{f.fundingTx}, f.script, addrType, net, redeemAddr, key, preimage, lockTime, testFeeRate)
+			if err != nil {
+				t.Fatalf("%s: building redeem failed: %v", addrType, err)
+			}
+
+			estimate, err := redeemVSize(f.script, addrType, len(preimage), redeemPkScript, 1)
+			if err != nil {
+				t.Fatalf("%s: estimating vsize failed: %v", addrType, err)
+			}
+			actual := (blockchain.GetTransactionWeight(btcutil.NewTx(tx)) + 3) / 4
+			if estimate < actual || estimate > actual+2 {
+				t.Errorf("%s claim=%v: estimated %d vB for a %d vB tx", addrType, preimage != nil, estimate, actual)
+			}
+
+			fee := f.fundingTx.TxOut[0].Value - tx.TxOut[0].Value
+			if btcutil.Amount(fee) != testFeeRate.FeeForVSize(estimate) {
+				t.Errorf("%s: paid %d sat, expected %s for %d vB", addrType, fee, testFeeRate.FeeForVSize(estimate), estimate)
+			}
+		}
+	}
+}
+
+// TestRedeemRejectsDust checks that a redeem whose fee leaves a dust output,
+// or eats the whole HTLC, is refused rather than broadcast.
+func TestRedeemRejectsDust(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	redeemAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+	f := newHtlcFixture(t, localcommon.HtlcP2WSH)
+
+	vsize, err := redeemVSize(f.script, localcommon.HtlcP2WSH, len(f.preimage), mustPayToAddrScript(redeemAddr), 1)
+	if err != nil {
+		t.Fatalf("estimating vsize failed: %v", err)
+	}
+	value := f.fundingTx.TxOut[0].Value
+
+	// Leaves about 100 sat, below the 294 sat dust limit of a P2WPKH output.
+	nearlyAll := FeeRate((value - 100) * 1000 / vsize)
+	for _, rate := range []FeeRate{nearlyAll, FeeRatePerVByte(10_000)} {
+		_, err := buildRedeemTx([]*wire.MsgTx{f.fundingTx}, f.script, localcommon.HtlcP2WSH, net, redeemAddr, f.resolverKey, f.preimage, 0, rate)
+		if !errors.Is(err, ErrDustOutput) {
+			t.Errorf("at %s: expected ErrDustOutput, got %v", rate, err)
+		}
+	}
+}
+
+// TestClampFeeRate checks the floor and ceiling applied to estimates.
+func TestClampFeeRate(t *testing.T) {
+	floor, ceiling := FeeRatePerVByte(1), FeeRatePerVByte(500)
+	cases := map[FeeRate]FeeRate{
+		FeeRate(250):            floor,
+		FeeRatePerVByte(12):     FeeRatePerVByte(12),
+		FeeRatePerVByte(10_000): ceiling,
+	}
+	for in, want := range cases {
+		if got := clampFeeRate(in, floor, ceiling); got != want {
+			t.Errorf("clampFeeRate(%s) = %s, want %s", in, got, want)
+		}
+	}
+
+	if fee := FeeRate(1500).FeeForVSize(141); fee != 212 {
+		t.Errorf("expected 1.5 sat/vB over 141 vB to round up to 212 sat, got %d", fee)
+	}
+}
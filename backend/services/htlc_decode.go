@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+
+	localcommon "fusion-btc-resolver/common"
+)
+
+// ErrHtlcMismatch is returned when an HTLC script or address does not commit
+// to the terms it was expected to.
+var ErrHtlcMismatch = errors.New("HTLC does not match the expected terms")
+
+// scriptToken is one opcode of a script, with its data if it is a push.
+type scriptToken struct {
+	opcode byte
+	data   []byte
+}
+
+// tokenize splits a script into opcodes and pushes.
+func tokenize(script []byte) ([]scriptToken, error) {
+	var tokens []scriptToken
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		tokens = append(tokens, scriptToken{tokenizer.Opcode(), tokenizer.Data()})
+	}
+	if err := tokenizer.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// isPush reports whether the token is a data push, including the empty push
+// OP_0.
+func (t scriptToken) isPush() bool {
+	return t.opcode <= txscript.OP_PUSHDATA4
+}
+
+// scriptInt decodes a number pushed by ScriptBuilder.AddInt64.
+func (t scriptToken) scriptInt() (int64, error) {
+	switch {
+	case t.opcode == txscript.OP_0:
+		return 0, nil
+	case txscript.IsSmallInt(t.opcode):
+		return int64(txscript.AsSmallInt(t.opcode)), nil
+	case t.isPush():
+		// CLTV accepts numbers up to 5 bytes, enough for any locktime.
+		n, err := txscript.MakeScriptNum(t.data, true, 5)
+		if err != nil {
+			return 0, err
+		}
+		return int64(n), nil
+	default:
+		return 0, fmt.Errorf("opcode %d is not a number", t.opcode)
+	}
+}
+
+// Template wildcards for matchTemplate.
+const (
+	anyPush   = -1 // Any data push or small integer
+	anyLockOp = -2 // OP_CHECKLOCKTIMEVERIFY or OP_CHECKSEQUENCEVERIFY
+)
+
+// matchTemplate checks tokens against a template of opcodes and wildcards,
+// and returns the tokens matched by wildcards in order.
+func matchTemplate(tokens []scriptToken, template []int) ([]scriptToken, error) {
+	if len(tokens) != len(template) {
+		return nil, fmt.Errorf("expected %d opcodes, got %d", len(template), len(tokens))
+	}
+	var pushes []scriptToken
+	for i, want := range template {
+		if want == anyLockOp {
+			if op := tokens[i].opcode; op != txscript.OP_CHECKLOCKTIMEVERIFY && op != txscript.OP_CHECKSEQUENCEVERIFY {
+				return nil, fmt.Errorf("opcode %d at position %d: expected a timelock", op, i)
+			}
+			pushes = append(pushes, tokens[i])
+			continue
+		}
+		if want == anyPush {
+			if !tokens[i].isPush() && !txscript.IsSmallInt(tokens[i].opcode) {
+				return nil, fmt.Errorf("opcode %d at position %d: expected a push", tokens[i].opcode, i)
+			}
+			pushes = append(pushes, tokens[i])
+			continue
+		}
+		if tokens[i].opcode != byte(want) {
+			return nil, fmt.Errorf("opcode %d at position %d: expected %d", tokens[i].opcode, i, want)
+		}
+	}
+	return pushes, nil
+}
+
+// DecodeHtlc reverses BuildHtlc, extracting the terms an HTLC script commits
+// to. For P2TR, htlcScript is a tapscript bundle. Anything that is not exactly
+// the script BuildHtlc produces is rejected.
+func DecodeHtlc(htlcScript []byte, addrType localcommon.HtlcAddressType) (*HtlcParams, error) {
+	switch addrType {
+	case localcommon.HtlcP2SH, localcommon.HtlcP2WSH, "":
+		return decodeLegacyHtlc(htlcScript)
+	case localcommon.HtlcP2TR:
+		return decodeTaprootHtlc(htlcScript)
+	default:
+		return nil, fmt.Errorf("unsupported HTLC address type %q", addrType)
+	}
+}
+
+func decodeLegacyHtlc(htlcScript []byte) (*HtlcParams, error) {
+	tokens, err := tokenize(htlcScript)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTLC script: %v", err)
+	}
+	pushes, err := matchTemplate(tokens, []int{
+		txscript.OP_IF, txscript.OP_SHA256, anyPush, txscript.OP_EQUALVERIFY, anyPush,
+		txscript.OP_ELSE, anyPush, anyLockOp, txscript.OP_DROP, anyPush,
+		txscript.OP_ENDIF, txscript.OP_CHECKSIG,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("not an HTLC script: %v", err)
+	}
+
+	params := &HtlcParams{
+		SecretHash:   pushes[0].data,
+		ClaimPubKey:  pushes[1].data,
+		RefundPubKey: pushes[4].data,
+	}
+	if err := params.decodeTimelock(pushes[2], pushes[3]); err != nil {
+		return nil, err
+	}
+	if len(params.SecretHash) != 32 {
+		return nil, fmt.Errorf("invalid HTLC secret hash of %d bytes", len(params.SecretHash))
+	}
+	return params, nil
+}
+
+// decodeTimelock sets the locktime and timelock type from the refund
+// branch's number and timelock opcode.
+func (p *HtlcParams) decodeTimelock(value, op scriptToken) error {
+	lockTime, err := value.scriptInt()
+	if err != nil {
+		return fmt.Errorf("invalid HTLC locktime: %v", err)
+	}
+	p.LockTime = lockTime
+	p.TimelockType = localcommon.HtlcCLTV
+	if op.opcode == txscript.OP_CHECKSEQUENCEVERIFY {
+		p.TimelockType = localcommon.HtlcCSV
+	}
+	_, err = p.lockOpcode()
+	return err
+}
+
+func decodeTaprootHtlc(bundle []byte) (*HtlcParams, error) {
+	htlc, err := parseTaprootHtlc(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	claim, err := tokenize(htlc.claimLeaf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claim leaf: %v", err)
+	}
+	claimPushes, err := matchTemplate(claim, []int{
+		txscript.OP_SHA256, anyPush, txscript.OP_EQUALVERIFY, anyPush, txscript.OP_CHECKSIG,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("not an HTLC claim leaf: %v", err)
+	}
+
+	refund, err := tokenize(htlc.refundLeaf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid refund leaf: %v", err)
+	}
+	refundPushes, err := matchTemplate(refund, []int{
+		anyPush, anyLockOp, txscript.OP_DROP, anyPush, txscript.OP_CHECKSIG,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("not an HTLC refund leaf: %v", err)
+	}
+
+	params := &HtlcParams{
+		SecretHash:   claimPushes[0].data,
+		ClaimPubKey:  claimPushes[1].data,
+		RefundPubKey: refundPushes[2].data,
+		InternalKey:  schnorr.SerializePubKey(htlc.internalKey),
+	}
+	if err := params.decodeTimelock(refundPushes[0], refundPushes[1]); err != nil {
+		return nil, err
+	}
+	if len(params.SecretHash) != 32 {
+		return nil, fmt.Errorf("invalid HTLC secret hash of %d bytes", len(params.SecretHash))
+	}
+	for _, key := range [][]byte{params.ClaimPubKey, params.RefundPubKey} {
+		if _, err := schnorr.ParsePubKey(key); err != nil {
+			return nil, fmt.Errorf("invalid x-only key in HTLC leaf: %v", err)
+		}
+	}
+	return params, nil
+}
+
+// VerifyHtlc checks that address is the deposit address of htlcScript, and
+// that the script commits to the expected terms. Keys are compared in the
+// form the script uses them, so P2TR accepts compressed expected keys. A nil
+// expected.InternalKey accepts any internal key.
+func VerifyHtlc(address btcutil.Address, htlcScript []byte, addrType localcommon.HtlcAddressType, net *chaincfg.Params, expected *HtlcParams) error {
+	derived, err := HtlcAddress(htlcScript, addrType, net)
+	if err != nil {
+		return err
+	}
+	if derived.EncodeAddress() != address.EncodeAddress() {
+		return fmt.Errorf("%w: script derives %s, not %s", ErrHtlcMismatch, derived, address)
+	}
+
+	params, err := DecodeHtlc(htlcScript, addrType)
+	if err != nil {
+		return err
+	}
+
+	claimKey, refundKey := expected.ClaimPubKey, expected.RefundPubKey
+	if addrType == localcommon.HtlcP2TR {
+		claimKey, refundKey = xOnly(claimKey), xOnly(refundKey)
+	}
+	switch {
+	case !bytes.Equal(params.SecretHash, expected.SecretHash):
+		return fmt.Errorf("%w: secret hash %x, expected %x", ErrHtlcMismatch, params.SecretHash, expected.SecretHash)
+	case !bytes.Equal(params.ClaimPubKey, claimKey):
+		return fmt.Errorf("%w: claim key %x, expected %x", ErrHtlcMismatch, params.ClaimPubKey, claimKey)
+	case !bytes.Equal(params.RefundPubKey, refundKey):
+		return fmt.Errorf("%w: refund key %x, expected %x", ErrHtlcMismatch, params.RefundPubKey, refundKey)
+	case params.LockTime != expected.LockTime:
+		return fmt.Errorf("%w: locktime %d, expected %d", ErrHtlcMismatch, params.LockTime, expected.LockTime)
+	case params.TimelockType != timelockTypeOrDefault(expected.TimelockType):
+		return fmt.Errorf("%w: %s timelock, expected %s", ErrHtlcMismatch, params.TimelockType, timelockTypeOrDefault(expected.TimelockType))
+	case expected.InternalKey != nil && !bytes.Equal(params.InternalKey, expected.InternalKey):
+		return fmt.Errorf("%w: internal key %x, expected %x", ErrHtlcMismatch, params.InternalKey, expected.InternalKey)
+	}
+	return nil
+}
+
+func timelockTypeOrDefault(t localcommon.HtlcTimelockType) localcommon.HtlcTimelockType {
+	if t == "" {
+		return localcommon.HtlcCLTV
+	}
+	return t
+}
+
+// MatchHtlcAddress checks whether address is the deposit address of an HTLC
+// with the candidate terms, for when only the address is known. It returns
+// the rebuilt script on a match.
+func MatchHtlcAddress(address btcutil.Address, candidate *HtlcParams, addrType localcommon.HtlcAddressType, net *chaincfg.Params) ([]byte, error) {
+	htlcScript, derived, err := BuildHtlc(candidate, addrType, net)
+	if err != nil {
+		return nil, err
+	}
+	if derived.EncodeAddress() != address.EncodeAddress() {
+		return nil, fmt.Errorf("%w: candidate terms derive %s, not %s", ErrHtlcMismatch, derived, address)
+	}
+	return htlcScript, nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+
+	localcommon "fusion-btc-resolver/common"
+)
+
+func testHtlcParams(lockTime int64) *HtlcParams {
+	userKey, _ := btcec.NewPrivateKey()
+	resolverKey, _ := btcec.NewPrivateKey()
+	secretHash := sha256.Sum256([]byte("secret"))
+	return &HtlcParams{
+		SecretHash:   secretHash[:],
+		ClaimPubKey:  resolverKey.PubKey().SerializeCompressed(),
+		RefundPubKey: userKey.PubKey().SerializeCompressed(),
+		LockTime:     lockTime,
+	}
+}
+
+// TestDecodeHtlcReversesBuildHtlc checks that every address type decodes back
+// to the terms it was built from, across locktime encodings.
+func TestDecodeHtlcReversesBuildHtlc(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	for _, addrType := range []localcommon.HtlcAddressType{localcommon.HtlcP2SH, localcommon.HtlcP2WSH, localcommon.HtlcP2TR} {
+		for _, tc := range []struct {
+			timelockType localcommon.HtlcTimelockType
+			lockTime     int64
+		}{
+			{localcommon.HtlcCLTV, 0}, {localcommon.HtlcCLTV, 16}, {localcommon.HtlcCLTV, 17},
+			{localcommon.HtlcCLTV, 800_144}, {localcommon.HtlcCLTV, 0x7fffffff},
+			{localcommon.HtlcCSV, 1}, {localcommon.HtlcCSV, 144}, {localcommon.HtlcCSV, maxCsvDelay},
+		} {
+			lockTime := tc.lockTime
+			want := testHtlcParams(lockTime)
+			want.TimelockType = tc.timelockType
+			script, addr, err := BuildHtlc(want, addrType, net)
+			if err != nil {
+				t.Fatalf("%s: BuildHtlc failed: %v", addrType, err)
+			}
+
+			got, err := DecodeHtlc(script, addrType)
+			if err != nil {
+				t.Fatalf("%s/%d: DecodeHtlc failed: %v", addrType, lockTime, err)
+			}
+			claimKey, refundKey := want.ClaimPubKey, want.RefundPubKey
+			if addrType == localcommon.HtlcP2TR {
+				claimKey, refundKey = xOnly(claimKey), xOnly(refundKey)
+				if !bytes.Equal(got.InternalKey, numsKey().SerializeCompressed()[1:]) {
+					t.Errorf("%s: expected the NUMS internal key, got %x", addrType, got.InternalKey)
+				}
+			}
+			if !bytes.Equal(got.SecretHash, want.SecretHash) || !bytes.Equal(got.ClaimPubKey, claimKey) ||
+				!bytes.Equal(got.RefundPubKey, refundKey) || got.LockTime != lockTime || got.TimelockType != tc.timelockType {
+				t.Errorf("%s/%d: decoded %+v", addrType, lockTime, got)
+			}
+
+			if err := VerifyHtlc(addr, script, addrType, net, want); err != nil {
+				t.Errorf("%s/%d: VerifyHtlc failed: %v", addrType, lockTime, err)
+			}
+		}
+	}
+}
+
+// TestVerifyHtlcCatchesMismatches checks that a script for different terms,
+// or an address for a different script, is rejected.
+func TestVerifyHtlcCatchesMismatches(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	want := testHtlcParams(800_144)
+	script, addr, err := BuildHtlc(want, localcommon.HtlcP2WSH, net)
+	if err != nil {
+		t.Fatalf("BuildHtlc failed: %v", err)
+	}
+
+	other := *want
+	other.LockTime++
+	if err := VerifyHtlc(addr, script, localcommon.HtlcP2WSH, net, &other); !errors.Is(err, ErrHtlcMismatch) {
+		t.Errorf("expected a locktime mismatch, got %v", err)
+	}
+	other = *want
+	other.ClaimPubKey = want.RefundPubKey
+	if err := VerifyHtlc(addr, script, localcommon.HtlcP2WSH, net, &other); !errors.Is(err, ErrHtlcMismatch) {
+		t.Errorf("expected a claim key mismatch, got %v", err)
+	}
+
+	p2sh, _ := HtlcAddress(script, localcommon.HtlcP2SH, net)
+	if err := VerifyHtlc(p2sh, script, localcommon.HtlcP2WSH, net, want); !errors.Is(err, ErrHtlcMismatch) {
+		t.Errorf("expected an address mismatch, got %v", err)
+	}
+
+	if _, err := MatchHtlcAddress(addr, want, localcommon.HtlcP2WSH, net); err != nil {
+		t.Errorf("MatchHtlcAddress failed for the right terms: %v", err)
+	}
+	if _, err := MatchHtlcAddress(addr, &other, localcommon.HtlcP2WSH, net); !errors.Is(err, ErrHtlcMismatch) {
+		t.Errorf("expected MatchHtlcAddress to reject other terms, got %v", err)
+	}
+}
+
+// TestDecodeHtlcRejectsOtherScripts checks that near-miss scripts are not
+// mistaken for HTLCs.
+func TestDecodeHtlcRejectsOtherScripts(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	addr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+	script, _, _ := BuildHtlc(testHtlcParams(800_144), localcommon.HtlcP2SH, net)
+
+	cases := map[string][]byte{
+		"p2wpkh":           mustPayToAddrScript(addr),
+		"truncated":        script[:len(script)-1],
+		"trailing opcode":  append(append([]byte{}, script...), txscript.OP_DROP),
+		"swapped branches": append([]byte{txscript.OP_NOTIF}, script[1:]...),
+	}
+	for name, s := range cases {
+		if _, err := DecodeHtlc(s, localcommon.HtlcP2SH); err == nil {
+			t.Errorf("%s: expected DecodeHtlc to fail", name)
+		}
+	}
+}
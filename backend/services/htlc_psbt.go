@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+)
+
+// A refund PSBT lets the user take their deposit back through the HTLC's
+// refund branch with their own wallet, without the resolver's involvement.
+// It is the unsigned transaction buildRedeemTx would build for a refund, with
+// every input annotated per BIP174 (and BIP371 for Taproot):
+//
+//   - P2SH: the full funding tx and the redeem script.
+//   - P2WSH: the funding tx, the spent output and the witness script.
+//   - P2TR: the spent output, the internal key, the merkle root and the
+//     refund leaf with its control block.
+//
+// The resolver does not know the derivation of the user's refund key, so a
+// wallet must recognise the key in the script itself. After signing, the
+// refund branch is selected by an empty item (OP_FALSE for P2SH) between the
+// signature and the script, as in signRedeemInput.
+
+// buildRefundPsbt builds an unsigned refund of every HTLC output of fundingTxs
+// to refundAddress. lockTime is the CLTV refund height; a CSV refund takes its
+// delay from the script.
+func buildRefundPsbt(fundingTxs []*wire.MsgTx, htlcScript []byte, addrType localcommon.HtlcAddressType, net *chaincfg.Params, refundAddress btcutil.Address, lockTime int64, feeRate FeeRate) (*psbt.Packet, error) {
+	refund, err := newRedeemTemplate(fundingTxs, htlcScript, addrType, net, refundAddress, 0, lockTime, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	packet, err := psbt.NewFromUnsignedTx(refund.tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund PSBT: %v", err)
+	}
+
+	var leaf *psbt.TaprootTapLeafScript
+	var internalKey, merkleRoot []byte
+	if addrType == localcommon.HtlcP2TR {
+		htlc, err := parseTaprootHtlc(htlcScript)
+		if err != nil {
+			return nil, err
+		}
+		tree := htlc.tree()
+		ctrl := tree.LeafMerkleProofs[taprootRefundLeaf].ToControlBlock(htlc.internalKey)
+		controlBlock, err := ctrl.ToBytes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build control block: %v", err)
+		}
+		rootHash := tree.RootNode.TapHash()
+		leaf = &psbt.TaprootTapLeafScript{
+			ControlBlock: controlBlock,
+			Script:       htlc.refundLeaf,
+			LeafVersion:  txscript.BaseLeafVersion,
+		}
+		internalKey, merkleRoot = schnorr.SerializePubKey(htlc.internalKey), rootHash[:]
+	}
+
+	for i, in := range refund.tx.TxIn {
+		input := &packet.Inputs[i]
+		prevOut := refund.prevOuts.FetchPrevOutput(in.PreviousOutPoint)
+		switch addrType {
+		case localcommon.HtlcP2TR:
+			input.WitnessUtxo = prevOut
+			input.SighashType = txscript.SigHashDefault
+			input.TaprootLeafScript = []*psbt.TaprootTapLeafScript{leaf}
+			input.TaprootInternalKey = internalKey
+			input.TaprootMerkleRoot = merkleRoot
+		case localcommon.HtlcP2WSH:
+			// The funding tx guards against wallets being lied to about
+			// the amounts of other inputs, which BIP143 does not commit to.
+			input.NonWitnessUtxo = refund.fundingTxs[in.PreviousOutPoint.Hash]
+			input.WitnessUtxo = prevOut
+			input.SighashType = txscript.SigHashAll
+			input.WitnessScript = htlcScript
+		default:
+			input.NonWitnessUtxo = refund.fundingTxs[in.PreviousOutPoint.Hash]
+			input.SighashType = txscript.SigHashAll
+			input.RedeemScript = htlcScript
+		}
+	}
+	if err := packet.SanityCheck(); err != nil {
+		return nil, fmt.Errorf("invalid refund PSBT: %v", err)
+	}
+	return packet, nil
+}
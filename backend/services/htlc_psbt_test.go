@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+)
+
+// TestRefundPsbtIsSignable builds a refund PSBT for every address type, signs
+// it with the user's key using only what the PSBT carries, and checks the
+// result with the script interpreter.
+func TestRefundPsbtIsSignable(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	refundAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+
+	for _, addrType := range []localcommon.HtlcAddressType{localcommon.HtlcP2SH, localcommon.HtlcP2WSH, localcommon.HtlcP2TR} {
+		f := newHtlcFixture(t, addrType)
+		packet, err := buildRefundPsbt([]*wire.MsgTx{f.fundingTx}, f.script, addrType, net, refundAddr, f.lockTime, testFeeRate)
+		if err != nil {
+			t.Fatalf("%s: buildRefundPsbt failed: %v", addrType, err)
+		}
+
+		// What the user's wallet receives is the serialized packet.
+		encoded, err := packet.B64Encode()
+		if err != nil {
+			t.Fatalf("%s: failed to encode PSBT: %v", addrType, err)
+		}
+		packet, err = psbt.NewFromRawBytes(bytes.NewReader([]byte(encoded)), true)
+		if err != nil {
+			t.Fatalf("%s: failed to decode PSBT: %v", addrType, err)
+		}
+
+		tx := packet.UnsignedTx
+		if tx.LockTime != uint32(f.lockTime) || tx.TxIn[0].Sequence == wire.MaxTxInSequenceNum {
+			t.Errorf("%s: expected locktime %d with a non-final sequence, got %d %#x", addrType, f.lockTime, tx.LockTime, tx.TxIn[0].Sequence)
+		}
+		fee, err := packet.GetTxFee()
+		if err != nil || fee <= 0 {
+			t.Errorf("%s: expected a fee, got %s %v", addrType, fee, err)
+		}
+
+		in := packet.Inputs[0]
+		prevOut := f.fundingTx.TxOut[0]
+		fetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+		sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+		switch addrType {
+		case localcommon.HtlcP2SH:
+			sig, err := txscript.RawTxInSignature(tx, 0, in.RedeemScript, in.SighashType, f.userKey)
+			if err != nil {
+				t.Fatalf("%s: failed to sign: %v", addrType, err)
+			}
+			tx.TxIn[0].SignatureScript, _ = txscript.NewScriptBuilder().
+				AddData(sig).AddOp(txscript.OP_FALSE).AddData(in.RedeemScript).Script()
+		case localcommon.HtlcP2WSH:
+			sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, 0, in.WitnessUtxo.Value, in.WitnessScript, in.SighashType, f.userKey)
+			if err != nil {
+				t.Fatalf("%s: failed to sign: %v", addrType, err)
+			}
+			tx.TxIn[0].Witness = wire.TxWitness{sig, nil, in.WitnessScript}
+		case localcommon.HtlcP2TR:
+			leaf := in.TaprootLeafScript[0]
+			sig, err := txscript.RawTxInTapscriptSignature(tx, sigHashes, 0, in.WitnessUtxo.Value, in.WitnessUtxo.PkScript, txscript.NewBaseTapLeaf(leaf.Script), in.SighashType, f.userKey)
+			if err != nil {
+				t.Fatalf("%s: failed to sign: %v", addrType, err)
+			}
+			tx.TxIn[0].Witness = wire.TxWitness{sig, leaf.Script, leaf.ControlBlock}
+		}
+		if err := f.verify(t, tx); err != nil {
+			t.Errorf("%s: signed refund PSBT failed to verify: %v", addrType, err)
+		}
+	}
+}
+
+// TestRefundPsbtCsvSequence checks that a CSV refund PSBT carries the
+// script's delay in its input sequence instead of a locktime.
+func TestRefundPsbtCsvSequence(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	refundAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+	f := newHtlcFixtureWith(t, &BtcHtlcService{net: net}, localcommon.HtlcP2WSH, localcommon.HtlcCSV, 144)
+
+	packet, err := buildRefundPsbt([]*wire.MsgTx{f.fundingTx}, f.script, localcommon.HtlcP2WSH, net, refundAddr, 800_144, testFeeRate)
+	if err != nil {
+		t.Fatalf("buildRefundPsbt failed: %v", err)
+	}
+	tx := packet.UnsignedTx
+	if tx.Version < 2 || tx.LockTime != 0 || tx.TxIn[0].Sequence != 144 {
+		t.Errorf("expected a version 2 tx with sequence 144, got version %d locktime %d sequence %d", tx.Version, tx.LockTime, tx.TxIn[0].Sequence)
+	}
+}
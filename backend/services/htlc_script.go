@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+)
+
+// HtlcParams are the terms an HTLC script commits to.
+type HtlcParams struct {
+	SecretHash   []byte // SHA256 of the swap secret
+	ClaimPubKey  []byte // Resolver's key, spends with the secret
+	RefundPubKey []byte // User's key, spends after LockTime
+	LockTime     int64  // Refund branch block height, or the delay in blocks for CSV
+	InternalKey  []byte // P2TR only: x-only internal key, nil for the NUMS point
+
+	TimelockType localcommon.HtlcTimelockType // Empty means CLTV
+}
+
+// maxCsvDelay is the largest block delay a BIP68 sequence number can encode.
+const maxCsvDelay = 0xffff
+
+// lockOpcode returns the refund branch's timelock opcode for p, checking that
+// a CSV delay fits in a BIP68 sequence number.
+func (p *HtlcParams) lockOpcode() (byte, error) {
+	switch p.TimelockType {
+	case localcommon.HtlcCLTV, "":
+		return txscript.OP_CHECKLOCKTIMEVERIFY, nil
+	case localcommon.HtlcCSV:
+		if p.LockTime < 1 || p.LockTime > maxCsvDelay {
+			return 0, fmt.Errorf("CSV refund delay must be between 1 and %d blocks, got %d", maxCsvDelay, p.LockTime)
+		}
+		return txscript.OP_CHECKSEQUENCEVERIFY, nil
+	default:
+		return 0, fmt.Errorf("unsupported HTLC timelock type %q", p.TimelockType)
+	}
+}
+
+// BuildHtlc builds the HTLC script for p and its deposit address. The script
+// is the same for P2SH and P2WSH:
+//
+//	OP_IF
+//	    OP_SHA256 <secretHash> OP_EQUALVERIFY <claimPubKey>
+//	OP_ELSE
+//	    <lockTime> OP_CHECKLOCKTIMEVERIFY OP_DROP <refundPubKey>
+//	OP_ENDIF
+//	OP_CHECKSIG
+//
+// The CSV variant uses OP_CHECKSEQUENCEVERIFY with a delay in its place. For
+// P2TR, it is a tapscript bundle of the two branches as separate leaves.
+func BuildHtlc(p *HtlcParams, addrType localcommon.HtlcAddressType, net *chaincfg.Params) ([]byte, btcutil.Address, error) {
+	lockOp, err := p.lockOpcode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var htlcScript []byte
+	if addrType == localcommon.HtlcP2TR {
+		htlc, err := newTaprootHtlc(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if htlcScript, err = htlc.bundle(); err != nil {
+			return nil, nil, fmt.Errorf("failed to build tapscript bundle: %v", err)
+		}
+	} else {
+		builder := txscript.NewScriptBuilder()
+
+		// Path 1: Claim with secret (Resolver's path)
+		builder.AddOp(txscript.OP_IF)
+		builder.AddOp(txscript.OP_SHA256)
+		builder.AddData(p.SecretHash)
+		builder.AddOp(txscript.OP_EQUALVERIFY)
+		builder.AddData(p.ClaimPubKey)
+
+		// Path 2: Refund after timeout (User's path)
+		builder.AddOp(txscript.OP_ELSE)
+		builder.AddInt64(p.LockTime)
+		builder.AddOp(lockOp)
+		builder.AddOp(txscript.OP_DROP)
+		builder.AddData(p.RefundPubKey)
+
+		builder.AddOp(txscript.OP_ENDIF)
+		builder.AddOp(txscript.OP_CHECKSIG)
+
+		if htlcScript, err = builder.Script(); err != nil {
+			return nil, nil, fmt.Errorf("failed to build HTLC script: %v", err)
+		}
+	}
+
+	htlcAddress, err := HtlcAddress(htlcScript, addrType, net)
+	if err != nil {
+		return nil, nil, err
+	}
+	return htlcScript, htlcAddress, nil
+}
+
+// HtlcAddress commits to an HTLC redeem script with the given address type.
+// An empty type means P2SH, which is what swaps created before address types
+// were selectable used. For P2TR, htlcScript is a tapscript bundle.
+func HtlcAddress(htlcScript []byte, addrType localcommon.HtlcAddressType, net *chaincfg.Params) (btcutil.Address, error) {
+	switch addrType {
+	case localcommon.HtlcP2SH, "":
+		addr, err := btcutil.NewAddressScriptHash(htlcScript, net)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create P2SH address: %v", err)
+		}
+		return addr, nil
+	case localcommon.HtlcP2WSH:
+		scriptHash := sha256.Sum256(htlcScript)
+		addr, err := btcutil.NewAddressWitnessScriptHash(scriptHash[:], net)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create P2WSH address: %v", err)
+		}
+		return addr, nil
+	case localcommon.HtlcP2TR:
+		htlc, err := parseTaprootHtlc(htlcScript)
+		if err != nil {
+			return nil, err
+		}
+		return htlc.address(net)
+	default:
+		return nil, fmt.Errorf("unsupported HTLC address type %q", addrType)
+	}
+}
+
+// buildRedeemTx builds and signs a transaction spending every HTLC output of
+// fundingTxs to redeemAddress, through the claim branch if preimage is set and
+// the refund branch otherwise. A CSV refund takes its delay from the script
+// and ignores lockTime. The fee is feeRate times the estimated vsize of
+// the spend; if that leaves a dust output, ErrDustOutput is returned.
+//
+// P2SH inputs carry the legacy signature in the scriptSig. P2WSH inputs are
+// signed with the BIP143 sighash, which commits to the input amount, and carry
+// everything in the witness. The branch selector follows MINIMALIF, which
+// standardness enforces for witness scripts: 0x01 for the claim branch and an
+// empty item for the refund branch. P2TR inputs are spent through the claim or
+// refund tapleaf with a BIP341 Schnorr signature.
+func buildRedeemTx(fundingTxs []*wire.MsgTx, htlcScript []byte, addrType localcommon.HtlcAddressType, net *chaincfg.Params, redeemAddress btcutil.Address, key *btcec.PrivateKey, preimage []byte, lockTime int64, feeRate FeeRate) (*wire.MsgTx, error) {
+	redeem, err := newRedeemTemplate(fundingTxs, htlcScript, addrType, net, redeemAddress, len(preimage), lockTime, feeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	var taproot *taprootHtlc
+	if addrType == localcommon.HtlcP2TR {
+		if taproot, err = parseTaprootHtlc(htlcScript); err != nil {
+			return nil, err
+		}
+	}
+	tx := redeem.tx
+	sigHashes := txscript.NewTxSigHashes(tx, redeem.prevOuts)
+	for i, in := range tx.TxIn {
+		value := redeem.prevOuts.FetchPrevOutput(in.PreviousOutPoint).Value
+		if err := signRedeemInput(tx, i, taproot, sigHashes, htlcScript, redeem.htlcPkScript, addrType, value, key, preimage); err != nil {
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// redeemTemplate is an unsigned redeem transaction together with the HTLC
+// outputs it spends.
+type redeemTemplate struct {
+	tx           *wire.MsgTx
+	prevOuts     *txscript.MultiPrevOutFetcher
+	fundingTxs   map[chainhash.Hash]*wire.MsgTx
+	htlcPkScript []byte
+}
+
+// newRedeemTemplate builds the unsigned transaction of buildRedeemTx, with the
+// fee priced for a claim witness carrying a preimage of preimageLen bytes, or
+// a refund witness if preimageLen is 0.
+func newRedeemTemplate(fundingTxs []*wire.MsgTx, htlcScript []byte, addrType localcommon.HtlcAddressType, net *chaincfg.Params, redeemAddress btcutil.Address, preimageLen int, lockTime int64, feeRate FeeRate) (*redeemTemplate, error) {
+	htlcAddr, err := HtlcAddress(htlcScript, addrType, net)
+	if err != nil {
+		return nil, err
+	}
+	htlcPkScript, err := txscript.PayToAddrScript(htlcAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every output paying the HTLC is swept, whichever tx it is in.
+	redeem := &redeemTemplate{
+		prevOuts:     txscript.NewMultiPrevOutFetcher(nil),
+		fundingTxs:   make(map[chainhash.Hash]*wire.MsgTx, len(fundingTxs)),
+		htlcPkScript: htlcPkScript,
+	}
+	var outpoints []wire.OutPoint
+	var htlcValue btcutil.Amount
+	for _, fundingTx := range fundingTxs {
+		fundingTxHash := fundingTx.TxHash()
+		redeem.fundingTxs[fundingTxHash] = fundingTx
+		for i, out := range fundingTx.TxOut {
+			outpoint := wire.OutPoint{Hash: fundingTxHash, Index: uint32(i)}
+			if !bytes.Equal(out.PkScript, htlcPkScript) || redeem.prevOuts.FetchPrevOutput(outpoint) != nil {
+				continue
+			}
+			redeem.prevOuts.AddPrevOut(outpoint, out)
+			outpoints = append(outpoints, outpoint)
+			htlcValue += btcutil.Amount(out.Value)
+		}
+	}
+
+	if len(outpoints) == 0 {
+		return nil, fmt.Errorf("could not find HTLC output in funding tx")
+	}
+	redeemPkScript := mustPayToAddrScript(redeemAddress)
+	fee, err := redeemFee(htlcValue, feeRate, htlcScript, addrType, preimageLen, redeemPkScript, len(outpoints))
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxOut(wire.NewTxOut(int64(htlcValue-fee), redeemPkScript))
+
+	// A non-final sequence is required for CLTV; all values used here signal
+	// BIP125 replaceability, so a stuck redeem can be re-signed at a higher fee.
+	isClaim := preimageLen > 0
+	sequence := uint32(wire.MaxTxInSequenceNum - 2)
+	if !isClaim {
+		terms, err := DecodeHtlc(htlcScript, addrType)
+		if err != nil {
+			return nil, err
+		}
+		if terms.TimelockType == localcommon.HtlcCSV {
+			// BIP68: a sequence below 2^16 without the type flag is a
+			// relative lock in blocks, which CSV compares its delay against.
+			sequence = uint32(terms.LockTime)
+		} else {
+			tx.LockTime = uint32(lockTime)
+			sequence = 0
+		}
+	}
+	for i := range outpoints {
+		txIn := wire.NewTxIn(&outpoints[i], nil, nil)
+		txIn.Sequence = sequence
+		tx.AddTxIn(txIn)
+	}
+	redeem.tx = tx
+	return redeem, nil
+}
+
+// signRedeemInput signs input idx of a redeem transaction, spending an HTLC
+// output worth value.
+func signRedeemInput(tx *wire.MsgTx, idx int, taproot *taprootHtlc, sigHashes *txscript.TxSigHashes, htlcScript, htlcPkScript []byte, addrType localcommon.HtlcAddressType, value int64, key *btcec.PrivateKey, preimage []byte) error {
+	isClaim := len(preimage) > 0
+	switch addrType {
+	case localcommon.HtlcP2TR:
+		return taproot.signScriptPath(tx, idx, sigHashes, htlcPkScript, value, key, preimage)
+	case localcommon.HtlcP2WSH:
+		sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, idx, value, htlcScript, txscript.SigHashAll, key)
+		if err != nil {
+			return fmt.Errorf("failed to sign redemption tx: %v", err)
+		}
+
+		if isClaim {
+			tx.TxIn[idx].Witness = wire.TxWitness{sig, preimage, {0x01}, htlcScript}
+		} else {
+			tx.TxIn[idx].Witness = wire.TxWitness{sig, nil, htlcScript}
+		}
+		return nil
+	}
+
+	sig, err := txscript.RawTxInSignature(tx, idx, htlcScript, txscript.SigHashAll, key)
+	if err != nil {
+		return fmt.Errorf("failed to sign redemption tx: %v", err)
+	}
+
+	builder := txscript.NewScriptBuilder()
+	builder.AddData(sig)
+	if isClaim {
+		builder.AddData(preimage)
+		builder.AddOp(txscript.OP_TRUE) // Select the IF branch
+	} else {
+		builder.AddOp(txscript.OP_FALSE) // Select the ELSE branch
+	}
+	builder.AddData(htlcScript)
+	scriptSig, err := builder.Script()
+	if err != nil {
+		return fmt.Errorf("failed to build redemption scriptSig: %v", err)
+	}
+	tx.TxIn[idx].SignatureScript = scriptSig
+	return nil
+}
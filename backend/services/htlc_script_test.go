@@ -0,0 +1,275 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	localcommon "fusion-btc-resolver/common"
+)
+
+// htlcFixture is a funded HTLC with known keys, for signing tests.
+type htlcFixture struct {
+	script      []byte
+	fundingTx   *wire.MsgTx
+	userKey     *btcec.PrivateKey
+	resolverKey *btcec.PrivateKey
+	preimage    []byte
+	lockTime    int64
+}
+
+func newHtlcFixture(t *testing.T, addrType localcommon.HtlcAddressType) *htlcFixture {
+	t.Helper()
+	return newHtlcFixtureFor(t, &BtcHtlcService{net: &chaincfg.RegressionNetParams}, addrType)
+}
+
+func newHtlcFixtureFor(t *testing.T, svc *BtcHtlcService, addrType localcommon.HtlcAddressType) *htlcFixture {
+	t.Helper()
+	return newHtlcFixtureWith(t, svc, addrType, localcommon.HtlcCLTV, 800_144)
+}
+
+func newHtlcFixtureWith(t *testing.T, svc *BtcHtlcService, addrType localcommon.HtlcAddressType, timelockType localcommon.HtlcTimelockType, lockTime int64) *htlcFixture {
+	t.Helper()
+
+	userKey, _ := btcec.NewPrivateKey()
+	resolverKey, _ := btcec.NewPrivateKey()
+	preimage := []byte("0123456789abcdef0123456789abcdef")
+	secretHash := sha256.Sum256(preimage)
+
+	script, addr, err := svc.CreateHtlc(userKey.PubKey().SerializeCompressed(), resolverKey.PubKey().SerializeCompressed(), secretHash[:], lockTime, timelockType, addrType)
+	if err != nil {
+		t.Fatalf("CreateHtlc failed: %v", err)
+	}
+
+	fundingTx := wire.NewMsgTx(2)
+	fundingTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 7}, nil, nil))
+	fundingTx.AddTxOut(wire.NewTxOut(100_000, mustPayToAddrScript(addr)))
+
+	return &htlcFixture{script, fundingTx, userKey, resolverKey, preimage, lockTime}
+}
+
+// verify runs the script engine over the redeem tx's only input.
+func (f *htlcFixture) verify(t *testing.T, tx *wire.MsgTx) error {
+	t.Helper()
+	prevOut := f.fundingTx.TxOut[0]
+	fetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+	vm, err := txscript.NewEngine(prevOut.PkScript, tx, 0, txscript.StandardVerifyFlags, nil, txscript.NewTxSigHashes(tx, fetcher), prevOut.Value, fetcher)
+	if err != nil {
+		t.Fatalf("failed to create script engine: %v", err)
+	}
+	return vm.Execute()
+}
+
+// TestRedeemTxSpendsBothBranches signs claim and refund spends for every
+// address type and checks them with the script interpreter.
+func TestRedeemTxSpendsBothBranches(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	redeemAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+
+	for _, addrType := range []localcommon.HtlcAddressType{localcommon.HtlcP2SH, localcommon.HtlcP2WSH, localcommon.HtlcP2TR} {
+		f := newHtlcFixture(t, addrType)
+
+		claim, err := buildRedeemTx([]*wire.MsgTx{f.fundingTx}, f.script, addrType, net, redeemAddr, f.resolverKey, f.preimage, 0, testFeeRate)
+		if err != nil {
+			t.Fatalf("%s: building claim failed: %v", addrType, err)
+		}
+		if err := f.verify(t, claim); err != nil {
+			t.Errorf("%s: claim does not verify: %v", addrType, err)
+		}
+
+		refund, err := buildRedeemTx([]*wire.MsgTx{f.fundingTx}, f.script, addrType, net, redeemAddr, f.userKey, nil, f.lockTime, testFeeRate)
+		if err != nil {
+			t.Fatalf("%s: building refund failed: %v", addrType, err)
+		}
+		if err := f.verify(t, refund); err != nil {
+			t.Errorf("%s: refund does not verify: %v", addrType, err)
+		}
+
+		if addrType != localcommon.HtlcP2SH {
+			if len(claim.TxIn[0].SignatureScript) != 0 || len(claim.TxIn[0].Witness) != 4 {
+				t.Errorf("expected a native witness spend, got scriptSig %x and %d witness items", claim.TxIn[0].SignatureScript, len(claim.TxIn[0].Witness))
+			}
+		}
+
+		// The resolver's key must not be able to take the refund branch.
+		stolen, err := buildRedeemTx([]*wire.MsgTx{f.fundingTx}, f.script, addrType, net, redeemAddr, f.resolverKey, nil, f.lockTime, testFeeRate)
+		if err != nil {
+			t.Fatalf("%s: building refund failed: %v", addrType, err)
+		}
+		if err := f.verify(t, stolen); err == nil {
+			t.Errorf("%s: refund signed by the wrong key verified", addrType)
+		}
+	}
+}
+
+// TestRedeemTxSweepsSplitDeposit checks that a deposit split over several
+// outputs and transactions is swept in one spend whose every input verifies.
+func TestRedeemTxSweepsSplitDeposit(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	redeemAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+	redeemPkScript := mustPayToAddrScript(redeemAddr)
+
+	for _, addrType := range []localcommon.HtlcAddressType{localcommon.HtlcP2SH, localcommon.HtlcP2WSH, localcommon.HtlcP2TR} {
+		f := newHtlcFixture(t, addrType)
+		htlcPkScript := f.fundingTx.TxOut[0].PkScript
+		second := wire.NewMsgTx(2)
+		second.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 8}, nil, nil))
+		second.AddTxOut(wire.NewTxOut(40_000, htlcPkScript))
+		second.AddTxOut(wire.NewTxOut(5_000, redeemPkScript)) // Not an HTLC output
+		second.AddTxOut(wire.NewTxOut(20_000, htlcPkScript))
+
+		// A funding tx listed twice is only swept once.
+		fundingTxs := []*wire.MsgTx{f.fundingTx, second, f.fundingTx}
+		claim, err := buildRedeemTx(fundingTxs, f.script, addrType, net, redeemAddr, f.resolverKey, f.preimage, 0, testFeeRate)
+		if err != nil {
+			t.Fatalf("%s: building claim failed: %v", addrType, err)
+		}
+		if len(claim.TxIn) != 3 {
+			t.Fatalf("%s: expected 3 inputs, got %d", addrType, len(claim.TxIn))
+		}
+
+		prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+		for _, tx := range fundingTxs[:2] {
+			for i, out := range tx.TxOut {
+				prevOuts.AddPrevOut(wire.OutPoint{Hash: tx.TxHash(), Index: uint32(i)}, out)
+			}
+		}
+		sigHashes := txscript.NewTxSigHashes(claim, prevOuts)
+		for i, in := range claim.TxIn {
+			prevOut := prevOuts.FetchPrevOutput(in.PreviousOutPoint)
+			vm, err := txscript.NewEngine(prevOut.PkScript, claim, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, prevOuts)
+			if err != nil {
+				t.Fatalf("failed to create script engine: %v", err)
+			}
+			if err := vm.Execute(); err != nil {
+				t.Errorf("%s: input %d does not verify: %v", addrType, i, err)
+			}
+		}
+
+		estimate, err := redeemVSize(f.script, addrType, len(f.preimage), redeemPkScript, 3)
+		if err != nil {
+			t.Fatalf("%s: estimating vsize failed: %v", addrType, err)
+		}
+		actual := (blockchain.GetTransactionWeight(btcutil.NewTx(claim)) + 3) / 4
+		if estimate < actual || estimate > actual+6 {
+			t.Errorf("%s: estimated %d vB for a %d vB tx", addrType, estimate, actual)
+		}
+		if want := 160_000 - int64(testFeeRate.FeeForVSize(estimate)); claim.TxOut[0].Value != want {
+			t.Errorf("%s: expected %d sat swept, got %d", addrType, want, claim.TxOut[0].Value)
+		}
+	}
+}
+
+// TestTaprootInternalKeyModes checks that both internal key modes commit to
+// spendable leaves, and that only the leaf being spent is revealed.
+func TestTaprootInternalKeyModes(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	redeemAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+
+	for _, mode := range []string{TaprootInternalKeyNUMS, TaprootInternalKeyMuSig2} {
+		f := newHtlcFixtureFor(t, &BtcHtlcService{net: net, taprootInternalKey: mode}, localcommon.HtlcP2TR)
+		htlc, err := parseTaprootHtlc(f.script)
+		if err != nil {
+			t.Fatalf("%s: parsing bundle failed: %v", mode, err)
+		}
+		if mode == TaprootInternalKeyNUMS && !htlc.internalKey.IsEqual(numsKey()) {
+			t.Errorf("expected the NUMS internal key")
+		}
+		if mode == TaprootInternalKeyMuSig2 && htlc.internalKey.IsEqual(numsKey()) {
+			t.Errorf("expected a cooperative internal key")
+		}
+
+		claim, err := buildRedeemTx([]*wire.MsgTx{f.fundingTx}, f.script, localcommon.HtlcP2TR, net, redeemAddr, f.resolverKey, f.preimage, 0, testFeeRate)
+		if err != nil {
+			t.Fatalf("%s: building claim failed: %v", mode, err)
+		}
+		if err := f.verify(t, claim); err != nil {
+			t.Errorf("%s: claim does not verify: %v", mode, err)
+		}
+		if !bytes.Equal(claim.TxIn[0].Witness[2], htlc.claimLeaf) {
+			t.Errorf("%s: claim should reveal only the claim leaf", mode)
+		}
+
+		refund, err := buildRedeemTx([]*wire.MsgTx{f.fundingTx}, f.script, localcommon.HtlcP2TR, net, redeemAddr, f.userKey, nil, f.lockTime, testFeeRate)
+		if err != nil {
+			t.Fatalf("%s: building refund failed: %v", mode, err)
+		}
+		if err := f.verify(t, refund); err != nil {
+			t.Errorf("%s: refund does not verify: %v", mode, err)
+		}
+		if len(refund.TxIn[0].Witness) != 3 || !bytes.Equal(refund.TxIn[0].Witness[1], htlc.refundLeaf) {
+			t.Errorf("%s: refund should reveal only the refund leaf", mode)
+		}
+	}
+
+	if _, err := newTaprootHtlc(&HtlcParams{SecretHash: make([]byte, 32), ClaimPubKey: make([]byte, 33), RefundPubKey: make([]byte, 20), LockTime: 1}); err == nil {
+		t.Error("expected a malformed user key to be rejected")
+	}
+}
+
+// TestRedeemTxCsvRefund checks that a CSV refund carries its delay in the
+// input sequence, for every address type.
+func TestRedeemTxCsvRefund(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	redeemAddr, _ := btcutil.DecodeAddress("bcrt1qwa29ncycnamh4mmy495zpl0vk9tgyfdxwn0ptu", net)
+
+	for _, addrType := range []localcommon.HtlcAddressType{localcommon.HtlcP2SH, localcommon.HtlcP2WSH, localcommon.HtlcP2TR} {
+		f := newHtlcFixtureWith(t, &BtcHtlcService{net: net}, addrType, localcommon.HtlcCSV, 144)
+
+		refund, err := buildRedeemTx([]*wire.MsgTx{f.fundingTx}, f.script, addrType, net, redeemAddr, f.userKey, nil, 0, testFeeRate)
+		if err != nil {
+			t.Fatalf("%s: building refund failed: %v", addrType, err)
+		}
+		if refund.TxIn[0].Sequence != 144 || refund.LockTime != 0 {
+			t.Errorf("%s: expected sequence 144 and no locktime, got %d and %d", addrType, refund.TxIn[0].Sequence, refund.LockTime)
+		}
+		if err := f.verify(t, refund); err != nil {
+			t.Errorf("%s: CSV refund does not verify: %v", addrType, err)
+		}
+
+		claim, err := buildRedeemTx([]*wire.MsgTx{f.fundingTx}, f.script, addrType, net, redeemAddr, f.resolverKey, f.preimage, 0, testFeeRate)
+		if err != nil {
+			t.Fatalf("%s: building claim failed: %v", addrType, err)
+		}
+		if err := f.verify(t, claim); err != nil {
+			t.Errorf("%s: claim does not verify: %v", addrType, err)
+		}
+	}
+
+	if _, _, err := BuildHtlc(&HtlcParams{SecretHash: make([]byte, 32), LockTime: maxCsvDelay + 1, TimelockType: localcommon.HtlcCSV}, localcommon.HtlcP2WSH, net); err == nil {
+		t.Error("expected a delay beyond BIP68's range to be rejected")
+	}
+}
+
+// TestHtlcAddressTypes checks the address encodings for each type.
+func TestHtlcAddressTypes(t *testing.T) {
+	net := &chaincfg.RegressionNetParams
+	script := []byte{txscript.OP_TRUE}
+
+	p2sh, err := HtlcAddress(script, localcommon.HtlcP2SH, net)
+	if err != nil {
+		t.Fatalf("P2SH failed: %v", err)
+	}
+	if _, ok := p2sh.(*btcutil.AddressScriptHash); !ok {
+		t.Errorf("expected a P2SH address, got %T", p2sh)
+	}
+
+	p2wsh, err := HtlcAddress(script, localcommon.HtlcP2WSH, net)
+	if err != nil {
+		t.Fatalf("P2WSH failed: %v", err)
+	}
+	if _, ok := p2wsh.(*btcutil.AddressWitnessScriptHash); !ok {
+		t.Errorf("expected a P2WSH address, got %T", p2wsh)
+	}
+
+	if _, err := HtlcAddress(script, "p2pkh", net); err == nil {
+		t.Error("expected an unknown address type to be rejected")
+	}
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// A Taproot HTLC splits the two branches of the legacy script into separate
+// tapleaves, so a spend only reveals the branch it uses:
+//
+//	claim:  OP_SHA256 <secretHash> OP_EQUALVERIFY <resolverKey> OP_CHECKSIG
+//	refund: <lockTime> OP_CHECKLOCKTIMEVERIFY OP_DROP <userKey> OP_CHECKSIG
+//
+// with OP_CHECKSEQUENCEVERIFY in the refund leaf for the CSV variant.
+//
+// The internal key is either the BIP341 NUMS point, which nobody can sign for,
+// or the MuSig2 aggregate of the user and resolver keys. The latter lets both
+// parties later agree on a cheaper, indistinguishable key-path close; until
+// then both modes are spent through the script path only.
+//
+// Where the other address types store their redeem script, a Taproot HTLC is
+// stored as a "tapscript bundle": a script of three data pushes holding the
+// x-only internal key, the claim leaf and the refund leaf.
+
+// Taproot internal key modes, selected with BTC_TAPROOT_INTERNAL_KEY.
+const (
+	TaprootInternalKeyNUMS   = "nums"   // Provably unspendable, script path only
+	TaprootInternalKeyMuSig2 = "musig2" // Cooperative user+resolver aggregate key
+)
+
+// numsKeyHex is the x coordinate of the BIP341 NUMS point H, the SHA256 of the
+// generator's uncompressed encoding, which has no known discrete logarithm.
+const numsKeyHex = "50929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0"
+
+// Leaf indices within a Taproot HTLC's script tree.
+const (
+	taprootClaimLeaf  = 0
+	taprootRefundLeaf = 1
+)
+
+// taprootHtlc is a decoded tapscript bundle.
+type taprootHtlc struct {
+	internalKey *btcec.PublicKey
+	claimLeaf   []byte
+	refundLeaf  []byte
+}
+
+// TaprootInternalKey picks the x-only internal key of a P2TR HTLC between the
+// user's refund key and the resolver's claim key for the given mode.
+func TaprootInternalKey(senderPubKey, receiverPubKey []byte, mode string) ([]byte, error) {
+	switch mode {
+	case TaprootInternalKeyNUMS, "":
+		return schnorr.SerializePubKey(numsKey()), nil
+	case TaprootInternalKeyMuSig2:
+		userKey, err := schnorr.ParsePubKey(xOnly(senderPubKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid user refund key for taproot HTLC: %v", err)
+		}
+		resolverKey, err := schnorr.ParsePubKey(xOnly(receiverPubKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolver claim key for taproot HTLC: %v", err)
+		}
+		aggKey, _, _, err := musig2.AggregateKeys([]*btcec.PublicKey{userKey, resolverKey}, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to aggregate cooperative internal key: %v", err)
+		}
+		return schnorr.SerializePubKey(aggKey.PreTweakedKey), nil
+	default:
+		return nil, fmt.Errorf("unknown BTC_TAPROOT_INTERNAL_KEY %q: expected nums or musig2", mode)
+	}
+}
+
+// newTaprootHtlc builds the claim and refund leaves for p. A nil
+// p.InternalKey means the NUMS point.
+func newTaprootHtlc(p *HtlcParams) (*taprootHtlc, error) {
+	userKey, err := schnorr.ParsePubKey(xOnly(p.RefundPubKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid user refund key for taproot HTLC: %v", err)
+	}
+	resolverKey, err := schnorr.ParsePubKey(xOnly(p.ClaimPubKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid resolver claim key for taproot HTLC: %v", err)
+	}
+	lockOp, err := p.lockOpcode()
+	if err != nil {
+		return nil, err
+	}
+	internalKey := numsKey()
+	if p.InternalKey != nil {
+		if internalKey, err = schnorr.ParsePubKey(p.InternalKey); err != nil {
+			return nil, fmt.Errorf("invalid taproot internal key: %v", err)
+		}
+	}
+
+	claimLeaf, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_SHA256).
+		AddData(p.SecretHash).
+		AddOp(txscript.OP_EQUALVERIFY).
+		AddData(schnorr.SerializePubKey(resolverKey)).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build claim leaf: %v", err)
+	}
+
+	refundLeaf, err := txscript.NewScriptBuilder().
+		AddInt64(p.LockTime).
+		AddOp(lockOp).
+		AddOp(txscript.OP_DROP).
+		AddData(schnorr.SerializePubKey(userKey)).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build refund leaf: %v", err)
+	}
+
+	return &taprootHtlc{internalKey: internalKey, claimLeaf: claimLeaf, refundLeaf: refundLeaf}, nil
+}
+
+// bundle encodes the HTLC as a tapscript bundle.
+func (h *taprootHtlc) bundle() ([]byte, error) {
+	return txscript.NewScriptBuilder().
+		AddData(schnorr.SerializePubKey(h.internalKey)).
+		AddData(h.claimLeaf).
+		AddData(h.refundLeaf).
+		Script()
+}
+
+// parseTaprootHtlc decodes a tapscript bundle.
+func parseTaprootHtlc(bundle []byte) (*taprootHtlc, error) {
+	var pushes [][]byte
+	tokenizer := txscript.MakeScriptTokenizer(0, bundle)
+	for tokenizer.Next() {
+		if tokenizer.Data() == nil {
+			return nil, fmt.Errorf("invalid tapscript bundle: unexpected opcode %d", tokenizer.Opcode())
+		}
+		pushes = append(pushes, tokenizer.Data())
+	}
+	if err := tokenizer.Err(); err != nil {
+		return nil, fmt.Errorf("invalid tapscript bundle: %v", err)
+	}
+	if len(pushes) != 3 {
+		return nil, fmt.Errorf("invalid tapscript bundle: expected 3 pushes, got %d", len(pushes))
+	}
+
+	internalKey, err := schnorr.ParsePubKey(pushes[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid tapscript bundle internal key: %v", err)
+	}
+	return &taprootHtlc{internalKey: internalKey, claimLeaf: pushes[1], refundLeaf: pushes[2]}, nil
+}
+
+func (h *taprootHtlc) tree() *txscript.IndexedTapScriptTree {
+	return txscript.AssembleTaprootScriptTree(
+		txscript.NewBaseTapLeaf(h.claimLeaf),
+		txscript.NewBaseTapLeaf(h.refundLeaf),
+	)
+}
+
+// address returns the P2TR address committing to both leaves.
+func (h *taprootHtlc) address(net *chaincfg.Params) (btcutil.Address, error) {
+	rootHash := h.tree().RootNode.TapHash()
+	outputKey := txscript.ComputeTaprootOutputKey(h.internalKey, rootHash[:])
+	addr, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), net)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create P2TR address: %v", err)
+	}
+	return addr, nil
+}
+
+// signScriptPath signs input idx of tx through the claim or refund leaf and
+// sets its witness: the Schnorr signature, the preimage for a claim, the
+// leaf script and its control block.
+func (h *taprootHtlc) signScriptPath(tx *wire.MsgTx, idx int, sigHashes *txscript.TxSigHashes, pkScript []byte, value int64, key *btcec.PrivateKey, preimage []byte) error {
+	leafIndex, leafScript := taprootRefundLeaf, h.refundLeaf
+	if len(preimage) > 0 {
+		leafIndex, leafScript = taprootClaimLeaf, h.claimLeaf
+	}
+
+	tree := h.tree()
+	ctrl := tree.LeafMerkleProofs[leafIndex].ToControlBlock(h.internalKey)
+	controlBlock, err := ctrl.ToBytes()
+	if err != nil {
+		return fmt.Errorf("failed to build control block: %v", err)
+	}
+
+	sig, err := txscript.RawTxInTapscriptSignature(tx, sigHashes, idx, value, pkScript, txscript.NewBaseTapLeaf(leafScript), txscript.SigHashDefault, key)
+	if err != nil {
+		return fmt.Errorf("failed to sign taproot redemption tx: %v", err)
+	}
+
+	if len(preimage) > 0 {
+		tx.TxIn[idx].Witness = wire.TxWitness{sig, preimage, leafScript, controlBlock}
+	} else {
+		tx.TxIn[idx].Witness = wire.TxWitness{sig, leafScript, controlBlock}
+	}
+	return nil
+}
+
+// numsKey returns the BIP341 NUMS point.
+func numsKey() *btcec.PublicKey {
+	raw, _ := hex.DecodeString(numsKeyHex)
+	key, err := schnorr.ParsePubKey(raw)
+	if err != nil {
+		panic(fmt.Sprintf("invalid NUMS key: %v", err))
+	}
+	return key
+}
+
+// xOnly accepts either a 33-byte compressed or a 32-byte x-only public key
+// and returns the x-only form.
+func xOnly(pubKey []byte) []byte {
+	if len(pubKey) == 33 {
+		return pubKey[1:]
+	}
+	return pubKey
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/term"
+
+	"fusion-btc-resolver/config"
+)
+
+// The vault keeps every long-lived secret of the resolver in one file at
+// VAULT_PATH, encrypted like the secret seed under a passphrase read from
+// VAULT_PASSPHRASE_FILE or prompted for at startup:
+//
+//   - the EVM key, replacing EVM_PRIVATE_KEY,
+//   - the BTC claim key or claim seed, replacing BTC_CLAIM_KEY/BTC_CLAIM_SEED,
+//   - the esplora wallet key, replacing BTC_WALLET_KEY,
+//   - the seed swap secrets are derived from, replacing SECRET_SEED_PATH.
+//
+// On first start the vault is created from whatever of those is configured,
+// after which the plaintext settings should be removed. Once the services
+// hold their parsed keys, Wipe zeroes the raw key material.
+
+// vaultKeys is the decrypted content of a vault file. Keys are raw bytes.
+type vaultKeys struct {
+	EvmPrivateKey []byte `json:"evmPrivateKey"`
+	BtcClaimKey   []byte `json:"btcClaimKey,omitempty"`
+	BtcClaimSeed  []byte `json:"btcClaimSeed,omitempty"`
+	BtcWalletKey  []byte `json:"btcWalletKey,omitempty"`
+	SecretSeed    []byte `json:"secretSeed"`
+}
+
+// wipe zeroes every key.
+func (k *vaultKeys) wipe() {
+	clear(k.EvmPrivateKey)
+	clear(k.BtcClaimKey)
+	clear(k.BtcClaimSeed)
+	clear(k.BtcWalletKey)
+	clear(k.SecretSeed)
+}
+
+// Vault holds the resolver's unlocked key material until it is wiped.
+type Vault struct {
+	keys          vaultKeys
+	seedGenerated bool // The secret seed was generated when the vault was created
+}
+
+// ReadVaultPassphrase reads the vault passphrase from the first line of
+// passphraseFile or, when that is empty, prompts for it on the terminal
+// without echoing it.
+func ReadVaultPassphrase(passphraseFile string) (string, error) {
+	var passphrase string
+	if passphraseFile != "" {
+		f, err := os.Open(passphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read VAULT_PASSPHRASE_FILE: %v", err)
+		}
+		defer f.Close()
+		line, err := bufio.NewReader(f).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read vault passphrase: %v", err)
+		}
+		passphrase = strings.TrimRight(line, "\r\n")
+	} else {
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return "", fmt.Errorf("VAULT_PASSPHRASE_FILE is required when stdin is not a terminal")
+		}
+		fmt.Fprint(os.Stderr, "Vault passphrase: ")
+		line, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read vault passphrase: %v", err)
+		}
+		defer clear(line)
+		passphrase = string(line)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("the vault passphrase is empty")
+	}
+	return passphrase, nil
+}
+
+// OpenVault decrypts the vault at path with passphrase. If there is no file at
+// path, a vault is created there from the keys configured in cfg, and a fresh
+// secret seed unless cfg names an existing one.
+func OpenVault(path, passphrase string, cfg *config.Config) (*Vault, error) {
+	sealed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createVault(path, passphrase, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %v", err)
+	}
+	plaintext, err := openWithPassphrase(sealed, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock vault %s: %v", path, err)
+	}
+	defer clear(plaintext)
+
+	v := &Vault{}
+	if err := json.Unmarshal(plaintext, &v.keys); err != nil {
+		return nil, fmt.Errorf("malformed vault %s: %v", path, err)
+	}
+	return v, nil
+}
+
+// createVault imports the keys configured in cfg into a new vault at path.
+func createVault(path, passphrase string, cfg *config.Config) (*Vault, error) {
+	net, err := NetParamsForNetwork(cfg.Bitcoin.Network)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vault{}
+	ok := false
+	defer func() {
+		if !ok {
+			v.Wipe()
+		}
+	}()
+
+	evmKey, err := ParseEvmKey(cfg.EVM.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	v.keys.EvmPrivateKey = crypto.FromECDSA(evmKey)
+
+	if cfg.Bitcoin.ClaimKey != "" {
+		wif, err := decodeClaimKey(cfg.Bitcoin.ClaimKey, net)
+		if err != nil {
+			return nil, err
+		}
+		v.keys.BtcClaimKey = wif.PrivKey.Serialize()
+	}
+	if cfg.Bitcoin.ClaimSeed != "" {
+		if v.keys.BtcClaimSeed, err = hex.DecodeString(cfg.Bitcoin.ClaimSeed); err != nil {
+			return nil, fmt.Errorf("BTC_CLAIM_SEED must be hex: %v", err)
+		}
+	}
+	if cfg.Bitcoin.WalletKey != "" {
+		wif, err := btcutil.DecodeWIF(cfg.Bitcoin.WalletKey)
+		if err != nil {
+			return nil, fmt.Errorf("BTC_WALLET_KEY: %v", err)
+		}
+		v.keys.BtcWalletKey = wif.PrivKey.Serialize()
+	}
+	// Check the claim keys the same way they will be loaded.
+	if _, err := v.ClaimKeyring(net); err != nil {
+		return nil, err
+	}
+
+	// Swaps started before the vault have secrets derived from the seed
+	// file, which must carry over for them to stay recoverable.
+	if _, err := os.Stat(cfg.Secrets.SeedPath); err == nil {
+		seed, err := LoadSecretSeed(cfg.Secrets.SeedPath, cfg.Secrets.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import the existing secret seed: %v", err)
+		}
+		v.keys.SecretSeed = append([]byte(nil), seed.seed...)
+	} else {
+		v.keys.SecretSeed = make([]byte, secretSeedLen)
+		if _, err := rand.Read(v.keys.SecretSeed); err != nil {
+			return nil, fmt.Errorf("failed to generate secret seed: %v", err)
+		}
+		v.seedGenerated = true
+	}
+
+	plaintext, err := json.Marshal(&v.keys)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(plaintext)
+	sealed, err := sealWithPassphrase(plaintext, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create vault directory: %v", err)
+	}
+	if err := writeNewFile(path, sealed); err != nil {
+		return nil, fmt.Errorf("failed to create vault: %v", err)
+	}
+	ok = true
+	return v, nil
+}
+
+// EvmKey returns the resolver's EVM signing key.
+func (v *Vault) EvmKey() (*ecdsa.PrivateKey, error) {
+	key, err := crypto.ToECDSA(v.keys.EvmPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("vault EVM key: %v", err)
+	}
+	return key, nil
+}
+
+// BtcWalletKey returns the esplora wallet key, or nil if the vault has none.
+func (v *Vault) BtcWalletKey() *btcec.PrivateKey {
+	if len(v.keys.BtcWalletKey) == 0 {
+		return nil
+	}
+	key, _ := btcec.PrivKeyFromBytes(v.keys.BtcWalletKey)
+	return key
+}
+
+// ClaimKeyring returns the resolver's HTLC claim keys on net.
+func (v *Vault) ClaimKeyring(net *chaincfg.Params) (*ClaimKeyring, error) {
+	switch {
+	case len(v.keys.BtcClaimKey) > 0 && len(v.keys.BtcClaimSeed) > 0:
+		return nil, fmt.Errorf("the vault holds both a claim key and a claim seed")
+	case len(v.keys.BtcClaimKey) > 0:
+		key, _ := btcec.PrivKeyFromBytes(v.keys.BtcClaimKey)
+		return &ClaimKeyring{fixed: key}, nil
+	case len(v.keys.BtcClaimSeed) > 0:
+		return newSeedClaimKeyring(v.keys.BtcClaimSeed, net)
+	default:
+		return nil, fmt.Errorf("the vault holds no BTC claim key or claim seed")
+	}
+}
+
+// SecretSeed returns the seed swap secrets are derived from.
+func (v *Vault) SecretSeed() (*SecretSeed, error) {
+	s, err := NewSecretSeed(v.keys.SecretSeed)
+	if err != nil {
+		return nil, err
+	}
+	s.generated = v.seedGenerated
+	return s, nil
+}
+
+// Wipe zeroes the vault's key material. Keys already handed out are not
+// affected.
+func (v *Vault) Wipe() {
+	v.keys.wipe()
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"fusion-btc-resolver/config"
+)
+
+// TestVaultImportsConfiguredKeys creates a vault from plaintext settings and
+// an existing secret seed, and checks that it unlocks to the same keys.
+func TestVaultImportsConfiguredKeys(t *testing.T) {
+	dir := t.TempDir()
+	net := &chaincfg.RegressionNetParams
+	evmKey, _ := crypto.GenerateKey()
+	walletKey, _ := btcec.NewPrivateKey()
+	wif, _ := btcutil.NewWIF(walletKey, net, true)
+	seedPath := filepath.Join(dir, "secret_seed.json")
+	seed, err := LoadSecretSeed(seedPath, "seed passphrase")
+	if err != nil {
+		t.Fatalf("LoadSecretSeed failed: %v", err)
+	}
+
+	cfg := &config.Config{
+		Bitcoin: config.BtcConfig{Network: "regtest", ClaimSeed: "000102030405060708090a0b0c0d0e0f", WalletKey: wif.String()},
+		EVM:     config.EvmConfig{PrivateKey: "0x" + hex.EncodeToString(crypto.FromECDSA(evmKey))},
+		Secrets: config.SecretConfig{SeedPath: seedPath, Passphrase: "seed passphrase"},
+	}
+	path := filepath.Join(dir, "vault", "vault.json")
+	if _, err := OpenVault(path, "vault passphrase", cfg); err != nil {
+		t.Fatalf("OpenVault failed to create the vault: %v", err)
+	}
+	sealed, _ := os.ReadFile(path)
+	if bytes.Contains(sealed, []byte(wif.String())) || bytes.Contains(sealed, []byte(cfg.EVM.PrivateKey[2:])) {
+		t.Fatal("vault holds keys in the clear")
+	}
+
+	// Later starts need nothing but the vault and its passphrase.
+	v, err := OpenVault(path, "vault passphrase", &config.Config{})
+	if err != nil {
+		t.Fatalf("OpenVault failed to unlock the vault: %v", err)
+	}
+	gotEvm, err := v.EvmKey()
+	if err != nil || crypto.PubkeyToAddress(gotEvm.PublicKey) != crypto.PubkeyToAddress(evmKey.PublicKey) {
+		t.Errorf("expected the imported EVM key, got %v", err)
+	}
+	if got := v.BtcWalletKey(); got == nil || !got.Key.Equals(&walletKey.Key) {
+		t.Error("expected the imported wallet key")
+	}
+	claimKeys, err := v.ClaimKeyring(net)
+	if err != nil {
+		t.Fatalf("ClaimKeyring failed: %v", err)
+	}
+	configured, _ := NewClaimKeyring(&cfg.Bitcoin, net)
+	_, want, _ := configured.NewClaimKey(3)
+	if _, got, _ := claimKeys.NewClaimKey(3); !bytes.Equal(got, want) {
+		t.Error("expected the imported claim seed")
+	}
+	secrets, err := v.SecretSeed()
+	if err != nil || !bytes.Equal(secrets.Secret(9), seed.Secret(9)) {
+		t.Errorf("expected the imported secret seed, got %v", err)
+	}
+
+	v.Wipe()
+	if !bytes.Equal(v.keys.SecretSeed, make([]byte, len(v.keys.SecretSeed))) || !bytes.Equal(v.keys.EvmPrivateKey, make([]byte, len(v.keys.EvmPrivateKey))) {
+		t.Error("expected Wipe to zero the key material")
+	}
+	if !bytes.Equal(secrets.Secret(9), seed.Secret(9)) {
+		t.Error("expected keys handed out before Wipe to keep working")
+	}
+	if _, err := OpenVault(path, "wrong passphrase", &config.Config{}); err == nil {
+		t.Error("expected a wrong passphrase to be rejected")
+	}
+}
+
+// TestReadVaultPassphraseFromFile checks that only the first line of the
+// passphrase file is used.
+func TestReadVaultPassphraseFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	os.WriteFile(path, []byte("vault passphrase\r\nignored\n"), 0o600)
+	if got, err := ReadVaultPassphrase(path); err != nil || got != "vault passphrase" {
+		t.Errorf("expected the first line, got %q %v", got, err)
+	}
+	os.WriteFile(path, []byte("\n"), 0o600)
+	if _, err := ReadVaultPassphrase(path); err == nil {
+		t.Error("expected an empty passphrase to be rejected")
+	}
+}
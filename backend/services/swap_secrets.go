@@ -0,0 +1,245 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Every swap secret is HMAC-SHA256(seed, "swap-secret" || index) for the
+// swap's key index, the same index its claim key is derived at. The seed is
+// generated on first start and kept in a file encrypted under
+// SECRET_SEED_PASSPHRASE, so backing up that file once is enough to claim any
+// swap the resolver ever started: RecoverSecrets finds the secret of each
+// known secret hash by deriving indexes in order.
+//
+// Secrets repeat if key indexes do. The swap store records the ID of the seed
+// its indexes were handed out under, so the resolver refuses to start with a
+// used seed and a store that does not know it, for example after losing the
+// store. Recovery then rebuilds the store's swaps from the seed.
+
+// secretSeedLen is the length of a generated master seed.
+const secretSeedLen = 32
+
+// secretDomain separates swap secrets from anything else derived from the seed.
+var secretDomain = []byte("swap-secret")
+
+// SecretSeed is the master seed every swap secret is derived from.
+type SecretSeed struct {
+	seed      []byte
+	generated bool // Created by this process, so it cannot have derived any secret yet
+}
+
+// RecoveredSecret is a swap secret regenerated by RecoverSecrets.
+type RecoveredSecret struct {
+	Index  uint32
+	Secret []byte
+}
+
+// NewSecretSeed wraps a master seed of at least 32 bytes.
+func NewSecretSeed(seed []byte) (*SecretSeed, error) {
+	if len(seed) < secretSeedLen {
+		return nil, fmt.Errorf("secret seed must be at least %d bytes, got %d", secretSeedLen, len(seed))
+	}
+	return &SecretSeed{seed: append([]byte(nil), seed...)}, nil
+}
+
+// LoadSecretSeed decrypts the master seed at path with passphrase. If there is
+// no file at path, a fresh seed is generated and written there encrypted.
+func LoadSecretSeed(path, passphrase string) (*SecretSeed, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("SECRET_SEED_PASSPHRASE is required to protect the secret seed")
+	}
+	sealed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createSecretSeed(path, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret seed: %v", err)
+	}
+	seed, err := openWithPassphrase(sealed, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret seed %s: %v", path, err)
+	}
+	defer clear(seed)
+	return NewSecretSeed(seed)
+}
+
+// createSecretSeed generates a master seed and writes it to path, failing
+// rather than replacing a file that appeared in the meantime.
+func createSecretSeed(path, passphrase string) (*SecretSeed, error) {
+	seed := make([]byte, secretSeedLen)
+	defer clear(seed)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, fmt.Errorf("failed to generate secret seed: %v", err)
+	}
+	sealed, err := sealWithPassphrase(seed, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create secret seed directory: %v", err)
+	}
+	if err := writeNewFile(path, sealed); err != nil {
+		return nil, fmt.Errorf("failed to create secret seed: %v", err)
+	}
+	s, err := NewSecretSeed(seed)
+	if err != nil {
+		return nil, err
+	}
+	s.generated = true
+	return s, nil
+}
+
+// Generated reports whether the seed was created by this process, and so has
+// never derived a secret before.
+func (s *SecretSeed) Generated() bool {
+	return s.generated
+}
+
+// ID identifies the seed without revealing it.
+func (s *SecretSeed) ID() []byte {
+	mac := hmac.New(sha256.New, s.seed)
+	mac.Write([]byte("seed-id"))
+	return mac.Sum(nil)[:8]
+}
+
+// Secret derives the 32-byte secret of the swap with the given key index.
+func (s *SecretSeed) Secret(index uint32) []byte {
+	mac := hmac.New(sha256.New, s.seed)
+	mac.Write(secretDomain)
+	binary.Write(mac, binary.BigEndian, index)
+	return mac.Sum(nil)
+}
+
+// StoreKey derives the key the swap store encrypts persisted secrets with.
+func (s *SecretSeed) StoreKey() []byte {
+	mac := hmac.New(sha256.New, s.seed)
+	mac.Write([]byte("swap-store"))
+	return mac.Sum(nil)
+}
+
+// RecoverSecrets regenerates the secrets of the given secret hashes by
+// deriving the secrets of key indexes [0, indexes). Hashes whose secret is not
+// found, such as those of swaps predating the seed, are left out.
+func (s *SecretSeed) RecoverSecrets(hashes [][32]byte, indexes uint32) map[[32]byte]RecoveredSecret {
+	wanted := make(map[[32]byte]bool, len(hashes))
+	for _, hash := range hashes {
+		wanted[hash] = true
+	}
+	recovered := make(map[[32]byte]RecoveredSecret, len(wanted))
+	for index := uint32(0); index < indexes && len(recovered) < len(wanted); index++ {
+		secret := s.Secret(index)
+		if hash := sha256.Sum256(secret); wanted[hash] {
+			recovered[hash] = RecoveredSecret{Index: index, Secret: secret}
+		}
+	}
+	return recovered
+}
+
+// writeNewFile durably writes data to a new file at path, readable only by
+// the resolver, failing rather than replacing an existing file.
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sealedFile is the on-disk form of data encrypted by sealWithPassphrase: an
+// AES-256-GCM ciphertext under a key stretched from the passphrase by scrypt.
+type sealedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// scrypt parameters for newly sealed files. Opening uses the file's own,
+// which must be at least as strong, so that whoever can write the file cannot
+// weaken the key stretching it is opened with.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// sealWithPassphrase encrypts plaintext under passphrase.
+func sealWithPassphrase(plaintext []byte, passphrase string) ([]byte, error) {
+	file := sealedFile{Version: 1, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %v", err)
+	}
+	aead, err := file.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	file.Ciphertext = aead.Seal(nil, file.Nonce, plaintext, nil)
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// openWithPassphrase decrypts data sealed by sealWithPassphrase.
+func openWithPassphrase(sealed []byte, passphrase string) ([]byte, error) {
+	var file sealedFile
+	if err := json.Unmarshal(sealed, &file); err != nil {
+		return nil, fmt.Errorf("malformed sealed file: %v", err)
+	}
+	if file.Version != 1 || file.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported sealed file version %d with kdf %q", file.Version, file.KDF)
+	}
+	if file.N < scryptN || file.R < scryptR || file.P < scryptP {
+		return nil, fmt.Errorf("sealed file scrypt parameters N=%d r=%d p=%d are below the minimum N=%d r=%d p=%d", file.N, file.R, file.P, scryptN, scryptR, scryptP)
+	}
+	aead, err := file.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("malformed sealed file: bad nonce length %d", len(file.Nonce))
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted file")
+	}
+	return plaintext, nil
+}
+
+// aead derives the file's cipher from passphrase.
+func (f *sealedFile) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), f.Salt, f.N, f.R, f.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadSecretSeedPersistsEncrypted checks that the seed generated on first
+// start is reloaded unchanged, and only with the right passphrase.
+func TestLoadSecretSeedPersistsEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "secret_seed.json")
+	created, err := LoadSecretSeed(path, "correct horse")
+	if err != nil {
+		t.Fatalf("LoadSecretSeed failed to create a seed: %v", err)
+	}
+	loaded, err := LoadSecretSeed(path, "correct horse")
+	if err != nil {
+		t.Fatalf("LoadSecretSeed failed to reload the seed: %v", err)
+	}
+	if !bytes.Equal(created.Secret(7), loaded.Secret(7)) || !bytes.Equal(created.ID(), loaded.ID()) {
+		t.Error("expected the reloaded seed to derive the same secrets")
+	}
+	if !created.Generated() || loaded.Generated() {
+		t.Error("expected only the first load to generate the seed")
+	}
+	if _, err := LoadSecretSeed(path, "wrong horse"); err == nil {
+		t.Error("expected a wrong passphrase to be rejected")
+	}
+	if _, err := LoadSecretSeed(path, ""); err == nil {
+		t.Error("expected an empty passphrase to be rejected")
+	}
+}
+
+// TestOpenWithPassphraseRejectsWeakScrypt checks that a sealed file cannot
+// lower the scrypt parameters it is opened with.
+func TestOpenWithPassphraseRejectsWeakScrypt(t *testing.T) {
+	sealed, err := sealWithPassphrase([]byte("secret"), "correct horse")
+	if err != nil {
+		t.Fatalf("sealWithPassphrase failed: %v", err)
+	}
+	if _, err := openWithPassphrase(sealed, "correct horse"); err != nil {
+		t.Fatalf("openWithPassphrase failed: %v", err)
+	}
+
+	weak := sealedFile{Version: 1, KDF: "scrypt", N: 1 << 10, R: 8, P: 1, Salt: make([]byte, 16)}
+	aead, err := weak.aead("correct horse")
+	if err != nil {
+		t.Fatalf("failed to derive key: %v", err)
+	}
+	weak.Nonce = make([]byte, aead.NonceSize())
+	weak.Ciphertext = aead.Seal(nil, weak.Nonce, []byte("secret"), nil)
+	forged, err := json.Marshal(weak)
+	if err != nil {
+		t.Fatalf("failed to encode sealed file: %v", err)
+	}
+	if _, err := openWithPassphrase(forged, "correct horse"); err == nil {
+		t.Error("expected a file with a weak scrypt N to be rejected")
+	}
+}
+
+// TestRecoverSecrets checks that secrets are derived per index and can be
+// regenerated from their hashes alone.
+func TestRecoverSecrets(t *testing.T) {
+	seed, err := NewSecretSeed(bytes.Repeat([]byte{0x5e}, 32))
+	if err != nil {
+		t.Fatalf("NewSecretSeed failed: %v", err)
+	}
+	if bytes.Equal(seed.Secret(0), seed.Secret(1)) {
+		t.Fatal("expected each index to get its own secret")
+	}
+	if _, err := NewSecretSeed(make([]byte, 16)); err == nil {
+		t.Error("expected a short seed to be rejected")
+	}
+
+	unknown := sha256.Sum256([]byte("not derived"))
+	hashes := [][32]byte{sha256.Sum256(seed.Secret(3)), sha256.Sum256(seed.Secret(41)), unknown}
+	recovered := seed.RecoverSecrets(hashes, 100)
+	if len(recovered) != 2 {
+		t.Fatalf("expected two recovered secrets, got %d", len(recovered))
+	}
+	for i, index := range []uint32{3, 41} {
+		got := recovered[hashes[i]]
+		if got.Index != index || !bytes.Equal(got.Secret, seed.Secret(index)) {
+			t.Errorf("expected the secret at index %d, got index %d", index, got.Index)
+		}
+	}
+	if len(seed.RecoverSecrets(hashes, 10)) != 1 {
+		t.Error("expected indexes past the limit not to be searched")
+	}
+}
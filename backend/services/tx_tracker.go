@@ -0,0 +1,398 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Every BTC transaction the resolver broadcasts is handed to a TxTracker,
+// which watches it until it confirms. A transaction still unconfirmed
+// BTC_BUMP_AFTER_BLOCKS blocks after it was (re)broadcast has its fee bumped,
+// in whichever way is open for that kind of transaction:
+//
+//   - HTLC redeems are signed by the resolver, so they are rebuilt at a higher
+//     fee rate and replaced under BIP125 (RBF).
+//   - Wallet payouts are replaced with the node's bumpfee. If the wallet
+//     refuses, e.g. because the tx does not signal RBF, a child spending its
+//     change output pays for the parent (CPFP).
+//   - Transactions signed by someone else, like a user's refund, pay nothing
+//     to the resolver's wallet, so there is no output for a CPFP child to
+//     spend. They are only rebroadcast if the node drops them; bumping them
+//     is up to their signer.
+//
+// Transactions are tracked in memory only. After a restart, swaps still
+// waiting for their payout to confirm hand it back through TrackPayout, and a
+// pending refund is rebroadcast by the orchestrator's refund loop.
+
+// txKind selects how a tracked transaction can be bumped, if at all.
+type txKind int
+
+const (
+	txRedeem   txKind = iota // Signed by us, e.g. an HTLC redeem: re-signed at a higher fee
+	txWallet                 // Funded by the node's wallet: bumpfee, then CPFP
+	txExternal               // Signed by someone else: rebroadcast only
+)
+
+// trackedTx is a broadcast transaction waiting for its first confirmation.
+type trackedTx struct {
+	hash    chainhash.Hash
+	label   string
+	kind    txKind
+	raw     *wire.MsgTx                        // For rebroadcasting if the node drops it; nil for wallet txs
+	feeRate FeeRate                            // The rate it was last broadcast at
+	rebuild func(FeeRate) (*wire.MsgTx, error) // Re-signs the tx at a new rate, txRedeem only
+	height  int64                              // Tip when last (re)broadcast, 0 until first checked
+	bumps   int
+}
+
+// bumpBackend is what a TxTracker needs from the node.
+type bumpBackend interface {
+	CurrentHeight(ctx context.Context) (int64, error)
+	GetConfirmations(ctx context.Context, txHash *chainhash.Hash) (int64, error)
+	sendRawTx(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error)
+	estimateFeeRate(ctx context.Context) FeeRate
+	bumpWalletFee(ctx context.Context, txHash *chainhash.Hash, rate FeeRate) (*chainhash.Hash, error)
+	payForParent(ctx context.Context, parent *chainhash.Hash, rate FeeRate) (*chainhash.Hash, error)
+}
+
+// TxTracker watches broadcast transactions and bumps the fees of stuck ones.
+type TxTracker struct {
+	backend   bumpBackend
+	bumpAfter int64
+	maxRate   FeeRate
+
+	mu         sync.Mutex
+	txs        map[chainhash.Hash]*trackedTx
+	onReplaced func(oldHash, newHash chainhash.Hash)
+}
+
+func newTxTracker(backend bumpBackend, bumpAfter int64, maxRate FeeRate) *TxTracker {
+	return &TxTracker{
+		backend:   backend,
+		bumpAfter: bumpAfter,
+		maxRate:   maxRate,
+		txs:       make(map[chainhash.Hash]*trackedTx),
+	}
+}
+
+// SetReplacedHandler registers fn to be called whenever a tracked transaction
+// is replaced by RBF, so records holding the old txid can be updated.
+func (t *TxTracker) SetReplacedHandler(fn func(oldHash, newHash chainhash.Hash)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onReplaced = fn
+}
+
+func (t *TxTracker) track(tx *trackedTx) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.txs[tx.hash] = tx
+	log.Printf("[TX_TRACKER] Tracking %s %s until it confirms", tx.label, tx.hash)
+}
+
+// tracking reports whether a transaction is already tracked under hash.
+func (t *TxTracker) tracking(hash chainhash.Hash) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.txs[hash]
+	return ok
+}
+
+// Run checks the tracked transactions every interval until ctx is cancelled.
+func (t *TxTracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.checkAll(ctx)
+		}
+	}
+}
+
+// checkAll makes one pass over the tracked transactions.
+func (t *TxTracker) checkAll(ctx context.Context) {
+	t.mu.Lock()
+	pending := make([]*trackedTx, 0, len(t.txs))
+	for _, tx := range t.txs {
+		pending = append(pending, tx)
+	}
+	t.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	height, err := t.backend.CurrentHeight(ctx)
+	if err != nil {
+		log.Printf("[TX_TRACKER] ERROR: %v", err)
+		return
+	}
+	for _, tx := range pending {
+		t.check(ctx, tx, height)
+	}
+}
+
+func (t *TxTracker) check(ctx context.Context, tx *trackedTx, height int64) {
+	confirmations, err := t.backend.GetConfirmations(ctx, &tx.hash)
+	if err != nil {
+		// The node dropped it, e.g. on mempool eviction. Wallet txs are
+		// rebroadcast by the wallet; anything else is rebroadcast here.
+		if tx.raw != nil {
+			if _, err := t.backend.sendRawTx(ctx, tx.raw); err != nil {
+				log.Printf("[TX_TRACKER] ERROR: Rebroadcasting %s %s failed: %v", tx.label, tx.hash, err)
+			}
+		}
+		return
+	}
+	if confirmations > 0 {
+		t.mu.Lock()
+		delete(t.txs, tx.hash)
+		t.mu.Unlock()
+		log.Printf("[TX_TRACKER] %s %s confirmed after %d fee bumps", tx.label, tx.hash, tx.bumps)
+		return
+	}
+
+	if tx.height == 0 {
+		tx.height = height
+		return
+	}
+	if tx.kind == txExternal {
+		return
+	}
+	if height-tx.height < t.bumpAfter {
+		return
+	}
+
+	rate, ok := nextFeeRate(tx.feeRate, t.backend.estimateFeeRate(ctx), t.maxRate)
+	if !ok {
+		log.Printf("[TX_TRACKER] WARN: %s %s is stuck at the %s ceiling", tx.label, tx.hash, t.maxRate)
+		return
+	}
+	if err := t.bump(ctx, tx, rate); err != nil {
+		log.Printf("[TX_TRACKER] ERROR: Could not bump %s %s to %s: %v", tx.label, tx.hash, rate, err)
+		return
+	}
+	tx.height = height
+	tx.feeRate = rate
+	tx.bumps++
+}
+
+// bump raises the fee of tx to rate, replacing it if its kind allows.
+func (t *TxTracker) bump(ctx context.Context, tx *trackedTx, rate FeeRate) error {
+	switch tx.kind {
+	case txRedeem:
+		replacement, err := tx.rebuild(rate)
+		if err != nil {
+			return err
+		}
+		newHash, err := t.backend.sendRawTx(ctx, replacement)
+		if err != nil {
+			return err
+		}
+		tx.raw = replacement
+		t.replace(tx, *newHash)
+		return nil
+
+	case txWallet:
+		newHash, err := t.backend.bumpWalletFee(ctx, &tx.hash, rate)
+		if err == nil {
+			t.replace(tx, *newHash)
+			return nil
+		}
+		log.Printf("[TX_TRACKER] bumpfee on %s failed, trying CPFP: %v", tx.hash, err)
+	}
+
+	child, err := t.backend.payForParent(ctx, &tx.hash, rate)
+	if err != nil {
+		return err
+	}
+	log.Printf("[TX_TRACKER] Child %s pays for %s %s at %s", child, tx.label, tx.hash, rate)
+	return nil
+}
+
+// replace re-keys tx under its replacement's hash and reports the change.
+func (t *TxTracker) replace(tx *trackedTx, newHash chainhash.Hash) {
+	t.mu.Lock()
+	oldHash := tx.hash
+	delete(t.txs, oldHash)
+	tx.hash = newHash
+	t.txs[newHash] = tx
+	onReplaced := t.onReplaced
+	t.mu.Unlock()
+
+	log.Printf("[TX_TRACKER] Replaced %s %s with %s", tx.label, oldHash, newHash)
+	if onReplaced != nil {
+		onReplaced(oldHash, newHash)
+	}
+}
+
+// nextFeeRate picks the rate for a bump: the current estimate, but at least
+// 25% and 1 sat/vB above the previous rate, so BIP125's incremental relay fee
+// rule is met. It reports false if the ceiling leaves no room to bump.
+func nextFeeRate(prev, estimate, ceiling FeeRate) (FeeRate, bool) {
+	rate := prev + prev/4
+	if minimum := prev + FeeRatePerVByte(1); rate < minimum {
+		rate = minimum
+	}
+	if estimate > rate {
+		rate = estimate
+	}
+	if rate > ceiling {
+		rate = ceiling
+	}
+	return rate, rate > prev
+}
+
+// sendRawTx broadcasts tx without tracking it.
+func (s *BtcHtlcService) sendRawTx(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error) {
+	txHash, err := withContext(ctx, func() (*chainhash.Hash, error) {
+		return s.client.SendRawTransaction(tx, false)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to broadcast tx %s: %v", tx.TxHash(), err)
+	}
+	return txHash, nil
+}
+
+// bumpWalletFee replaces a wallet transaction with the node's bumpfee.
+func (s *BtcHtlcService) bumpWalletFee(ctx context.Context, txHash *chainhash.Hash, rate FeeRate) (*chainhash.Hash, error) {
+	params, err := marshalParams(txHash.String(), map[string]float64{"fee_rate": float64(rate) / 1000})
+	if err != nil {
+		return nil, err
+	}
+	raw, err := withContext(ctx, func() (json.RawMessage, error) {
+		return s.client.RawRequest("bumpfee", params)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bumpfee failed: %v", err)
+	}
+
+	var result struct {
+		TxID string `json:"txid"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("unexpected bumpfee result: %v", err)
+	}
+	return chainhash.NewHashFromStr(result.TxID)
+}
+
+// payForParent spends the wallet's output of an unconfirmed parent to a new
+// change address, with a fee that brings the parent and child package up to
+// rate.
+func (s *BtcHtlcService) payForParent(ctx context.Context, parent *chainhash.Hash, rate FeeRate) (*chainhash.Hash, error) {
+	entry, err := withContext(ctx, func() (*btcjson.GetMempoolEntryResult, error) {
+		return s.client.GetMempoolEntry(parent.String())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parent is not in the mempool: %v", err)
+	}
+	parentFee, err := btcutil.NewAmount(entry.Fees.Base)
+	if err != nil {
+		return nil, err
+	}
+
+	unspent, err := withContext(ctx, func() ([]btcjson.ListUnspentResult, error) {
+		return s.client.ListUnspentMinMax(0, 0)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wallet outputs: %v", err)
+	}
+	var utxo *btcjson.ListUnspentResult
+	for i := range unspent {
+		if unspent[i].TxID == parent.String() && unspent[i].Spendable {
+			utxo = &unspent[i]
+			break
+		}
+	}
+	if utxo == nil {
+		return nil, fmt.Errorf("no output of %s belongs to the wallet", parent)
+	}
+	value, err := btcutil.NewAmount(utxo.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	changeRaw, err := withContext(ctx, func() (json.RawMessage, error) {
+		return s.client.RawRequest("getrawchangeaddress", nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a change address: %v", err)
+	}
+	var changeStr string
+	if err := json.Unmarshal(changeRaw, &changeStr); err != nil {
+		return nil, fmt.Errorf("unexpected getrawchangeaddress result: %v", err)
+	}
+	changeAddr, err := DecodeAddressForNet(changeStr, s.net)
+	if err != nil {
+		return nil, err
+	}
+
+	child := wire.NewMsgTx(2)
+	child.AddTxIn(wire.NewTxIn(wire.NewOutPoint(parent, utxo.Vout), nil, nil))
+	child.AddTxOut(wire.NewTxOut(int64(value), mustPayToAddrScript(changeAddr)))
+
+	// Sign once to learn the child's size, then again with the final fee.
+	signed, _, err := withContext2(ctx, func() (*wire.MsgTx, bool, error) {
+		return s.client.SignRawTransactionWithWallet(child)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign CPFP child: %v", err)
+	}
+	childVSize := mempool.GetTxVirtualSize(btcutil.NewTx(signed))
+	fee := rate.FeeForVSize(int64(entry.VSize)+childVSize) - parentFee
+	if minFee := rate.FeeForVSize(childVSize); fee < minFee {
+		fee = minFee
+	}
+	child.TxOut[0].Value = int64(value - fee)
+	if value <= fee || mempool.IsDust(child.TxOut[0], mempool.DefaultMinRelayTxFee) {
+		return nil, fmt.Errorf("%w: wallet output of %s cannot pay a %s CPFP fee", ErrDustOutput, value, fee)
+	}
+
+	signed, complete, err := withContext2(ctx, func() (*wire.MsgTx, bool, error) {
+		return s.client.SignRawTransactionWithWallet(child)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign CPFP child: %v", err)
+	}
+	if !complete {
+		return nil, fmt.Errorf("wallet could not fully sign CPFP child")
+	}
+	return s.sendRawTx(ctx, signed)
+}
+
+func marshalParams(params ...interface{}) ([]json.RawMessage, error) {
+	out := make([]json.RawMessage, len(params))
+	for i, p := range params {
+		raw, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = raw
+	}
+	return out, nil
+}
+
+// withContext2 is withContext for calls with two results.
+func withContext2[A, B any](ctx context.Context, call func() (A, B, error)) (A, B, error) {
+	type pair struct {
+		a A
+		b B
+	}
+	p, err := withContext(ctx, func() (pair, error) {
+		a, b, err := call()
+		return pair{a, b}, err
+	})
+	return p.a, p.b, err
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// fakeBumpBackend is an in-memory node for TxTracker tests.
+type fakeBumpBackend struct {
+	height    int64
+	confirmed map[chainhash.Hash]bool
+	estimate  FeeRate
+	sent      []*wire.MsgTx
+	bumpErr   error
+	bumped    []FeeRate
+	children  []chainhash.Hash
+}
+
+func newFakeBumpBackend() *fakeBumpBackend {
+	return &fakeBumpBackend{height: 100, confirmed: make(map[chainhash.Hash]bool), estimate: FeeRatePerVByte(1)}
+}
+
+func (f *fakeBumpBackend) CurrentHeight(ctx context.Context) (int64, error) { return f.height, nil }
+
+func (f *fakeBumpBackend) GetConfirmations(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	if f.confirmed[*txHash] {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (f *fakeBumpBackend) sendRawTx(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error) {
+	f.sent = append(f.sent, tx)
+	hash := tx.TxHash()
+	return &hash, nil
+}
+
+func (f *fakeBumpBackend) estimateFeeRate(ctx context.Context) FeeRate { return f.estimate }
+
+func (f *fakeBumpBackend) bumpWalletFee(ctx context.Context, txHash *chainhash.Hash, rate FeeRate) (*chainhash.Hash, error) {
+	if f.bumpErr != nil {
+		return nil, f.bumpErr
+	}
+	f.bumped = append(f.bumped, rate)
+	hash := chainhash.DoubleHashH(append(txHash[:], byte(len(f.bumped))))
+	return &hash, nil
+}
+
+func (f *fakeBumpBackend) payForParent(ctx context.Context, parent *chainhash.Hash, rate FeeRate) (*chainhash.Hash, error) {
+	f.children = append(f.children, *parent)
+	hash := chainhash.DoubleHashH(parent[:])
+	return &hash, nil
+}
+
+// TestTxTrackerReplacesStuckRedeem checks that an unconfirmed redeem is
+// re-signed at a higher rate after the configured number of blocks, and that
+// the replacement is reported and tracked until it confirms.
+func TestTxTrackerReplacesStuckRedeem(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBumpBackend()
+	tracker := newTxTracker(backend, 2, FeeRatePerVByte(50))
+
+	var replaced [][2]chainhash.Hash
+	tracker.SetReplacedHandler(func(oldHash, newHash chainhash.Hash) {
+		replaced = append(replaced, [2]chainhash.Hash{oldHash, newHash})
+	})
+
+	var rates []FeeRate
+	rebuild := func(rate FeeRate) (*wire.MsgTx, error) {
+		rates = append(rates, rate)
+		tx := wire.NewMsgTx(2)
+		tx.AddTxOut(wire.NewTxOut(100_000-int64(rate), nil))
+		return tx, nil
+	}
+	original, _ := rebuild(FeeRatePerVByte(2))
+	rates = nil
+	tracker.track(&trackedTx{hash: original.TxHash(), label: "HTLC claim", kind: txRedeem, raw: original, feeRate: FeeRatePerVByte(2), rebuild: rebuild})
+
+	tracker.checkAll(ctx) // Records the broadcast height
+	backend.height++
+	tracker.checkAll(ctx)
+	if len(rates) != 0 {
+		t.Fatalf("bumped after only one block")
+	}
+
+	backend.height++
+	tracker.checkAll(ctx)
+	if len(rates) != 1 || rates[0] != FeeRatePerVByte(3) {
+		t.Fatalf("expected one bump to 3 sat/vB, got %v", rates)
+	}
+	if len(replaced) != 1 || replaced[0][0] != original.TxHash() || replaced[0][1] != backend.sent[0].TxHash() {
+		t.Fatalf("expected the replacement to be reported, got %v", replaced)
+	}
+
+	backend.confirmed[backend.sent[0].TxHash()] = true
+	tracker.checkAll(ctx)
+	if len(tracker.txs) != 0 {
+		t.Errorf("expected the confirmed replacement to be dropped, %d still tracked", len(tracker.txs))
+	}
+}
+
+// TestTxTrackerFallsBackToCpfp checks that a wallet payout the wallet cannot
+// replace is bumped with a child, and that external txs are never bumped.
+func TestTxTrackerFallsBackToCpfp(t *testing.T) {
+	ctx := context.Background()
+	backend := newFakeBumpBackend()
+	backend.bumpErr = errors.New("Transaction is not BIP 125 replaceable")
+	tracker := newTxTracker(backend, 1, FeeRatePerVByte(50))
+
+	payout := chainhash.DoubleHashH([]byte("payout"))
+	refund := chainhash.DoubleHashH([]byte("refund"))
+	tracker.track(&trackedTx{hash: payout, label: "payout", kind: txWallet, feeRate: FeeRatePerVByte(1)})
+	tracker.track(&trackedTx{hash: refund, label: "external tx", kind: txExternal})
+
+	tracker.checkAll(ctx)
+	backend.height++
+	tracker.checkAll(ctx)
+
+	if len(backend.children) != 1 || backend.children[0] != payout {
+		t.Fatalf("expected a CPFP child for the payout only, got %v", backend.children)
+	}
+	if _, ok := tracker.txs[refund]; !ok {
+		t.Error("an external tx should stay tracked for rebroadcasting")
+	}
+	if _, ok := tracker.txs[payout]; !ok {
+		t.Error("a CPFP-bumped parent should stay tracked under its own txid")
+	}
+}
+
+// TestNextFeeRate checks the bump step and the ceiling.
+func TestNextFeeRate(t *testing.T) {
+	ceiling := FeeRatePerVByte(100)
+	cases := []struct {
+		prev, estimate, want FeeRate
+		ok                   bool
+	}{
+		{FeeRatePerVByte(2), FeeRatePerVByte(1), FeeRatePerVByte(3), true},   // At least +1 sat/vB
+		{FeeRatePerVByte(20), FeeRatePerVByte(1), FeeRatePerVByte(25), true}, // At least +25%
+		{FeeRatePerVByte(20), FeeRatePerVByte(40), FeeRatePerVByte(40), true},
+		{FeeRatePerVByte(90), FeeRatePerVByte(1), ceiling, true},
+		{ceiling, FeeRatePerVByte(500), ceiling, false},
+	}
+	for _, c := range cases {
+		got, ok := nextFeeRate(c.prev, c.estimate, ceiling)
+		if got != c.want || ok != c.ok {
+			t.Errorf("nextFeeRate(%s, %s) = %s, %v; want %s, %v", c.prev, c.estimate, got, ok, c.want, c.ok)
+		}
+	}
+}